@@ -4,12 +4,10 @@ go 1.13
 
 require (
 	github.com/araddon/dateparse v0.0.0-20190622164848-0fb0a474d195
-	github.com/hpcloud/tail v1.0.0
-	github.com/prometheus/common v0.4.1
+	github.com/klauspost/compress v1.10.10
+	github.com/prometheus/client_golang v1.0.0
 	github.com/prometheus/tsdb v0.10.0
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4
 	golang.org/x/sys v0.0.0-20191118133127-cf1e2d577169 // indirect
-	gopkg.in/fsnotify.v1 v1.4.7 // indirect
-	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 )
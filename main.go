@@ -1,40 +1,199 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"httpmonitor/monitor"
 )
 
 func main() {
-	filename := flag.String("filename", "/tmp/access.log", "path to HTTP access log")
+	if len(os.Args) > 1 && os.Args[1] == "test-rules" {
+		os.Exit(testRules(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(query(os.Args[2:]))
+	}
+
+	filename := flag.String("filename", "/tmp/access.log", "comma separated paths or glob patterns of HTTP access logs, - for the standard input")
 	threshold := flag.Float64("threshold", 10.0, "number of requests per second that needs to be exceeded to generate an alert")
+	configFile := flag.String("config", "", "path to a JSON configuration file with alert rules and notifiers (replaces the threshold alert)")
+	checkpointFile := flag.String("checkpoint", "", "path to a file where the read positions are saved, so a restart resumes where it stopped")
+	backfill := flag.Int("backfill", 0, "number of rotated files (e.g access.log.1, access.log.2.gz) read before following each file")
+	syslogAddresses := flag.String("syslog", "", "comma separated addresses where syslog messages are received (e.g udp://:5514,tcp://:5514)")
+	listenAddress := flag.String("listen-address", "", "address where the HTTP API is served (e.g :8080), disabled if empty")
+	ingest := flag.Bool("ingest", false, "accept batches of logging lines pushed to /api/v1/ingest (requires -listen-address)")
+	ingestSecret := flag.String("ingest-secret", "", "bearer token required by the ingest endpoint, $HTTPMONITOR_INGEST_SECRET if empty")
+	ingestInsecure := flag.Bool("ingest-insecure", false, "accept the ingest requests without authentication when there is no secret")
+	ingestMaxBodySize := flag.Int64("ingest-max-body-size", monitor.DefaultIngestMaxBodySize, "size limit in bytes of an ingested batch, before and after decompression")
+	deadLetterFile := flag.String("dead-letter", "", "path to a file where the lines which can't be parsed are written, as JSON lines")
+	deadLetterMaxSize := flag.Int64("dead-letter-max-size", monitor.DefaultDeadLetterMaxSize, "size in bytes of the dead-letter file before its rotation")
+	deadLetterMaxFiles := flag.Int("dead-letter-max-files", monitor.DefaultDeadLetterMaxFiles, "number of rotated dead-letter files kept")
+	parseWorkers := flag.Int("parse-workers", runtime.NumCPU(), "number of workers parsing the lines in parallel")
+	batchSize := flag.Int("batch-size", monitor.DefaultBatchSize, "number of entries committed at once into the database")
+	flushInterval := flag.Duration("flush-interval", monitor.DefaultFlushInterval, "longest time an entry waits before being committed")
+	queueSize := flag.Int("queue-size", monitor.DefaultQueueSize, "number of entries waiting to be committed")
+	dropWhenFull := flag.Bool("drop-when-full", false, "drop the entries while the queue is full, instead of slowing down the reading")
+	storage := flag.String("storage", monitor.StorageTSDB, "where the entries are stored: tsdb (on disk) or memory (for short retentions)")
+	dataDir := flag.String("data-dir", "", "directory of the database, reopened after a restart (a temporary directory deleted at the end if empty)")
+	retention := flag.Duration("retention", monitor.DefaultRetention, "how long the entries are kept in the database")
+	rollupRetention := flag.Duration("rollup-retention", 0, "how long the hits and the bytes rolled up by minute and by hour are kept, for the ranges older than --retention (no rollups if 0, tsdb storage only)")
+	retentionSize := flag.Int64("retention-size", 0, "size limit in bytes of the database, the oldest entries are deleted first (unlimited if 0)")
+	labels := flag.String("labels", "", "comma separated labels stored with the entries (e.g host,user,method,section,status), all if empty")
+	routes := flag.String("routes", "", "comma separated route patterns stored as the route label (e.g /api/:version/users/:name,/static/*)")
+	keepQueryString := flag.Bool("keep-query-string", false, "keep the query strings of the URLs in the url label")
+	statsMatchers := flag.String("stats-matchers", "", `matchers of the entries summarized in the traffic stats (e.g status=~"5..",host="10.0.0.1"), all if empty`)
+	distinctLabels := flag.String("distinct-labels", strings.Join(monitor.DefaultDistinctLabels, ","), "comma separated labels whose distinct values are estimated, in the traffic stats and the distinct alerts (none if empty)")
+	topLabels := flag.String("top-labels", strings.Join(monitor.DefaultTopLabels, ","), "comma separated labels whose heavy hitters are tracked by minute, for the top values of the stats (none if empty)")
+	maxLabelValues := flag.Int("max-label-values", monitor.DefaultMaxLabelValues, "number of distinct values of each label during the retention, the next ones are stored as __other__ (unlimited if 0)")
 	flag.Parse()
 
-	alerts := []*monitor.Alert{
-		monitor.NewAlert(
-			fmt.Sprintf("Traffic from last 2 minutes with %f threshold", *threshold),
-			5*time.Second,
-			2*time.Minute,
-			*threshold,
-			monitor.RequestMethodLabel,
-			monitor.AllEntriesPattern,
-		),
+	alerts := []*monitor.Alert{defaultAlert(*threshold)}
+
+	var labelNames, routePatterns, distinctLabelNames, topLabelNames []string
+	if *labels != "" {
+		labelNames = strings.Split(*labels, ",")
+	}
+	if *distinctLabels != "" {
+		distinctLabelNames = strings.Split(*distinctLabels, ",")
+	}
+	if *topLabels != "" {
+		topLabelNames = strings.Split(*topLabels, ",")
+	}
+	if *routes != "" {
+		routePatterns = strings.Split(*routes, ",")
+	}
+
+	opts := []monitor.Option{
+		monitor.WithParseWorkers(*parseWorkers),
+		monitor.WithWriter(monitor.WriterConfig{
+			BatchSize:     *batchSize,
+			FlushInterval: *flushInterval,
+			QueueSize:     *queueSize,
+			DropWhenFull:  *dropWhenFull,
+		}),
+		monitor.WithDatabase(monitor.DatabaseConfig{
+			Storage:         *storage,
+			Dir:             *dataDir,
+			Retention:       *retention,
+			MaxBytes:        *retentionSize,
+			RollupRetention: *rollupRetention,
+			Labels: monitor.LabelConfig{
+				Labels:          labelNames,
+				KeepQueryString: *keepQueryString,
+				Routes:          routePatterns,
+				MaxValues:       *maxLabelValues,
+				DistinctLabels:  distinctLabelNames,
+				TopLabels:       topLabelNames,
+			},
+		}),
+	}
+	if *statsMatchers != "" {
+		matchers, err := monitor.ParseMatchers(*statsMatchers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, monitor.WithStatsMatchers(matchers...))
+	}
+
+	if *checkpointFile != "" {
+		checkpoint, err := monitor.LoadCheckpoint(*checkpointFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, monitor.WithCheckpoint(checkpoint))
+	}
+
+	if *deadLetterFile != "" {
+		deadLetter, err := monitor.OpenDeadLetter(*deadLetterFile, *deadLetterMaxSize, *deadLetterMaxFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, monitor.WithDeadLetter(deadLetter))
+	}
+
+	if *backfill > 0 {
+		opts = append(opts, monitor.WithBackfill(*backfill))
+	}
+
+	if *syslogAddresses != "" {
+		for _, address := range strings.Split(*syslogAddresses, ",") {
+			u, err := url.Parse(address)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			source, err := monitor.ListenSyslog(u.Scheme, u.Host)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts = append(opts, monitor.WithSources(source))
+		}
+	}
+
+	if *listenAddress != "" {
+		opts = append(opts, monitor.WithAPI(*listenAddress))
 	}
 
-	m, err := monitor.NewMonitor(*filename, alerts)
+	if *ingest {
+		if *ingestSecret == "" {
+			*ingestSecret = os.Getenv("HTTPMONITOR_INGEST_SECRET")
+		}
+		opts = append(opts, monitor.WithIngest(monitor.IngestConfig{Secret: *ingestSecret, Insecure: *ingestInsecure, MaxBodySize: *ingestMaxBodySize}))
+	}
+
+	if *configFile != "" {
+		config, err := monitor.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		alerts, err = config.Alerts()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(config.Notifiers) > 0 {
+			notifiers, err := config.NewNotifiers()
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts = append(opts, monitor.WithNotifiers(notifiers...))
+		}
+
+		if config.Group != nil {
+			opts = append(opts, monitor.WithGrouping(*config.Group))
+		}
+
+		if len(config.InhibitRules) > 0 {
+			opts = append(opts, monitor.WithInhibitRules(config.InhibitRules))
+		}
+	}
+
+	m, err := monitor.NewMonitor(strings.Split(*filename, ","), alerts, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Handle sigterm and await termChan signal
-	termChan := make(chan os.Signal)
+	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start the monitoring
@@ -53,3 +212,220 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// defaultAlert is the alert used without a configuration file.
+func defaultAlert(threshold float64) *monitor.Alert {
+	return monitor.NewAlert(
+		fmt.Sprintf("Traffic from last 2 minutes with %f threshold", threshold),
+		5*time.Second,
+		2*time.Minute,
+		threshold,
+		monitor.RequestMethodLabel,
+		monitor.AllEntriesPattern,
+	)
+}
+
+// replay ingests the given files once, evaluates the alerts against the dates of the entries and returns the exit
+// code. The standard input is read when no file is given.
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	threshold := flags.Float64("threshold", 10.0, "number of requests per second that needs to be exceeded to generate an alert")
+	configFile := flags.String("config", "", "path to a JSON configuration file with alert rules (replaces the threshold alert)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [flags] [file]...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	alerts := []*monitor.Alert{defaultAlert(*threshold)}
+	if *configFile != "" {
+		config, err := monitor.LoadConfig(*configFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		alerts, err = config.Alerts()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{monitor.StdinPath}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	termChan := make(chan os.Signal, 1)
+	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-termChan
+		cancel()
+	}()
+
+	sources := []monitor.LineSource{monitor.NewFileSource(paths...)}
+	if _, err := monitor.Replay(ctx, sources, alerts, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// query prints the result of a query of the query language, or the hits of the values of a label by step, from the
+// HTTP API of a running monitor, and returns the exit code.
+func query(args []string) int {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	address := flags.String("address", "http://localhost:8080", "URL of the HTTP API of the monitor (see -listen-address)")
+	at := flags.String("time", "", "time of a query, where its ranges end, like -since (now if empty)")
+	pattern := flags.String("pattern", monitor.AllEntriesPattern, "regular expression matching the values of the label")
+	match := flags.String("match", "", `other matchers of the entries (e.g status=~"5..",host!="10.0.0.1")`)
+	since := flags.String("since", "1h", "start of the range: a duration before now (e.g 30m), a Unix timestamp or an RFC 3339 time")
+	until := flags.String("until", "", "end of the range, like -since (now if empty)")
+	step := flags.Duration("step", time.Minute, "duration of the steps")
+	asJSON := flags.Bool("json", false, "print the response of the API as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s query [flags] <query>|<label>\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), `A query is evaluated at -time, e.g 'topk(5, count by (section) ({status=~"5.."}[5m]))'.`)
+		fmt.Fprintln(flags.Output(), "A label prints the hits of its values by step, between -since and -until.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	now := time.Now()
+	queryTime := func(value string) string {
+		if ago, err := time.ParseDuration(value); err == nil {
+			return strconv.FormatInt(now.Add(-ago).Unix(), 10)
+		}
+		return value
+	}
+
+	var result interface{}
+	var printResult func()
+	params := url.Values{}
+	path := "/api/v1/query"
+	if labelName.MatchString(flags.Arg(0)) {
+		path = "/api/v1/query_range"
+		params.Set("label", flags.Arg(0))
+		params.Set("pattern", *pattern)
+		if *match != "" {
+			params.Set("match", *match)
+		}
+		params.Set("step", step.String())
+		params.Set("since", queryTime(*since))
+		if *until != "" {
+			params.Set("until", queryTime(*until))
+		}
+
+		rangeResult := &monitor.RangeResult{}
+		result, printResult = rangeResult, func() { printRange(rangeResult) }
+	} else {
+		params.Set("query", flags.Arg(0))
+		if *at != "" {
+			params.Set("time", queryTime(*at))
+		}
+
+		queryResult := &monitor.QueryResult{}
+		result, printResult = queryResult, func() {
+			for _, group := range queryResult.Result {
+				fmt.Println(group)
+			}
+		}
+	}
+
+	if err := getAPI(strings.TrimSuffix(*address, "/")+path+"?"+params.Encode(), result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return 0
+	}
+
+	printResult()
+	return 0
+}
+
+// labelName matches the label names, the other arguments of the query subcommand are queries.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// getAPI decodes the JSON response of an endpoint of the HTTP API.
+func getAPI(endpoint string, result interface{}) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(response.Body).Decode(&apiError)
+		return fmt.Errorf("query failed with status %d: %s", response.StatusCode, apiError.Error)
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// printRange prints a table with a row per step and a column per value of the label.
+func printRange(result *monitor.RangeResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprint(w, "TIME")
+	for _, series := range result.Series {
+		fmt.Fprintf(w, "\t%s=%q", result.Label, series.Key)
+	}
+	fmt.Fprintln(w)
+
+	for t := result.Since; t <= result.Until; t += result.Step {
+		fmt.Fprint(w, time.Unix(t, 0).Format("2006-01-02 15:04:05"))
+		for _, series := range result.Series {
+			fmt.Fprintf(w, "\t%g", series.Points[(t-result.Since)/result.Step].Value)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// testRules runs the alert rule unit tests from the given files and returns the exit code.
+func testRules(args []string) int {
+	flags := flag.NewFlagSet("test-rules", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s test-rules <test file>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	for _, path := range flags.Args() {
+		passed, err := monitor.RunRuleTests(path, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !passed {
+			exitCode = 1
+		}
+	}
+
+	return exitCode
+}
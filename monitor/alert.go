@@ -2,7 +2,11 @@ package monitor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -18,6 +22,75 @@ const (
 	Critical
 )
 
+var statusNames = map[Status]string{
+	Unknown:  "unknown",
+	OK:       "ok",
+	Critical: "critical",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// MarshalJSON encodes the status as its name.
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes a status name.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	status, err := ParseStatus(name)
+	if err != nil {
+		return err
+	}
+
+	*s = status
+	return nil
+}
+
+// ParseStatus converts a status name (e.g "ok" or "critical") to a Status.
+func ParseStatus(name string) (Status, error) {
+	for status, n := range statusNames {
+		if n == name {
+			return status, nil
+		}
+	}
+
+	return Unknown, fmt.Errorf("unknown alert status %q", name)
+}
+
+// Aggregations of the hits of an alert's window, compared to its threshold.
+const (
+	// AggregationAverage is the average number of hits per second over the window.
+	AggregationAverage = "average"
+	// AggregationPeak is the highest number of hits per second over a step of the window: the alert fires on bursts.
+	AggregationPeak = "peak"
+	// AggregationSustained is the lowest number of hits per second over a step of the window: the alert fires only
+	// when the traffic stays above the threshold during the whole window.
+	AggregationSustained = "sustained"
+	// AggregationDistinct is the estimated number of distinct values of the alert's label over the window, e.g the
+	// clients with HostLabel. The label must be counted (see LabelConfig.DistinctLabels), and the pattern and the
+	// matchers aren't used.
+	AggregationDistinct = "distinct"
+)
+
+// DefaultAlertStep is the default step of the peak and sustained aggregations.
+const DefaultAlertStep = 10 * time.Second
+
+var (
+	defaultAlertMessage = template.Must(NewTemplate("message", DefaultAlertMessage))
+	defaultNotifier     = NewWriterNotifier(os.Stdout, nil)
+)
+
 // Alert is used to configure an alert.
 type Alert struct {
 	checkingInterval time.Duration
@@ -25,36 +98,189 @@ type Alert struct {
 	threshold        float64
 	label            string
 	pattern          string
+	matchers         []Matcher
+	aggregation      string
+	step             time.Duration
 	status           Status
 	name             string
+	labels           map[string]string
+	message          *template.Template
+	notifier         Notifier
+
+	// mu protects the state of the alert, which can be read while the alert is checked.
+	mu       sync.Mutex
+	value    float64
+	activeAt time.Time
+}
+
+// AlertState is a snapshot of an alert's state.
+type AlertState struct {
+	Name      string            `json:"name"`
+	Status    Status            `json:"status"`
+	Value     float64           `json:"value"`
+	Threshold float64           `json:"threshold"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	ActiveAt  *time.Time        `json:"activeAt,omitempty"`
+	Inhibited bool              `json:"inhibited"`
+}
+
+// AlertOption is used to customize an alert.
+type AlertOption func(*Alert)
+
+// WithLabels attaches labels to the alert, available to the templates and the notifiers.
+func WithLabels(labels map[string]string) AlertOption {
+	return func(a *Alert) {
+		a.labels = labels
+	}
+}
+
+// WithMessage sets the template used to render the alert's message. The template receives an AlertEvent.
+func WithMessage(tmpl *template.Template) AlertOption {
+	return func(a *Alert) {
+		a.message = tmpl
+	}
+}
+
+// WithMatchers restricts the alert to the entries matching all the matchers, in addition to its label and pattern.
+func WithMatchers(matchers ...Matcher) AlertOption {
+	return func(a *Alert) {
+		a.matchers = matchers
+	}
+}
+
+// WithAggregation sets how the hits of the window, or its distinct values, are compared to the threshold
+// (AggregationAverage by default).
+// The peak and sustained aggregations count the hits by "step", DefaultAlertStep is used if it's not positive.
+func WithAggregation(aggregation string, step time.Duration) AlertOption {
+	return func(a *Alert) {
+		a.aggregation = aggregation
+		if step > 0 {
+			a.step = step
+		}
+	}
 }
 
 // NewAlert is used to create a new alert.
-func NewAlert(name string, checkingInterval time.Duration, dataInterval time.Duration, threshold float64, label string, pattern string) *Alert {
-	return &Alert{
+// By default, the status changes are written to the standard output using DefaultAlertMessage.
+func NewAlert(name string, checkingInterval time.Duration, dataInterval time.Duration, threshold float64, label string, pattern string, opts ...AlertOption) *Alert {
+	a := &Alert{
 		checkingInterval: checkingInterval,
 		dataInterval:     dataInterval,
 		threshold:        threshold,
 		label:            label,
 		pattern:          pattern,
+		aggregation:      AggregationAverage,
+		step:             DefaultAlertStep,
 		status:           OK,
 		name:             name,
+		message:          defaultAlertMessage,
+		notifier:         defaultNotifier,
+	}
+
+	for _, opt := range opts {
+		opt(a)
 	}
+
+	return a
+}
+
+// Name returns the name of the alert.
+func (a *Alert) Name() string {
+	return a.name
+}
+
+// Status returns the current status of the alert.
+func (a *Alert) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.status
+}
+
+// State returns a snapshot of the alert's state.
+func (a *Alert) State() AlertState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := AlertState{
+		Name:      a.name,
+		Status:    a.status,
+		Value:     a.value,
+		Threshold: a.threshold,
+		Labels:    a.labels,
+	}
+	if a.status == Critical {
+		activeAt := a.activeAt
+		state.ActiveAt = &activeAt
+	}
+
+	return state
+}
+
+// CheckingInterval returns how often the alert is checked.
+func (a *Alert) CheckingInterval() time.Duration {
+	return a.checkingInterval
 }
 
 // CheckStatus is used to update the status of the alert and to notify in case of changes.
-// The data from last "dataInterval" seconds and stored under the specified "label" which is matching the "pattern", is
-// aggregated each "checkingInterval" seconds. If the result exceeds the "threshold" for the first time, the state of
-// alert is changed to Critical and a logging message is displayed. When the result goes below the "threshold" the
-// state of alert is moved back to OK and a new logging message is displayed.
-func (a *Alert) CheckStatus(db *LoggingDatabase) error {
-	now := time.Now()
+// The data from last "dataInterval" seconds and stored under the specified "label" which is matching the "pattern" (and
+// the matchers of WithMatchers), is aggregated each "checkingInterval" seconds, as configured by WithAggregation. If
+// the result exceeds the "threshold" for the first time, the state of alert is changed to Critical and a logging
+// message is displayed. When the result goes below the "threshold" the state of alert is moved back to OK and a new
+// logging message is displayed.
+// The messages are rendered from the alert's template and delivered through its notifier.
+func (a *Alert) CheckStatus(db Storage) error {
+	return a.CheckStatusAt(db, time.Now())
+}
+
+// CheckStatusAt works like CheckStatus, but evaluates the alert as if the current time would be "now".
+func (a *Alert) CheckStatusAt(db Storage, now time.Time) error {
+	value, since, err := a.evaluate(db, now)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	changed := false
+	a.value = value
+	if value >= a.threshold {
+		if a.status == OK {
+			a.status = Critical
+			a.activeAt = now
+			changed = true
+		}
+	} else {
+		if a.status == Critical {
+			a.status = OK
+			changed = true
+		}
+	}
+	status := a.status
+	a.mu.Unlock()
+
+	if changed {
+		return a.notify(db, status, value, since, now)
+	}
+
+	return nil
+}
+
+// evaluate aggregates the hits of the window ending at "now", and returns the result with the start of the window.
+func (a *Alert) evaluate(db Storage, now time.Time) (float64, time.Time, error) {
+	if a.aggregation == AggregationPeak || a.aggregation == AggregationSustained {
+		return a.evaluateSteps(db, now)
+	}
+
 	since := now.Add(-a.dataInterval)
+	if a.aggregation == AggregationDistinct {
+		count, err := db.CountDistinct(a.label, since.Unix(), now.Unix())
+		return count, since, err
+	}
 
 	// Get the entries from last dataInterval seconds that match the pattern.
-	stats, err := db.GetEntries(a.label, a.pattern, since.Unix(), now.Unix())
+	stats, err := db.GetEntries(a.label, a.pattern, since.Unix(), now.Unix(), a.matchers...)
 	if err != nil {
-		return err
+		return 0, since, err
 	}
 
 	// Count total number of hits.
@@ -63,25 +289,92 @@ func (a *Alert) CheckStatus(db *LoggingDatabase) error {
 		total += e.Value
 	}
 
-	// Compute the average and check if the threshold was reached.
-	average := total / float64(a.dataInterval.Seconds())
-	if average >= a.threshold {
-		if a.status == OK {
-			a.status = Critical
-			fmt.Printf("High traffic generated an alert - hits = %f, triggered at %s\n", average, now.Format("2006-01-02 15:04:05 -0700 MST"))
+	// Compute the average.
+	return total / float64(a.dataInterval.Seconds()), since, nil
+}
+
+// evaluateSteps counts the hits of the window by step, and returns the highest or the lowest rate of the steps. The
+// window is made of whole steps ending with the second of "now", the step is cut to the window if it's longer.
+func (a *Alert) evaluateSteps(db Storage, now time.Time) (float64, time.Time, error) {
+	step := int64(a.step / time.Second)
+	if a.step > a.dataInterval {
+		step = int64(a.dataInterval / time.Second)
+	}
+	if step < 1 {
+		step = 1
+	}
+	steps := int64(a.dataInterval/time.Second) / step
+	if steps < 1 {
+		steps = 1
+	}
+
+	until := now.Unix()
+	since := until - steps*step + 1
+	series, err := db.GetRange(a.label, a.pattern, since, until, step, a.matchers...)
+	if err != nil {
+		return 0, time.Unix(since, 0), err
+	}
+
+	totals := make([]float64, steps)
+	for _, s := range series {
+		for i, p := range s.Points {
+			totals[i] += p.Value
 		}
-	} else {
-		if a.status == Critical {
-			a.status = OK
-			fmt.Printf("The traffic returned back to normal - hits = %f, at %s\n", average, now.Format("2006-01-02 15:04:05 -0700 MST"))
+	}
+
+	value := totals[0]
+	for _, total := range totals[1:] {
+		if (a.aggregation == AggregationPeak && total > value) || (a.aggregation == AggregationSustained && total < value) {
+			value = total
 		}
 	}
 
+	return value / float64(step), time.Unix(since, 0), nil
+}
+
+// notify sends an event describing the current status of the alert. The errors of the storage are returned, the
+// failures to render or to deliver the event are only logged.
+func (a *Alert) notify(db Storage, status Status, value float64, since time.Time, now time.Time) error {
+	topSections, err := db.TopEntriesBy(RequestURLSectionLabel, a.label, a.pattern, since.Unix(), now.Unix(), limit, a.matchers...)
+	if err != nil {
+		return err
+	}
+
+	topHosts, err := db.TopEntriesBy(HostLabel, a.label, a.pattern, since.Unix(), now.Unix(), limit, a.matchers...)
+	if err != nil {
+		return err
+	}
+
+	event := &AlertEvent{
+		Name:        a.name,
+		Status:      status,
+		Value:       value,
+		Threshold:   a.threshold,
+		Window:      a.dataInterval,
+		Label:       a.label,
+		Pattern:     a.pattern,
+		Labels:      a.labels,
+		TopSections: topSections,
+		TopHosts:    topHosts,
+		Time:        now,
+	}
+
+	// Delivery failures shouldn't stop the monitoring, the status change is kept.
+	event.Message, err = executeTemplate(a.message, event)
+	if err != nil {
+		fmt.Printf("Failed to render message for alert %s: %v\n", a.name, err)
+		return nil
+	}
+
+	if err := a.notifier.Notify(&Notification{Alerts: []*AlertEvent{event}}); err != nil {
+		fmt.Printf("Failed to send notification for alert %s: %v\n", a.name, err)
+	}
+
 	return nil
 }
 
 // Run is used to monitor and raise an alert. The method is blocking.
-func (a *Alert) Run(ctx context.Context, db *LoggingDatabase) error {
+func (a *Alert) Run(ctx context.Context, db Storage) error {
 	for {
 		select {
 		case <-time.After(a.checkingInterval):
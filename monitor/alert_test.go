@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
@@ -86,6 +88,76 @@ func (suite *AlertTestSuite) TestAlertRemainsCritical() {
 	require.Equal(t, Critical, alert.status, "The final status must be critical.")
 }
 
+func (suite *AlertTestSuite) TestAlertNotification() {
+	t := suite.T()
+
+	tmpl, err := NewTemplate("test", `{{ .Name }} is {{ .Status }} ({{ .Labels.team }})`)
+	require.Nil(t, err, "Unexpected error raised")
+	notifier := &recordingNotifier{}
+
+	alert := NewAlert("test", time.Second, 5*time.Second, 1.0, HostLabel, AllEntriesPattern,
+		WithLabels(map[string]string{"team": "web"}), WithMessage(tmpl))
+	alert.notifier = notifier
+
+	err = suite.addEntries(10)
+	require.Nil(t, err, "No error should be returned while adding entries.")
+
+	err = alert.CheckStatus(suite.db)
+	require.Nil(t, err, "No error should be returned while checking the status.")
+	require.Len(t, notifier.notifications, 1, "One notification should be sent")
+
+	events := notifier.notifications[0].Alerts
+	require.Len(t, events, 1)
+	require.Equal(t, Critical, events[0].Status)
+	require.Equal(t, 2.0, events[0].Value)
+	require.Equal(t, "test is critical (web)", events[0].Message)
+	require.Equal(t, EntryList{{Key: "/report", Value: 10}}, events[0].TopSections)
+	require.Len(t, events[0].TopHosts, limit)
+
+	// No notification is sent while the status doesn't change.
+	err = alert.CheckStatus(suite.db)
+	require.Nil(t, err, "No error should be returned while checking the status.")
+	require.Len(t, notifier.notifications, 1, "No new notification should be sent")
+}
+
+func (suite *AlertTestSuite) TestAlertNotificationFailure() {
+	t := suite.T()
+
+	// The message can't be rendered for the first alert, the notification can't be delivered for the second one.
+	tmpl, err := NewTemplate("test", `{{ .Value.Missing }}`)
+	require.Nil(t, err, "Unexpected error raised")
+	failing := NewAlert("failing", 10*time.Millisecond, 5*time.Second, 1.0, HostLabel, AllEntriesPattern, WithMessage(tmpl))
+	notifier := &recordingNotifier{err: errors.New("disk full")}
+	undelivered := NewAlert("undelivered", 10*time.Millisecond, 5*time.Second, 1.0, HostLabel, AllEntriesPattern)
+	undelivered.notifier = notifier
+
+	require.Nil(t, suite.addEntries(10), "No error should be returned while adding entries.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	for _, alert := range []*Alert{failing, undelivered} {
+		alert := alert
+		go func() {
+			done <- alert.Run(ctx, suite.db)
+		}()
+	}
+
+	// The alerts keep running, with their new status.
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("The alert shouldn't stop: %v", err)
+	default:
+	}
+	require.Equal(t, Critical, failing.State().Status)
+	require.Equal(t, Critical, undelivered.State().Status)
+	require.Len(t, notifier.notifications, 1, "The status change should be notified once")
+
+	cancel()
+	require.Nil(t, <-done)
+	require.Nil(t, <-done)
+}
+
 func (suite *AlertTestSuite) addEntries(count int) error {
 	for i := 0; i < count; i++ {
 		now := time.Now()
@@ -0,0 +1,202 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	alertmanagerAlertsPath        = "/api/v2/alerts"
+	defaultAlertmanagerResend     = time.Minute
+	defaultAlertmanagerTimeout    = 10 * time.Second
+	alertmanagerValidityIntervals = 4
+)
+
+// alertmanagerAlert is an alert in the format of the Alertmanager v2 API.
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// AlertmanagerNotifier pushes the alerts to a Prometheus Alertmanager.
+// The firing alerts are sent again every resend interval, so the Alertmanager doesn't consider them resolved.
+// Delivery failures are logged and retried at the next resend, without stopping the monitoring.
+type AlertmanagerNotifier struct {
+	url            string
+	generatorURL   string
+	resendInterval time.Duration
+	template       *template.Template
+	client         *http.Client
+	now            func() time.Time
+
+	mu       sync.Mutex
+	active   map[string]*alertmanagerAlert
+	resolved map[string]*alertmanagerAlert
+}
+
+// NewAlertmanagerNotifier is used to create a notifier for the Alertmanager available at url
+// (e.g "http://localhost:9093"). If tmpl is not nil, it renders the "description" annotation.
+func NewAlertmanagerNotifier(url string, generatorURL string, resendInterval time.Duration, tmpl *template.Template) *AlertmanagerNotifier {
+	if resendInterval <= 0 {
+		resendInterval = defaultAlertmanagerResend
+	}
+
+	return &AlertmanagerNotifier{
+		url:            strings.TrimSuffix(url, "/") + alertmanagerAlertsPath,
+		generatorURL:   generatorURL,
+		resendInterval: resendInterval,
+		template:       tmpl,
+		client:         &http.Client{Timeout: defaultAlertmanagerTimeout},
+		now:            time.Now,
+		active:         make(map[string]*alertmanagerAlert),
+		resolved:       make(map[string]*alertmanagerAlert),
+	}
+}
+
+// Notify updates the state of the alerts and pushes them to the Alertmanager.
+func (an *AlertmanagerNotifier) Notify(n *Notification) error {
+	an.mu.Lock()
+	for _, event := range n.Alerts {
+		alert, err := an.alert(event)
+		if err != nil {
+			an.mu.Unlock()
+			return err
+		}
+
+		if event.Firing() {
+			if active, ok := an.active[event.Name]; ok {
+				alert.StartsAt = active.StartsAt
+			}
+			an.active[event.Name] = alert
+			delete(an.resolved, event.Name)
+		} else {
+			if active, ok := an.active[event.Name]; ok {
+				alert.StartsAt = active.StartsAt
+			}
+			an.resolved[event.Name] = alert
+			delete(an.active, event.Name)
+		}
+	}
+	an.mu.Unlock()
+
+	an.push()
+	return nil
+}
+
+// Run sends the alerts again every resend interval. The method is blocking.
+func (an *AlertmanagerNotifier) Run(ctx context.Context) error {
+	ticker := time.NewTicker(an.resendInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			an.push()
+		case <-ctx.Done():
+			fmt.Println("Stop sending alerts to Alertmanager")
+			return nil
+		}
+	}
+}
+
+// push sends the active alerts and the resolved ones not delivered yet.
+func (an *AlertmanagerNotifier) push() {
+	an.mu.Lock()
+	now := an.now()
+	validUntil := now.Add(alertmanagerValidityIntervals * an.resendInterval)
+
+	alerts := make([]alertmanagerAlert, 0, len(an.active)+len(an.resolved))
+	for _, alert := range an.active {
+		a := *alert
+		a.EndsAt = validUntil
+		alerts = append(alerts, a)
+	}
+	resolved := make(map[string]*alertmanagerAlert, len(an.resolved))
+	for name, alert := range an.resolved {
+		alerts = append(alerts, *alert)
+		resolved[name] = alert
+	}
+	an.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Labels[AlertNameLabel] < alerts[j].Labels[AlertNameLabel] })
+
+	if err := an.send(alerts); err != nil {
+		fmt.Printf("Failed to send alerts to Alertmanager: %v\n", err)
+		return
+	}
+
+	// The resolved alerts are sent until the first successful delivery.
+	an.mu.Lock()
+	for name, alert := range resolved {
+		if an.resolved[name] == alert {
+			delete(an.resolved, name)
+		}
+	}
+	an.mu.Unlock()
+}
+
+func (an *AlertmanagerNotifier) send(alerts []alertmanagerAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	resp, err := an.client.Post(an.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// alert converts an event to the Alertmanager format.
+func (an *AlertmanagerNotifier) alert(event *AlertEvent) (*alertmanagerAlert, error) {
+	labels := alertLabels(event.Name, event.Labels)
+
+	annotations := map[string]string{
+		"summary":   event.Message,
+		"value":     fmt.Sprintf("%f", event.Value),
+		"threshold": fmt.Sprintf("%f", event.Threshold),
+	}
+	if an.template != nil {
+		description, err := executeTemplate(an.template, &Notification{Alerts: []*AlertEvent{event}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render description for alert %s: %w", event.Name, err)
+		}
+		annotations["description"] = description
+	}
+
+	alert := &alertmanagerAlert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     event.Time,
+		GeneratorURL: an.generatorURL,
+	}
+	if !event.Firing() {
+		alert.EndsAt = event.Time
+	}
+
+	return alert, nil
+}
@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// alertmanagerStub records the alerts posted to the Alertmanager API.
+type alertmanagerStub struct {
+	mu       sync.Mutex
+	requests [][]alertmanagerAlert
+	status   int
+}
+
+func (s *alertmanagerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != alertmanagerAlertsPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	var alerts []alertmanagerAlert
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, alerts)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+}
+
+func (s *alertmanagerStub) received() [][]alertmanagerAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func newTestAlertmanager(t *testing.T) (*alertmanagerStub, *AlertmanagerNotifier, *fakeClock, func()) {
+	stub := &alertmanagerStub{}
+	server := httptest.NewServer(stub)
+
+	tmpl, err := NewTemplate("description", "{{ range .Alerts }}{{ .Name }} over {{ duration .Window }}{{ end }}")
+	require.Nil(t, err, "Unexpected error raised")
+
+	clock := &fakeClock{now: ruleTestStart}
+	notifier := NewAlertmanagerNotifier(server.URL+"/", "http://monitor:8080/api/v1/alerts", time.Minute, tmpl)
+	notifier.now = clock.Now
+
+	return stub, notifier, clock, server.Close
+}
+
+func TestAlertmanagerNotifierFiring(t *testing.T) {
+	stub, notifier, _, closeServer := newTestAlertmanager(t)
+	defer closeServer()
+
+	event := &AlertEvent{Name: "traffic", Status: Critical, Value: 12, Threshold: 10, Window: 2 * time.Minute,
+		Labels: map[string]string{"team": "web"}, Time: ruleTestStart, Message: "High traffic"}
+	err := notifier.Notify(&Notification{Alerts: []*AlertEvent{event}})
+	require.Nil(t, err, "Unexpected error raised")
+
+	received := stub.received()
+	require.Len(t, received, 1)
+	require.Len(t, received[0], 1)
+
+	alert := received[0][0]
+	require.Equal(t, map[string]string{AlertNameLabel: "traffic", "team": "web"}, alert.Labels)
+	require.Equal(t, map[string]string{
+		"summary":     "High traffic",
+		"description": "traffic over 2m",
+		"value":       "12.000000",
+		"threshold":   "10.000000",
+	}, alert.Annotations)
+	require.True(t, ruleTestStart.Equal(alert.StartsAt))
+	require.True(t, ruleTestStart.Add(4*time.Minute).Equal(alert.EndsAt), "Firing alerts should be valid for 4 resend intervals")
+	require.Equal(t, "http://monitor:8080/api/v1/alerts", alert.GeneratorURL)
+}
+
+func TestAlertmanagerNotifierResendAndResolve(t *testing.T) {
+	stub, notifier, clock, closeServer := newTestAlertmanager(t)
+	defer closeServer()
+
+	firing := &AlertEvent{Name: "traffic", Status: Critical, Time: ruleTestStart}
+	require.Nil(t, notifier.Notify(&Notification{Alerts: []*AlertEvent{firing}}))
+
+	clock.Advance(time.Minute)
+	notifier.push()
+	received := stub.received()
+	require.Len(t, received, 2, "Firing alerts should be sent again")
+	require.True(t, ruleTestStart.Equal(received[1][0].StartsAt), "The start time should be preserved")
+	require.True(t, ruleTestStart.Add(5*time.Minute).Equal(received[1][0].EndsAt), "The validity should be extended")
+
+	clock.Advance(time.Minute)
+	resolved := &AlertEvent{Name: "traffic", Status: OK, Time: clock.Now()}
+	require.Nil(t, notifier.Notify(&Notification{Alerts: []*AlertEvent{resolved}}))
+	received = stub.received()
+	require.Len(t, received, 3)
+	require.True(t, ruleTestStart.Equal(received[2][0].StartsAt))
+	require.True(t, clock.Now().Equal(received[2][0].EndsAt), "Resolved alerts should end at the resolve time")
+
+	notifier.push()
+	require.Len(t, stub.received(), 3, "Nothing should be sent once the alert was resolved")
+}
+
+func TestAlertmanagerNotifierRetriesResolved(t *testing.T) {
+	stub, notifier, _, closeServer := newTestAlertmanager(t)
+	defer closeServer()
+
+	stub.status = http.StatusServiceUnavailable
+	resolved := &AlertEvent{Name: "traffic", Status: OK, Time: ruleTestStart}
+	require.Nil(t, notifier.Notify(&Notification{Alerts: []*AlertEvent{resolved}}), "Delivery failures shouldn't be returned")
+
+	stub.status = 0
+	notifier.push()
+	require.Len(t, stub.received(), 2, "Undelivered resolved alerts should be sent again")
+
+	notifier.push()
+	require.Len(t, stub.received(), 2, "Delivered resolved alerts shouldn't be sent again")
+}
@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// API exposes the state of the monitor over HTTP.
+type API struct {
+	monitor *Monitor
+	mux     *http.ServeMux
+}
+
+// NewAPI is used to create the HTTP API of a monitor.
+func NewAPI(m *Monitor) *API {
+	api := &API{monitor: m, mux: http.NewServeMux()}
+	api.mux.HandleFunc("/api/v1/alerts", api.alerts)
+	api.mux.HandleFunc("/api/v1/query", api.query)
+	api.mux.HandleFunc("/api/v1/query_range", api.queryRange)
+	api.mux.Handle("/metrics", promhttp.HandlerFor(m.metrics.registry, promhttp.HandlerOpts{}))
+	if m.ingest != nil {
+		api.mux.HandleFunc("/api/v1/ingest", api.ingest)
+	}
+
+	return api
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mux.ServeHTTP(w, r)
+}
+
+// alerts lists the state of all the alerts.
+func (api *API) alerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	states := make([]AlertState, 0, len(api.monitor.alerts))
+	for _, a := range api.monitor.alerts {
+		state := a.State()
+		if state.Status == Critical && api.monitor.inhibitor != nil {
+			state.Inhibited = api.monitor.inhibitor.Inhibited(alertLabels(state.Name, state.Labels))
+		}
+		states = append(states, state)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"alerts": states})
+}
+
+const (
+	// defaultQueryRange is the duration of the range queries without start.
+	defaultQueryRange = time.Hour
+	// defaultQueryStep is the step of the range queries without step.
+	defaultQueryStep = time.Minute
+)
+
+// RangeResult is the response of the range query endpoint.
+type RangeResult struct {
+	Label   string `json:"label"`
+	Pattern string `json:"pattern"`
+	// Match are the other matchers of the entries, e.g `{status=~"5.."}`.
+	Match string `json:"match,omitempty"`
+	// Since and Until are the bounds of the range, as Unix timestamps in seconds.
+	Since int64 `json:"since"`
+	Until int64 `json:"until"`
+	// Step is the duration of the steps, in seconds.
+	Step   int64      `json:"step"`
+	Series SeriesList `json:"series"`
+}
+
+// queryRange counts the hits of the values of a label by step. The parameters are the label, the pattern (all the
+// values by default), the other matchers of the entries, the bounds "since" and "until" (the last hour by default) and
+// the step (a minute by default).
+func (api *API) queryRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	result := RangeResult{Label: query.Get("label"), Pattern: query.Get("pattern"), Match: query.Get("match")}
+	if result.Label == "" {
+		writeError(w, http.StatusBadRequest, "missing label")
+		return
+	}
+	if result.Pattern == "" {
+		result.Pattern = AllEntriesPattern
+	}
+
+	matchers, err := ParseMatchers(result.Match)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	until, err := parseQueryTime(query.Get("until"), now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid until: %v", err))
+		return
+	}
+	since, err := parseQueryTime(query.Get("since"), until.Add(-defaultQueryRange))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid since: %v", err))
+		return
+	}
+	step, err := parseQueryStep(query.Get("step"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid step: %v", err))
+		return
+	}
+	result.Since, result.Until, result.Step = since.Unix(), until.Unix(), int64(step/time.Second)
+
+	result.Series, err = api.monitor.db.GetRange(result.Label, result.Pattern, result.Since, result.Until, result.Step, matchers...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// QueryResult is the response of the query endpoint.
+type QueryResult struct {
+	// Query is the evaluated query, as parsed.
+	Query string `json:"query"`
+	// Time is the end of the ranges of the query, as a Unix timestamp in seconds.
+	Time   int64     `json:"time"`
+	Result GroupList `json:"result"`
+}
+
+// query evaluates a query of the query language (see ParseExpr). The parameters are the query and its time (now by
+// default).
+func (api *API) query(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	expr, err := ParseExpr(params.Get("query"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t, err := parseQueryTime(params.Get("time"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid time: %v", err))
+		return
+	}
+
+	result, err := Evaluate(api.monitor.db, expr, t)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, QueryResult{Query: expr.String(), Time: t.Unix(), Result: result})
+}
+
+// parseQueryTime parses a time given as a Unix timestamp in seconds or in the RFC 3339 format. The default time is
+// returned if it's empty.
+func parseQueryTime(value string, defaultTime time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultTime, nil
+	}
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseQueryStep parses a step given as a duration (e.g "5m") or a number of seconds. The step is at least a second.
+func parseQueryStep(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultQueryStep, nil
+	}
+
+	step, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil {
+			return 0, err
+		}
+		step = time.Duration(seconds) * time.Second
+	}
+	if step < time.Second {
+		return 0, fmt.Errorf("step %s shorter than a second", step)
+	}
+
+	return step, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIAlerts(t *testing.T) {
+	source := NewAlert("TrafficDrop", time.Second, time.Minute, 1, HostLabel, AllEntriesPattern)
+	target := NewAlert("ReportErrors", time.Second, time.Minute, 1, HostLabel, AllEntriesPattern,
+		WithLabels(map[string]string{"scope": "section"}))
+	idle := NewAlert("Idle", time.Second, time.Minute, 1, HostLabel, AllEntriesPattern)
+
+	rules := []InhibitRule{{SourceMatch: map[string]string{AlertNameLabel: "TrafficDrop"}, TargetMatch: map[string]string{"scope": "section"}}}
+	m, err := NewMonitor([]string{"/tmp/access.log"}, []*Alert{source, target, idle}, WithInhibitRules(rules), WithNotifiers(&recordingNotifier{}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	now := time.Now()
+	for _, a := range []*Alert{source, target} {
+		a.status = Critical
+		a.activeAt = now
+		require.Nil(t, m.inhibitor.Notify(event(a.name, Critical, a.labels)))
+	}
+
+	recorder := httptest.NewRecorder()
+	NewAPI(m).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		Alerts []AlertState `json:"alerts"`
+	}
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Alerts, 3)
+
+	require.Equal(t, "TrafficDrop", response.Alerts[0].Name)
+	require.Equal(t, Critical, response.Alerts[0].Status)
+	require.False(t, response.Alerts[0].Inhibited)
+	require.NotNil(t, response.Alerts[0].ActiveAt)
+
+	require.Equal(t, "ReportErrors", response.Alerts[1].Name)
+	require.True(t, response.Alerts[1].Inhibited, "The target alert should be inhibited")
+
+	require.Equal(t, "Idle", response.Alerts[2].Name)
+	require.Equal(t, OK, response.Alerts[2].Status)
+	require.Nil(t, response.Alerts[2].ActiveAt)
+}
+
+func TestAPIMethodNotAllowed(t *testing.T) {
+	m, err := NewMonitor([]string{"/tmp/access.log"}, nil)
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	recorder := httptest.NewRecorder()
+	NewAPI(m).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/alerts", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestAPIMetrics(t *testing.T) {
+	m, err := NewMonitor(nil, nil)
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	for _, text := range []string{"invalid", `127.0.0.1 - james [40/May/2018:16:00:39] "GET /report HTTP/1.0" 200 123`, "other"} {
+		m.processLine(context.Background(), logLine{source: "access.log", text: text})
+	}
+
+	recorder := httptest.NewRecorder()
+	NewAPI(m).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `httpmonitor_parse_errors_total{field="date"} 1`)
+	require.Contains(t, recorder.Body.String(), `httpmonitor_parse_errors_total{field="host"} 2`)
+}
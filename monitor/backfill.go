@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// backfillReader reads the lines of a backfilled file one by one, with their dates.
+type backfillReader struct {
+	source string
+	reader *bufio.Reader
+	closer io.Closer
+	// follower follows the file once it's backfilled, nil for the rotated files. The lines of a followed file have a
+	// position.
+	follower *fileFollower
+	id       fileID
+	offset   int64
+
+	// line is the next line, if ok. The lines which can't be parsed have the date of the previous line.
+	line string
+	date time.Time
+	ok   bool
+}
+
+// next reads the next line. The incomplete last line of a followed file is left to its follower.
+func (r *backfillReader) next() error {
+	data, err := r.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if data == "" || (err == io.EOF && r.follower != nil) {
+		r.ok = false
+		return nil
+	}
+
+	r.offset += int64(len(data))
+	r.line = strings.TrimRight(data, "\r\n")
+	if entry, err := NewLoggingEntry(r.line); err == nil {
+		r.date = entry.Date
+	}
+	r.ok = true
+
+	return nil
+}
+
+// backfillFiles sends the lines of the last "count" rotated files of the followed files, then of the followed files up
+// to their current end, in the order of their dates: the database rejects the entries more than an hour older than
+// the newest one, so the files can't be read one after the other. The followers continue after the backfilled lines.
+func backfillFiles(ctx context.Context, followers []*fileFollower, count int, lines chan<- logLine) error {
+	var readers []*backfillReader
+	defer func() {
+		for _, r := range readers {
+			r.closer.Close()
+		}
+	}()
+
+	for _, f := range followers {
+		rotated, err := rotatedFiles(f.path, count)
+		if err != nil {
+			return err
+		}
+		for _, path := range rotated {
+			file, err := openLogFile(path)
+			if err != nil {
+				return err
+			}
+			readers = append(readers, &backfillReader{source: f.path, reader: bufio.NewReaderSize(file, 64*1024), closer: file})
+		}
+
+		file, err := os.Open(f.path)
+		if os.IsNotExist(err) {
+			// The file is followed once it's created.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		readers = append(readers, &backfillReader{source: f.path, reader: bufio.NewReaderSize(file, 64*1024), closer: file, follower: f, id: getFileID(info)})
+	}
+
+	for _, r := range readers {
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// The oldest line first, the lines of the same date in the order of the files.
+		var oldest *backfillReader
+		for _, r := range readers {
+			if r.ok && (oldest == nil || r.date.Before(oldest.date)) {
+				oldest = r
+			}
+		}
+		if oldest == nil {
+			break
+		}
+
+		line := logLine{source: oldest.source, text: oldest.line}
+		if oldest.follower != nil {
+			line.position = Position{File: oldest.id, Offset: oldest.offset}
+		}
+		select {
+		case lines <- line:
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := oldest.next(); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range readers {
+		if r.follower != nil {
+			r.follower.start = &Position{File: r.id, Offset: r.offset}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfillFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, time.January, 1, 16, 0, 0, 0, time.UTC)
+	line := func(hours int) string {
+		return replayLines(start.Add(time.Duration(hours)*time.Hour), 1, 1)[0]
+	}
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	writeGzipFile(t, a+".1.gz", line(0)+"\n"+line(2)+"\n")
+	appendToFile(t, b+".1", line(1)+"\ninvalid\n")
+	appendToFile(t, a, line(3)+"\nincomplete")
+	appendToFile(t, b, line(4)+"\n")
+
+	lines := make(chan logLine, 10)
+	followers := []*fileFollower{{path: a, lines: lines}, {path: b, lines: lines}}
+	require.Nil(t, backfillFiles(context.Background(), followers, 1, lines))
+	close(lines)
+
+	var received []logLine
+	for line := range lines {
+		received = append(received, line)
+	}
+	require.Equal(t, []string{line(0), line(1), "invalid", line(2), line(3), line(4)}, texts(received))
+	require.Equal(t, []string{a, b, b, a, a, b}, []string{received[0].source, received[1].source, received[2].source, received[3].source, received[4].source, received[5].source})
+
+	// The rotated files have no position, the followers continue after the complete lines of the files.
+	require.Equal(t, Position{}, received[0].position)
+	require.Equal(t, int64(len(line(3))+1), received[4].position.Offset)
+	require.Equal(t, received[4].position, *followers[0].start)
+	require.Equal(t, received[5].position, *followers[1].start)
+}
+
+func TestMonitorBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	// The rotated file is more than an hour older than the lines of the other file.
+	now := time.Unix(time.Now().Unix(), 0)
+	appendToFile(t, filepath.Join(dir, "a.log.1"), strings.Join(replayLines(now.Add(-3*time.Hour), 60, 2), "\n")+"\n")
+	appendToFile(t, filepath.Join(dir, "a.log"), strings.Join(replayLines(now.Add(-2*time.Hour), 60, 1), "\n")+"\n")
+	appendToFile(t, filepath.Join(dir, "b.log"), strings.Join(replayLines(now.Add(-time.Minute), 60, 1), "\n")+"\n")
+
+	m, err := NewMonitor([]string{filepath.Join(dir, "*.log")}, nil, WithBackfill(1))
+	require.Nil(t, err, "Unexpected error raised")
+	go m.Run()
+	defer m.Stop()
+
+	count := func() float64 {
+		entries, err := m.db.GetEntries(HostLabel, AllEntriesPattern, now.Add(-4*time.Hour).Unix(), now.Unix())
+		require.Nil(t, err, "Unexpected error raised")
+		hits := 0.0
+		for _, entry := range entries {
+			hits += entry.Value
+		}
+		return hits
+	}
+	for deadline := time.Now().Add(5 * time.Second); count() < 240 && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.Equal(t, 240.0, count(), "All the backfilled lines should be stored")
+}
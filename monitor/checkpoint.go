@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileID identifies a file independently of its name, so the renamed files can be recognized.
+type fileID struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+}
+
+// Position is how far a file was read.
+type Position struct {
+	File   fileID `json:"file"`
+	Offset int64  `json:"offset"`
+}
+
+// Checkpoint stores the read position of each source, so the monitoring resumes where it stopped after a restart.
+type Checkpoint struct {
+	path string
+
+	mu        sync.Mutex
+	positions map[string]Position
+}
+
+// LoadCheckpoint reads the positions saved in a checkpoint file. A missing file is treated as an empty checkpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{path: path, positions: make(map[string]Position)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.positions); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Get returns the position saved for a source.
+func (c *Checkpoint) Get(source string) (Position, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	position, ok := c.positions[source]
+	return position, ok
+}
+
+// Update records the position of a source. The position is persisted by the next Save.
+func (c *Checkpoint) Update(source string, position Position) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.positions[source] = position
+}
+
+// Save writes the positions to the checkpoint file. The file is replaced atomically.
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.positions, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.path, data)
+}
+
+// writeFileAtomic replaces a file by writing the data into a temporary file, renamed once synced.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,281 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// clfDateLayout is the format of the dates in the common and combined formats.
+const clfDateLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Indexes of the fields of a line, as the submatches of lineRegex.
+const (
+	fieldHost = iota + 1
+	fieldLogName
+	fieldUser
+	fieldDate
+	fieldRequest
+	fieldStatus
+	fieldBytes
+	fieldReferer
+	fieldUserAgent
+	lineFieldCount
+)
+
+// lineFields holds the raw fields of a line, like the submatches of lineRegex. The missing fields are empty.
+type lineFields [lineFieldCount]string
+
+// splitLine splits a line into its fields exactly like lineRegex, but without allocating.
+// The lines containing other whitespaces than spaces are rare, they are split by lineRegex.
+func splitLine(raw string, fields *lineFields) bool {
+	if strings.ContainsAny(raw, "\t\n\f\r") {
+		return splitLineRegexp(raw, fields)
+	}
+
+	fields[0] = raw
+	space := strings.IndexByte(raw, ' ')
+	if space <= 0 {
+		return false
+	}
+	fields[fieldHost], raw = raw[:space], raw[space+1:]
+
+	var ok bool
+	if fields[fieldLogName], raw, ok = cutSpace(raw); !ok {
+		return false
+	}
+	if fields[fieldUser], raw, ok = cutSpace(raw); !ok {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(raw, "- "):
+		fields[fieldDate], raw = "", raw[2:]
+	case strings.HasPrefix(raw, "["):
+		end := strings.IndexByte(raw, ']')
+		if end < 0 || end+1 == len(raw) || raw[end+1] != ' ' {
+			return false
+		}
+		fields[fieldDate], raw = raw[1:end], raw[end+2:]
+	default:
+		return false
+	}
+
+	if strings.HasPrefix(raw, "-") {
+		fields[fieldRequest] = ""
+		return splitLineEnd(raw[1:], fields)
+	}
+	if !strings.HasPrefix(raw, `"`) {
+		return false
+	}
+
+	// The request may contain quotes: like the greedy regular expression, it ends at the last quote followed by a
+	// valid end of line.
+	raw = raw[1:]
+	for quote := strings.LastIndexByte(raw, '"'); quote >= 0; quote = strings.LastIndexByte(raw[:quote], '"') {
+		if splitLineEnd(raw[quote+1:], fields) {
+			fields[fieldRequest] = raw[:quote]
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitLineEnd splits what follows the request: ` STATUS BYTES` or ` STATUS BYTES "REFERER" "USER AGENT"`.
+func splitLineEnd(raw string, fields *lineFields) bool {
+	if !strings.HasPrefix(raw, " ") {
+		return false
+	}
+	raw = raw[1:]
+
+	switch {
+	case strings.HasPrefix(raw, "- "):
+		fields[fieldStatus], raw = missingData, raw[2:]
+	case len(raw) > 3 && isDigits(raw[:3]) && raw[3] == ' ':
+		fields[fieldStatus], raw = raw[:3], raw[4:]
+	default:
+		return false
+	}
+
+	size := 1
+	if !strings.HasPrefix(raw, missingData) {
+		size = 0
+		for size < len(raw) && isDigit(raw[size]) {
+			size++
+		}
+		if size == 0 {
+			return false
+		}
+	}
+	fields[fieldBytes], raw = raw[:size], raw[size:]
+
+	if raw == "" {
+		fields[fieldReferer], fields[fieldUserAgent] = "", ""
+		return true
+	}
+
+	var ok bool
+	if fields[fieldReferer], raw, ok = cutQuoted(raw); !ok {
+		return false
+	}
+	if fields[fieldUserAgent], raw, ok = cutQuoted(raw); !ok {
+		return false
+	}
+
+	return raw == ""
+}
+
+// splitLineRegexp splits a line into its fields with lineRegex.
+func splitLineRegexp(raw string, fields *lineFields) bool {
+	submatches := lineRegex.FindStringSubmatch(raw)
+	if len(submatches) != len(fields) {
+		return false
+	}
+
+	copy(fields[:], submatches)
+	return true
+}
+
+// cutSpace splits a string around its first space.
+func cutSpace(s string) (string, string, bool) {
+	space := strings.IndexByte(s, ' ')
+	if space < 0 {
+		return "", "", false
+	}
+
+	return s[:space], s[space+1:], true
+}
+
+// cutQuoted splits a string beginning with ` "QUOTED"` after the closing quote. The quoted string can't contain quotes.
+func cutQuoted(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, ` "`) {
+		return "", "", false
+	}
+	s = s[2:]
+
+	end := strings.IndexByte(s, '"')
+	if end < 0 {
+		return "", "", false
+	}
+
+	return s[:end], s[end+1:], true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// atoiDigits converts a string of digits, which can't overflow.
+func atoiDigits(s string) (int, bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+
+	return n, true
+}
+
+var shortMonthNames = [...]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// parseCLFDate parses the usual dates of the lines (e.g "09/May/2018:16:00:39 +0000") without allocating. The result
+// is the same as time.Parse with clfDateLayout. The dates which aren't exactly in this format are rejected, even if
+// time.Parse accepts them (e.g "09/may/2018:16:00:39 +0000").
+func parseCLFDate(s string) (time.Time, bool) {
+	if len(s) != len(clfDateLayout) || s[2] != '/' || s[6] != '/' || s[11] != ':' || s[14] != ':' || s[17] != ':' ||
+		s[20] != ' ' || (s[21] != '+' && s[21] != '-') {
+		return time.Time{}, false
+	}
+
+	month := 0
+	for i, name := range shortMonthNames {
+		if s[3:6] == name {
+			month = i + 1
+			break
+		}
+	}
+	if month == 0 {
+		return time.Time{}, false
+	}
+
+	day, okDay := atoiDigits(s[0:2])
+	year, okYear := atoiDigits(s[7:11])
+	hour, okHour := atoiDigits(s[12:14])
+	minute, okMinute := atoiDigits(s[15:17])
+	second, okSecond := atoiDigits(s[18:20])
+	offsetHours, okOffsetHours := atoiDigits(s[22:24])
+	offsetMinutes, okOffsetMinutes := atoiDigits(s[24:26])
+	if !okDay || !okYear || !okHour || !okMinute || !okSecond || !okOffsetHours || !okOffsetMinutes {
+		return time.Time{}, false
+	}
+	if day < 1 || day > daysIn(time.Month(month), year) || hour > 23 || minute > 59 || second > 59 ||
+		offsetHours > 23 || offsetMinutes > 59 {
+		return time.Time{}, false
+	}
+
+	offset := (offsetHours*60 + offsetMinutes) * 60
+	if s[21] == '-' {
+		offset = -offset
+	}
+
+	// Like time.Parse, use the local zone if it has the same offset at this date.
+	date := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC).Add(-time.Duration(offset) * time.Second)
+	if _, localOffset := date.In(time.Local).Zone(); localOffset == offset {
+		return date.In(time.Local), true
+	}
+
+	return date.In(fixedZone(offset)), true
+}
+
+// daysIn returns the number of days of a month.
+func daysIn(month time.Month, year int) int {
+	switch month {
+	case time.February:
+		if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			return 29
+		}
+		return 28
+	case time.April, time.June, time.September, time.November:
+		return 30
+	default:
+		return 31
+	}
+}
+
+var (
+	fixedZonesMu sync.RWMutex
+	fixedZones   = make(map[int]*time.Location)
+)
+
+// fixedZone returns an unnamed zone with a fixed offset, like the ones created by time.Parse. The zones are shared.
+func fixedZone(offset int) *time.Location {
+	fixedZonesMu.RLock()
+	zone, ok := fixedZones[offset]
+	fixedZonesMu.RUnlock()
+	if ok {
+		return zone
+	}
+
+	fixedZonesMu.Lock()
+	defer fixedZonesMu.Unlock()
+	if zone, ok := fixedZones[offset]; ok {
+		return zone
+	}
+	zone = time.FixedZone("", offset)
+	fixedZones[offset] = zone
+
+	return zone
+}
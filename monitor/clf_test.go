@@ -0,0 +1,232 @@
+package monitor
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	commonLine   = `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`
+	combinedLine = `127.0.0.1 - james [09/May/2018:16:00:39 -0700] "GET /report HTTP/1.0" 200 123 "http://example.com/" "Mozilla/5.0 (X11; Linux x86_64)"`
+)
+
+// parseLoggingEntryRegexp is the reference parser: the regular expression, time.Parse and strings.Split.
+func parseLoggingEntryRegexp(raw string) (*LoggingEntry, error) {
+	entries := lineRegex.FindStringSubmatch(raw)
+	if len(entries) != 10 {
+		return nil, formatError(raw)
+	}
+
+	var err error
+	var date time.Time
+	if entries[4] != missingData {
+		date, err = time.Parse("02/Jan/2006:15:04:05 -0700", entries[4])
+		if err != nil {
+			date, err = dateparse.ParseAny(entries[4])
+			if err != nil {
+				return nil, &ParseError{Line: raw, Field: FieldDate, Reason: err.Error()}
+			}
+		}
+	}
+
+	parts := strings.Split(entries[5], " ")
+	if len(parts) != 3 {
+		return nil, &ParseError{Line: raw, Field: FieldRequest, Reason: fmt.Sprintf("%q isn't \"METHOD URL PROTOCOL\"", entries[5])}
+	}
+
+	var status int
+	if entries[6] != missingData {
+		status, err = strconv.Atoi(entries[6])
+		if err != nil {
+			return nil, &ParseError{Line: raw, Field: FieldStatus, Reason: err.Error()}
+		}
+	}
+
+	var bytes int
+	if entries[7] != missingData {
+		bytes, err = strconv.Atoi(entries[7])
+		if err != nil {
+			return nil, &ParseError{Line: raw, Field: FieldBytes, Reason: err.Error()}
+		}
+	}
+
+	return &LoggingEntry{
+		RemoteHost:    entries[1],
+		RemoteLogname: entries[2],
+		AuthUser:      entries[3],
+		Date:          date,
+		Request:       &Request{Method: parts[0], URL: parts[1], Protocol: parts[2]},
+		Status:        status,
+		Bytes:         bytes,
+		Referer:       entries[8],
+		UserAgent:     entries[9],
+	}, nil
+}
+
+// randomDate generates dates close to clfDateLayout, valid or not.
+func randomDate(r *rand.Rand) string {
+	months := append(shortMonthNames[:], "may", "Foo")
+	signs := []string{"+", "-", "+", "-", "Z", " "}
+
+	return fmt.Sprintf("%02d/%s/%04d:%02d:%02d:%02d %s%02d%02d",
+		r.Intn(32), months[r.Intn(len(months))], 1900+r.Intn(300), r.Intn(25), r.Intn(61), r.Intn(61),
+		signs[r.Intn(len(signs))], r.Intn(26), []int{0, 0, 0, 30, 45, 60, r.Intn(100)}[r.Intn(7)])
+}
+
+// randomLine generates lines in the common or combined format, with some invalid or unusual fields.
+func randomLine(r *rand.Rand) string {
+	pick := func(values ...string) string {
+		return values[r.Intn(len(values))]
+	}
+	// Most fields are valid, so most lines are.
+	pickValid := func(valid string, values ...string) string {
+		if r.Intn(10) > 0 {
+			return valid
+		}
+		return pick(values...)
+	}
+
+	zone := time.FixedZone("", (r.Intn(49)-24)*30*60)
+
+	fields := []string{
+		pickValid(pick("127.0.0.1", "::1", "host"), "", "h\xffst", "é"),
+		pickValid(pick("-", "logname"), ""),
+		pickValid(pick("-", "james"), "", "a\tb"),
+		pickValid("["+pick(randomDate(r), time.Unix(r.Int63n(1<<32), 0).In(zone).Format(clfDateLayout))+"]", "[09/May/2018:16:00:39 +0000]", "[09 May 2018 16:00 +0000]", "-", "[-]", "[]",
+			"[09/May/2018:16:00:39 +0000", "[a]b]"),
+		pickValid(pick(`"GET /report HTTP/1.0"`, `"POST /a?b=c HTTP/1.1"`), "-", `""`, `"GET /report"`, `"GET /a b HTTP/1.1"`,
+			`"GET /" 200 1 " HTTP/1.0"`, `"GET /a\"b HTTP/1.0"`, `"GET / HTTP/1.0`, `"\xff \xfe \xfd"`),
+		pickValid(pick("200", "404"), "-", "20", "2000", "abc", ""),
+		pickValid(pick("123", "0"), "-", "", "12a", "99999999999999999999999"),
+	}
+	line := strings.Join(fields, " ")
+	line += pickValid(pick("", ` "-" "-"`, ` "http://example.com/" "curl/7.64.1"`, ` "" ""`), ` "a"b" "c"`, ` "a" "b`, ` "a"`,
+		` "http://x/" "agent" 200 1`, " ")
+
+	// Perturb a few lines: duplicated or replaced separators, truncated ends.
+	switch r.Intn(10) {
+	case 0:
+		i := r.Intn(len(line) + 1)
+		line = line[:i] + pick(" ", "\t", `"`, "-", "]", "[", "\r\n") + line[i:]
+	case 1:
+		line = line[:r.Intn(len(line)+1)]
+	}
+
+	return line
+}
+
+func TestSplitLine(t *testing.T) {
+	var fields lineFields
+	require.True(t, splitLine(combinedLine, &fields), "Unexpected invalid line")
+	require.Equal(t, lineFields{combinedLine, "127.0.0.1", "-", "james", "09/May/2018:16:00:39 -0700", "GET /report HTTP/1.0", "200", "123", "http://example.com/", "Mozilla/5.0 (X11; Linux x86_64)"}, fields, "Unexpected fields")
+
+	// Like the regular expression, the request ends at the last quote followed by a valid end of line.
+	line := `127.0.0.1 - - - "GET /" 200 1 " HTTP/1.0" 200 123 "-" "curl"`
+	require.True(t, splitLine(line, &fields), "Unexpected invalid line")
+	require.Equal(t, `GET /" 200 1 " HTTP/1.0`, fields[fieldRequest], "Unexpected request")
+	require.Equal(t, "", fields[fieldDate], "Unexpected date")
+
+	require.False(t, splitLine(`127.0.0.1 - - - "GET / HTTP/1.0" 200 123 "-"`, &fields), "Unexpected valid line")
+}
+
+func TestParseCLFDate(t *testing.T) {
+	locals := []*time.Location{time.UTC, time.FixedZone("", 2*60*60), time.FixedZone("IST", 5*60*60+30*60)}
+	if paris, err := time.LoadLocation("Europe/Paris"); err == nil {
+		locals = append(locals, paris)
+	}
+
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	r := rand.New(rand.NewSource(1))
+	for _, local := range locals {
+		time.Local = local
+		for i := 0; i < 20000; i++ {
+			raw := randomDate(r)
+			expected, err := time.Parse(clfDateLayout, raw)
+
+			date, ok := parseCLFDate(raw)
+			if !ok {
+				continue
+			}
+			require.Nil(t, err, "Unexpected date parsed: %q", raw)
+			require.Equal(t, expected, date, "Unexpected date for %q in %s", raw, local)
+		}
+
+		date, ok := parseCLFDate("09/May/2018:16:00:39 +0000")
+		require.True(t, ok, "Unexpected invalid date")
+		expected, err := time.Parse(clfDateLayout, "09/May/2018:16:00:39 +0000")
+		require.Nil(t, err, "Unexpected error raised")
+		require.Equal(t, expected, date, "Unexpected date in %s", local)
+	}
+}
+
+func TestParseLoggingEntryDifferential(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	r := rand.New(rand.NewSource(1))
+	reused := &LoggingEntry{}
+
+	for _, local := range []*time.Location{time.UTC, time.FixedZone("", -7*60*60)} {
+		time.Local = local
+		for i := 0; i < 50000; i++ {
+			line := randomLine(r)
+			expected, expectedErr := parseLoggingEntryRegexp(line)
+
+			entry, err := NewLoggingEntry(line)
+			require.Equal(t, expected, entry, "Unexpected entry for %q", line)
+			require.Equal(t, fmt.Sprint(expectedErr), fmt.Sprint(err), "Unexpected error for %q", line)
+			require.Equal(t, expectedErr, err, "Unexpected error for %q", line)
+
+			err = ParseLoggingEntry(line, reused)
+			require.Equal(t, fmt.Sprint(expectedErr), fmt.Sprint(err), "Unexpected error for %q", line)
+			if err == nil {
+				require.Equal(t, expected, reused, "Unexpected reused entry for %q", line)
+			}
+		}
+	}
+}
+
+func TestParseLoggingEntryAllocations(t *testing.T) {
+	entry := &LoggingEntry{}
+	for _, line := range []string{commonLine, combinedLine} {
+		var err error
+		allocs := testing.AllocsPerRun(100, func() {
+			err = ParseLoggingEntry(line, entry)
+		})
+		require.Nil(t, err, "Unexpected error raised")
+		require.Equal(t, 0.0, allocs, "Unexpected allocations for %q", line)
+	}
+}
+
+func BenchmarkParseLoggingEntry(b *testing.B) {
+	for _, line := range []struct {
+		name string
+		raw  string
+	}{{"common", commonLine}, {"combined", combinedLine}} {
+		line := line
+		b.Run(line.name+"/regexp", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				parseLoggingEntryRegexp(line.raw)
+			}
+		})
+		b.Run(line.name+"/new", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				NewLoggingEntry(line.raw)
+			}
+		})
+		b.Run(line.name+"/reused", func(b *testing.B) {
+			b.ReportAllocs()
+			entry := &LoggingEntry{}
+			for i := 0; i < b.N; i++ {
+				ParseLoggingEntry(line.raw, entry)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressedReader closes both the decompressor and the underlying file.
+type compressedReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (r *compressedReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// openLogFile opens a file for reading. The gzip and zstd files are decompressed transparently, based on their content.
+func openLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(f)
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &compressedReader{Reader: gz, closers: []func() error{gz.Close, f.Close}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &compressedReader{Reader: zr, closers: []func() error{func() error { zr.Close(); return nil }, f.Close}}, nil
+	default:
+		return &compressedReader{Reader: buffered, closers: []func() error{f.Close}}, nil
+	}
+}
+
+// readLogFile sends all the lines of a (possibly compressed) file, labeled with the given source.
+func readLogFile(ctx context.Context, path string, source string, lines chan<- logLine) error {
+	r, err := openLogFile(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return readLogLines(ctx, r, source, lines)
+}
+
+// readLogLines sends all the lines from a reader, until its end or until the context is done.
+func readLogLines(ctx context.Context, r io.Reader, source string, lines chan<- logLine) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		data, err := reader.ReadString('\n')
+		if data != "" {
+			select {
+			case lines <- logLine{source: source, text: strings.TrimRight(data, "\r\n")}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rotatedFile is a rotated version of a logging file (e.g "access.log.2.gz").
+type rotatedFile struct {
+	path  string
+	index int
+	info  os.FileInfo
+}
+
+// rotationIndex extracts the number of a rotated file (e.g 2 for "access.log.2.gz"), or -1 if there is none.
+func rotationIndex(path string, rotated string) int {
+	suffix := strings.TrimPrefix(rotated, path+".")
+	for _, ext := range []string{".gz", ".zst"} {
+		suffix = strings.TrimSuffix(suffix, ext)
+	}
+
+	index, err := strconv.Atoi(suffix)
+	if err != nil {
+		return -1
+	}
+
+	return index
+}
+
+// rotatedFiles returns the last "count" rotated versions of a file, from the oldest to the newest.
+// Both numbered ("access.log.1", "access.log.2.gz") and dated ("access.log-20200101.gz") files are recognized. The
+// numbered files are ordered by their number, the other ones by their modification time, then by name. When both
+// kinds are found, the dated files come before the numbered ones: "access.log.1" is always the newest rotated file.
+func rotatedFiles(path string, count int) ([]string, error) {
+	var candidates []string
+	for _, pattern := range []string{path + ".*", path + "-*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, matches...)
+	}
+
+	var numbered, dated []rotatedFile
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		file := rotatedFile{path: candidate, index: rotationIndex(path, candidate), info: info}
+		if file.index >= 0 {
+			numbered = append(numbered, file)
+		} else {
+			dated = append(dated, file)
+		}
+	}
+
+	// A bigger number means an older file.
+	sort.Slice(numbered, func(i, j int) bool {
+		return numbered[i].index > numbered[j].index
+	})
+	sort.Slice(dated, func(i, j int) bool {
+		if mi, mj := dated[i].info.ModTime(), dated[j].info.ModTime(); !mi.Equal(mj) {
+			return mi.Before(mj)
+		}
+		return dated[i].path < dated[j].path
+	})
+	files := append(dated, numbered...)
+
+	if count < len(files) {
+		files = files[len(files)-count:]
+	}
+
+	result := make([]string, 0, len(files))
+	for _, f := range files {
+		result = append(result, f.path)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGzipFile(t *testing.T, path string, data string) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(data))
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, w.Close())
+	require.Nil(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func writeZstdFile(t *testing.T, path string, data string) {
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	require.Nil(t, err, "Unexpected error raised")
+	_, err = w.Write([]byte(data))
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, w.Close())
+	require.Nil(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestOpenLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	plain := filepath.Join(dir, "access.log.1")
+	require.Nil(t, ioutil.WriteFile(plain, []byte("plain\n"), 0644))
+	// The format is detected from the content, not from the name.
+	gz := filepath.Join(dir, "access.log.2")
+	writeGzipFile(t, gz, "gzip\n")
+	zst := filepath.Join(dir, "access.log.3.zst")
+	writeZstdFile(t, zst, "zstd\n")
+
+	for path, expected := range map[string]string{plain: "plain\n", gz: "gzip\n", zst: "zstd\n"} {
+		r, err := openLogFile(path)
+		require.Nil(t, err, "Unexpected error raised")
+		data, err := ioutil.ReadAll(r)
+		require.Nil(t, err, "Unexpected error raised")
+		require.Nil(t, r.Close())
+		require.Equal(t, expected, string(data))
+	}
+}
+
+func TestReadLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log.1.gz")
+	// The last line is complete even without a newline.
+	writeGzipFile(t, path, "first\r\nsecond\nthird")
+
+	lines := make(chan logLine, 3)
+	require.Nil(t, readLogFile(context.Background(), path, "access.log", lines))
+	close(lines)
+
+	var received []logLine
+	for line := range lines {
+		require.Equal(t, "access.log", line.source)
+		require.Equal(t, Position{}, line.position)
+		received = append(received, line)
+	}
+	require.Equal(t, []string{"first", "second", "third"}, texts(received))
+}
+
+func TestRotatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2.gz", "access.log.10.gz", "other.log.1"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	files, err := rotatedFiles(path, 2)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{path + ".2.gz", path + ".1"}, files)
+
+	files, err = rotatedFiles(path, 5)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{path + ".10.gz", path + ".2.gz", path + ".1"}, files)
+}
+
+func TestRotatedFilesByDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	now := time.Now()
+	// The names don't sort like the dates, the modification times decide.
+	for i, name := range []string{"access.log-b.gz", "access.log-a.gz", "access.log-c"} {
+		file := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(file, nil, 0644))
+		modTime := now.Add(time.Duration(i-3) * time.Hour)
+		require.Nil(t, os.Chtimes(file, modTime, modTime))
+	}
+
+	files, err := rotatedFiles(path, 10)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{path + "-b.gz", path + "-a.gz", path + "-c"}, files)
+}
+
+func TestRotatedFilesMixed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	now := time.Now()
+	// The dated files come first whatever their modification times, those of the same time are ordered by name.
+	for i, name := range []string{"access.log.2.gz", "access.log-b", "access.log.1", "access.log-a", "access.log-c.gz"} {
+		file := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(file, nil, 0644))
+		modTime := now.Add(time.Duration(i-3) * time.Hour)
+		if name == "access.log-a" {
+			modTime = now.Add(-2 * time.Hour)
+		}
+		require.Nil(t, os.Chtimes(file, modTime, modTime))
+	}
+
+	files, err := rotatedFiles(path, 10)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{path + "-a", path + "-b", path + "-c.gz", path + ".2.gz", path + ".1"}, files)
+
+	files, err = rotatedFiles(path, 3)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{path + "-c.gz", path + ".2.gz", path + ".1"}, files)
+}
+
+func TestFileFollowerBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	writeGzipFile(t, path+".3.gz", "ignored\n")
+	writeZstdFile(t, path+".2.zst", "oldest\n")
+	writeGzipFile(t, path+".1.gz", "older\n")
+	appendToFile(t, path, "live\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan logLine)
+	done := make(chan error)
+	go func() {
+		done <- followFiles(ctx, []string{path}, nil, 2, lines)
+	}()
+
+	received := receiveLines(t, lines, 3)
+	require.Equal(t, []string{"oldest", "older", "live"}, texts(received))
+	for _, line := range received {
+		require.Equal(t, path, line.source)
+	}
+	require.Equal(t, Position{}, received[0].position)
+	require.NotEqual(t, Position{}, received[2].position)
+
+	// The live file is followed after the backfill.
+	appendToFile(t, path, "appended\n")
+	received = receiveLines(t, lines, 1)
+	require.Equal(t, []string{"appended"}, texts(received))
+
+	cancel()
+	require.Nil(t, <-done)
+}
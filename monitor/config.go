@@ -0,0 +1,233 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration is a time.Duration that can be decoded from strings like "30s" or "2m".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON formats the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// AlertRule describes an alert in a configuration file.
+type AlertRule struct {
+	Name             string   `json:"name"`
+	CheckingInterval Duration `json:"checking_interval"`
+	DataInterval     Duration `json:"data_interval"`
+	Threshold        float64  `json:"threshold"`
+	Label            string   `json:"label"`
+	Pattern          string   `json:"pattern"`
+	// Matchers further restrict the entries of the alert, e.g `status=~"5.."` or `host!=127.0.0.1`.
+	Matchers []string `json:"matchers"`
+	// Aggregation is AggregationAverage (the default), AggregationPeak, AggregationSustained or AggregationDistinct.
+	Aggregation string `json:"aggregation"`
+	// Step is the step of the peak and sustained aggregations, DefaultAlertStep if it's not set.
+	Step Duration `json:"step"`
+	// Labels are attached to the alert's events.
+	Labels map[string]string `json:"labels"`
+	// Message is a template rendering the alert's message. It receives an AlertEvent.
+	Message string `json:"message"`
+}
+
+// Validate checks that the rule has all the fields needed to build an alert.
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("alert rule without name")
+	}
+	if r.CheckingInterval <= 0 {
+		return fmt.Errorf("alert rule %q: checking_interval must be positive", r.Name)
+	}
+	if r.DataInterval <= 0 {
+		return fmt.Errorf("alert rule %q: data_interval must be positive", r.Name)
+	}
+	if r.Label == "" {
+		return fmt.Errorf("alert rule %q: label is required", r.Name)
+	}
+	if _, err := r.matchers(); err != nil {
+		return fmt.Errorf("alert rule %q: %w", r.Name, err)
+	}
+	switch r.Aggregation {
+	case "", AggregationAverage:
+		if r.Step != 0 {
+			return fmt.Errorf("alert rule %q: step is only used by the %s and %s aggregations", r.Name, AggregationPeak, AggregationSustained)
+		}
+	case AggregationDistinct:
+		if r.Step != 0 {
+			return fmt.Errorf("alert rule %q: step is only used by the %s and %s aggregations", r.Name, AggregationPeak, AggregationSustained)
+		}
+		if (r.Pattern != "" && r.Pattern != AllEntriesPattern) || len(r.Matchers) > 0 {
+			return fmt.Errorf("alert rule %q: the %s aggregation counts all the values of the label, without pattern nor matchers", r.Name, AggregationDistinct)
+		}
+	case AggregationPeak, AggregationSustained:
+		if r.Step < 0 || (r.Step > 0 && r.Step < Duration(time.Second)) {
+			return fmt.Errorf("alert rule %q: step must be at least 1s", r.Name)
+		}
+		if time.Duration(r.Step) > time.Duration(r.DataInterval) {
+			return fmt.Errorf("alert rule %q: step must not be longer than data_interval", r.Name)
+		}
+	default:
+		return fmt.Errorf("alert rule %q: unknown aggregation %q", r.Name, r.Aggregation)
+	}
+	if r.Message != "" {
+		if _, err := NewTemplate(r.Name, r.Message); err != nil {
+			return fmt.Errorf("alert rule %q: %w", r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Alert creates a new alert from the rule.
+func (r *AlertRule) Alert() (*Alert, error) {
+	pattern := r.Pattern
+	if pattern == "" {
+		pattern = AllEntriesPattern
+	}
+
+	matchers, err := r.matchers()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []AlertOption{WithLabels(r.Labels)}
+	if len(matchers) > 0 {
+		opts = append(opts, WithMatchers(matchers...))
+	}
+	if r.Aggregation != "" {
+		opts = append(opts, WithAggregation(r.Aggregation, time.Duration(r.Step)))
+	}
+	if r.Message != "" {
+		tmpl, err := NewTemplate(r.Name, r.Message)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMessage(tmpl))
+	}
+
+	return NewAlert(r.Name, time.Duration(r.CheckingInterval), time.Duration(r.DataInterval), r.Threshold, r.Label, pattern, opts...), nil
+}
+
+// matchers parses and checks the matchers of the rule.
+func (r *AlertRule) matchers() ([]Matcher, error) {
+	var matchers []Matcher
+	for _, s := range r.Matchers {
+		m, err := ParseMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	return matchers, nil
+}
+
+// Config holds the settings loaded from a configuration file.
+type Config struct {
+	Rules     []AlertRule      `json:"rules"`
+	Notifiers []NotifierConfig `json:"notifiers"`
+	// Group enables the grouping of the alert events before they are sent to the notifiers.
+	Group *GroupConfig `json:"group"`
+	// InhibitRules mute the notifications of some alerts while other alerts are firing.
+	InhibitRules []InhibitRule `json:"inhibit_rules"`
+}
+
+// LoadConfig reads and validates a JSON configuration file.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config Config
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("invalid config %s: duplicated alert rule %q", path, rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	for i := range config.Notifiers {
+		if err := config.Notifiers[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+
+	if config.Group != nil {
+		if err := config.Group.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+
+	for i := range config.InhibitRules {
+		if err := config.InhibitRules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// Alerts creates the alerts described by the configuration.
+func (c *Config) Alerts() ([]*Alert, error) {
+	alerts := make([]*Alert, 0, len(c.Rules))
+	for i := range c.Rules {
+		alert, err := c.Rules[i].Alert()
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
+
+// NewNotifiers creates the notifiers described by the configuration. The notifiers which are io.Closer must be closed,
+// Monitor.Stop closes the notifiers of the monitor.
+func (c *Config) NewNotifiers() ([]Notifier, error) {
+	result := make([]Notifier, 0, len(c.Notifiers))
+	for i := range c.Notifiers {
+		notifier, err := c.Notifiers[i].Notifier()
+		if err != nil {
+			closeNotifiers(result)
+			return nil, err
+		}
+		result = append(result, notifier)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "config")
+	require.Nil(t, err, "Unexpected error raised")
+	defer f.Close()
+
+	_, err = f.WriteString(content)
+	require.Nil(t, err, "Unexpected error raised")
+
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5s", "data_interval": "2m", "threshold": 10, "label": "host"}]}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.Nil(t, err, "Unexpected error raised")
+
+	expectedRules := []AlertRule{
+		{Name: "test", CheckingInterval: Duration(5 * time.Second), DataInterval: Duration(2 * time.Minute), Threshold: 10, Label: HostLabel},
+	}
+	require.Equal(t, expectedRules, config.Rules)
+
+	alerts, err := config.Alerts()
+	require.Nil(t, err, "Unexpected error raised")
+	require.Len(t, alerts, 1)
+	require.Equal(t, NewAlert("test", 5*time.Second, 2*time.Minute, 10, HostLabel, AllEntriesPattern), alerts[0])
+}
+
+func TestLoadConfigInvalidRule(t *testing.T) {
+	path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5s", "data_interval": "2m", "threshold": 10}]}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.Nil(t, config, "Unexpected config")
+	require.NotNil(t, err, "An error should be raised for a rule without label")
+}
+
+func TestLoadConfigDuplicatedRule(t *testing.T) {
+	rule := `{"name": "test", "checking_interval": "5s", "data_interval": "2m", "threshold": 10, "label": "host"}`
+	path := writeConfig(t, `{"rules": [`+rule+`, `+rule+`]}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.Nil(t, config, "Unexpected config")
+	require.NotNil(t, err, "An error should be raised for duplicated rules")
+}
+
+func TestLoadConfigInvalidDuration(t *testing.T) {
+	path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5 seconds", "data_interval": "2m", "label": "host"}]}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.Nil(t, config, "Unexpected config")
+	require.NotNil(t, err, "An error should be raised for invalid durations")
+}
+
+func TestLoadConfigAggregation(t *testing.T) {
+	path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5s", "data_interval": "2m", "threshold": 10, "label": "host", "aggregation": "sustained", "step": "30s"}]}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.Nil(t, err, "Unexpected error raised")
+	alerts, err := config.Alerts()
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, NewAlert("test", 5*time.Second, 2*time.Minute, 10, HostLabel, AllEntriesPattern, WithAggregation(AggregationSustained, 30*time.Second)), alerts[0])
+
+	for _, rule := range []string{
+		`"aggregation": "median"`,
+		`"aggregation": "peak", "step": "500ms"`,
+		`"aggregation": "peak", "step": "5m"`,
+		`"step": "30s"`,
+		`"aggregation": "distinct", "step": "30s"`,
+		`"aggregation": "distinct", "pattern": "^10\\."`,
+		`"aggregation": "distinct", "matchers": ["status=500"]`,
+	} {
+		path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5s", "data_interval": "2m", "label": "host", `+rule+`}]}`)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.NotNil(t, err, "An error should be raised for %s", rule)
+	}
+}
+
+func TestLoadConfigMatchers(t *testing.T) {
+	path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5s", "data_interval": "2m", "threshold": 10, "label": "section", "matchers": ["status=~\"5..\"", "host!=127.0.0.1"]}]}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.Nil(t, err, "Unexpected error raised")
+	alerts, err := config.Alerts()
+	require.Nil(t, err, "Unexpected error raised")
+	matchers := []Matcher{{StatusLabel, MatchRegexp, "5.."}, {HostLabel, MatchNotEqual, "127.0.0.1"}}
+	require.Equal(t, NewAlert("test", 5*time.Second, 2*time.Minute, 10, RequestURLSectionLabel, AllEntriesPattern, WithMatchers(matchers...)), alerts[0])
+
+	for _, matcher := range []string{`status`, `status=~\"(\"`, `status=500,host=a`} {
+		path := writeConfig(t, `{"rules": [{"name": "test", "checking_interval": "5s", "data_interval": "2m", "label": "host", "matchers": ["`+matcher+`"]}]}`)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.NotNil(t, err, "An error should be raised for %s", matcher)
+	}
+}
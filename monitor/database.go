@@ -2,8 +2,11 @@ package monitor
 
 import (
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/prometheus/tsdb"
@@ -40,115 +43,724 @@ func mapToEntryList(m map[string]float64) EntryList {
 	return p
 }
 
-// LoggingDatabase is used to store logging entries into a timeseries format.
+// distinctFile is the file of the database directory where the distinct counts are saved.
+const distinctFile = "distinct.json"
+
+// DefaultRetention is the default duration the entries are kept.
+const DefaultRetention = 24 * time.Hour
+
+const (
+	// minBlockRange is the duration of the smallest blocks. The entries more than half of it older than the newest
+	// ones can't be added anymore.
+	minBlockRange = 2 * time.Hour
+	// maxBlockRange is the duration of the biggest blocks.
+	maxBlockRange = 31 * 24 * time.Hour
+)
+
+// DatabaseConfig configures where and how long the entries are stored.
+type DatabaseConfig struct {
+	// Storage is StorageTSDB (the default) or StorageMemory. The memory storage has no directory nor size limit.
+	Storage string
+	// Dir is the directory of the database. The database is reopened if it already exists. A temporary directory is
+	// used if it's empty.
+	Dir string
+	// Retention is how long the entries are kept, before the newest one. DefaultRetention is used if it's not
+	// positive.
+	Retention time.Duration
+	// MaxBytes limits the size of the stored blocks, the oldest ones are deleted first. The size isn't limited if it's
+	// not positive.
+	MaxBytes int64
+	// Labels configures the stored labels.
+	Labels LabelConfig
+	// RollupRetention is how long the hits and the bytes of each series are kept by minute and by hour, to answer the
+	// queries on long ranges after the raw samples are deleted. It should be longer than the retention. There are no
+	// rollups if it's not positive.
+	RollupRetention time.Duration
+}
+
+// blockRanges returns the durations of the blocks, in seconds like the timestamps of the entries: from 2 hours up to a
+// tenth of the retention, so the blocks expire progressively.
+func blockRanges(retention time.Duration) []int64 {
+	limit := retention / 10
+	if limit > maxBlockRange {
+		limit = maxBlockRange
+	}
+
+	ranges := []int64{int64(minBlockRange / time.Second)}
+	for r := 3 * minBlockRange; r <= limit; r *= 3 {
+		ranges = append(ranges, int64(r/time.Second))
+	}
+
+	return ranges
+}
+
+// LoggingDatabase is used to store logging entries into a timeseries format. It's the StorageTSDB storage.
+// The timestamps of the entries are stored in seconds.
 type LoggingDatabase struct {
-	db       *tsdb.DB
-	appender tsdb.Appender
+	db *tsdb.DB
+	*labeler
+	top *topCounter
+	// rollups are the hits by minute and by hour, from the finest, if they are enabled.
+	rollups []*rollup
+	// compactions pauses the compactions of the databases while they are read.
+	compactions compactionPause
+
+	// mu serializes the writes, since the entries can be added by several sources at once.
+	mu sync.RWMutex
+	// pending are the hits of the seconds which aren't closed yet, by series and second.
+	pending map[sampleKey]*sample
+	// closed is the newest second whose hits are all stored: the hits of the newer seconds are pending.
+	closed int64
 }
 
-// NewLoggingDatabase is used to create a new logging database.
+// NewLoggingDatabase is used to create a new logging database, in a temporary directory.
 func NewLoggingDatabase() (*LoggingDatabase, error) {
-	tempDir, err := ioutil.TempDir("", "accesslog")
-	if err != nil {
-		return nil, err
+	return OpenLoggingDatabase(DatabaseConfig{})
+}
+
+// OpenLoggingDatabase opens a logging database, or creates it if it doesn't exist.
+func OpenLoggingDatabase(config DatabaseConfig) (*LoggingDatabase, error) {
+	dir := config.Dir
+	if dir == "" {
+		tempDir, err := ioutil.TempDir("", "accesslog")
+		if err != nil {
+			return nil, err
+		}
+		dir = tempDir
+	}
+
+	retention := config.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
 	}
 
 	options := tsdb.Options{
 		WALSegmentSize:         wal.DefaultSegmentSize,
-		RetentionDuration:      60 * 60 * 1000, // 1 hour in milliseconds
-		BlockRanges:            tsdb.ExponentialBlockRanges(int64(2*time.Hour)/1e6, 3, 5),
+		RetentionDuration:      uint64(retention / time.Second),
+		MaxBytes:               config.MaxBytes,
+		BlockRanges:            blockRanges(retention),
 		NoLockfile:             false,
 		AllowOverlappingBlocks: false,
 		WALCompression:         false,
 	}
-	db, err := tsdb.Open(tempDir, nil, nil, &options)
+	db, err := tsdb.Open(dir, nil, nil, &options)
 	if err != nil {
 		return nil, err
 	}
 
-	appender := db.Appender()
+	l := newLabeler(config.Labels, retention)
+	l.distinct = newDistinctCounter(config.Labels.DistinctLabels, retention)
+	if err := l.distinct.load(filepath.Join(dir, distinctFile)); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The seconds of the stored samples are closed, the heavy hitters count the hits of the buckets after them, and
+	// the stored values count in the limits of the labels.
+	closed, validFrom := int64(math.MinInt64), int64(math.MinInt64)
+	if oldest, newest, ok := storedRange(db); ok {
+		closed = newest
+		validFrom = newest - mod(newest, topBucket) + topBucket
+		if err := seedLabels(l, db, oldest, newest); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	var rollups []*rollup
+	if config.RollupRetention > 0 {
+		if rollups, err = openRollups(dir, config.RollupRetention); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
 	return &LoggingDatabase{
-		db:       db,
-		appender: appender,
+		db:      db,
+		labeler: l,
+		top:     newTopCounter(config.Labels.TopLabels, retention, validFrom),
+		rollups: rollups,
+		pending: make(map[sampleKey]*sample),
+		closed:  closed,
 	}, nil
 }
 
-// AddEntry adds a new entry to database.
-func (ld *LoggingDatabase) AddEntry(entry *LoggingEntry) error {
-	labels := labels.FromMap(entry.Labels())
-	_, err := ld.appender.Add(labels, entry.Date.Unix(), 1.0)
+// seedLabels records the values of the labels stored in a database, as if they were seen with its newest entry.
+func seedLabels(l *labeler, db *tsdb.DB, oldest int64, newest int64) error {
+	query, err := db.Querier(oldest, newest)
 	if err != nil {
 		return err
 	}
+	defer query.Close()
 
-	return ld.appender.Commit()
+	names, err := query.LabelNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		// The name of the series of the bytes isn't a label of the entries.
+		if name == nameLabel {
+			continue
+		}
+		values, err := query.LabelValues(name)
+		if err != nil {
+			return err
+		}
+		l.seed(name, values, newest)
+	}
+
+	return nil
 }
 
-// GetEntries can be used to collect all entries from a given label that match the pattern.
-func (ld *LoggingDatabase) GetEntries(label string, pattern string, since int64, until int64) (EntryList, error) {
-	// Collect the data
-	matcher, err := labels.NewRegexpMatcher(label, pattern)
+// storedRange returns the timestamps of the oldest and of the newest samples of a database, false if it's empty.
+func storedRange(db *tsdb.DB) (int64, int64, bool) {
+	oldest, newest := db.Head().MinTime(), db.Head().MaxTime()
+	for _, b := range db.Blocks() {
+		if b.Meta().MinTime < oldest {
+			oldest = b.Meta().MinTime
+		}
+		// The end of a block is excluded.
+		if b.Meta().MaxTime-1 > newest {
+			newest = b.Meta().MaxTime - 1
+		}
+	}
+
+	return oldest, newest, newest != math.MinInt64
+}
+
+// pendingDelay is how long the hits of a second are added up in memory before being stored, in seconds before the
+// newest entry: the database keeps one sample per series and second, which can't be changed once stored.
+const pendingDelay = 10
+
+const (
+	// nameLabel is the label naming the series of the bytes of the entries. They're stored besides the series of their
+	// hits, which have no name, with the same labels.
+	nameLabel = "__name__"
+	// bytesName is the name of the series of the bytes.
+	bytesName = "bytes"
+)
+
+// valueMatcher selects the series of the hits of the entries, or the series of their bytes.
+func valueMatcher(bytes bool) labels.Matcher {
+	if bytes {
+		return labels.NewEqualMatcher(nameLabel, bytesName)
+	}
+	return labels.NewEqualMatcher(nameLabel, "")
+}
+
+// bytesLabels returns the labels of the series of the bytes of a series of hits.
+func bytesLabels(lset labels.Labels) labels.Labels {
+	return labels.New(append(labels.Labels{{Name: nameLabel, Value: bytesName}}, lset...)...)
+}
+
+// withoutName removes the name of a series of bytes from its labels, so they're the labels of the entries.
+func withoutName(lset labels.Labels) labels.Labels {
+	if lset.Get(nameLabel) == "" {
+		return lset
+	}
+
+	entryLabels := make(labels.Labels, 0, len(lset)-1)
+	for _, l := range lset {
+		if l.Name != nameLabel {
+			entryLabels = append(entryLabels, l)
+		}
+	}
+	return entryLabels
+}
+
+// sample holds the hits and the bytes of a series during one second.
+type sample struct {
+	labels    labels.Labels
+	series    string
+	timestamp int64
+	hits      int
+	bytes     int
+}
+
+// value returns the bytes of the sample, or its hits.
+func (s *sample) value(bytes bool) float64 {
+	if bytes {
+		return float64(s.bytes)
+	}
+	return float64(s.hits)
+}
+
+// sampleKey identifies the sample of a series and a second.
+type sampleKey struct {
+	series    string
+	timestamp int64
+}
+
+// compactionPause pauses the compactions of some databases while they are read by one reader or more: the queries
+// running during a compaction of the head may miss samples. A compaction running when the first reader comes is
+// waited for, the compactions triggered while they read are skipped until the next trigger.
+type compactionPause struct {
+	mu      sync.Mutex
+	readers int
+}
+
+// pause pauses the compactions of the databases until the returned function is called.
+func (p *compactionPause) pause(dbs []*tsdb.DB) func() {
+	p.mu.Lock()
+	if p.readers == 0 {
+		for _, db := range dbs {
+			db.DisableCompactions()
+		}
+	}
+	p.readers++
+	p.mu.Unlock()
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.readers--
+		if p.readers == 0 {
+			for _, db := range dbs {
+				db.EnableCompactions()
+			}
+		}
+	}
+}
+
+// pauseCompactions pauses the compactions of the raw samples and of the rollups until the returned function is
+// called.
+func (ld *LoggingDatabase) pauseCompactions() func() {
+	dbs := []*tsdb.DB{ld.db}
+	for _, r := range ld.rollups {
+		dbs = append(dbs, r.db)
+	}
+
+	return ld.compactions.pause(dbs)
+}
+
+// AddEntry adds a new entry to database. The error of the database is returned if it can't be stored.
+func (ld *LoggingDatabase) AddEntry(entry *LoggingEntry) error {
+	_, err := ld.add([]*LoggingEntry{entry})
+	return err
+}
+
+// AddEntries adds a batch of entries with a single commit, which is much faster than adding them one by one.
+// The entries rejected because they are out of order or too old are skipped, their number is returned.
+func (ld *LoggingDatabase) AddEntries(entries []*LoggingEntry) (int, error) {
+	skipped, err := ld.add(entries)
+	switch err {
+	case tsdb.ErrOutOfOrderSample, tsdb.ErrAmendSample, tsdb.ErrOutOfBounds:
+		return skipped, nil
+	default:
+		return skipped, err
+	}
+}
+
+// add stores the hits of the entries. The hits of a series during a second are added up in a pending sample, stored
+// once the second is closed, pendingDelay seconds before the newest entry: the hits of the closed seconds are stored
+// at once, and skipped if the database already has a sample of their series and second. It returns the number of
+// skipped entries and the last error which skipped some of them.
+func (ld *LoggingDatabase) add(entries []*LoggingEntry) (int, error) {
+	// Add up the hits and the bytes by series and second, in the order of the entries.
+	var samples []*sample
+	index := make(map[sampleKey]*sample)
+	for _, entry := range entries {
+		lset := labels.FromMap(ld.labels(entry))
+		k := sampleKey{series: lset.String(), timestamp: entry.Date.Unix()}
+		if s, ok := index[k]; ok {
+			s.hits++
+			s.bytes += entry.Bytes
+			continue
+		}
+
+		s := &sample{labels: lset, series: k.series, timestamp: k.timestamp, hits: 1, bytes: entry.Bytes}
+		index[k] = s
+		samples = append(samples, s)
+	}
+
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+
+	closed := ld.closed
+	for _, s := range samples {
+		if s.timestamp-pendingDelay > closed {
+			closed = s.timestamp - pendingDelay
+		}
+	}
+
+	// The pending samples of the closed seconds are stored first, in order so their series stay in order.
+	var flushed []*sample
+	for k, s := range ld.pending {
+		if s.timestamp <= closed {
+			flushed = append(flushed, s)
+			delete(ld.pending, k)
+		}
+	}
+	sortSamples(flushed)
+	ld.closed = closed
+
+	skipped := 0
+	var rejected error
+	appender := ld.db.Appender()
+	// The database checks the order of the samples of a series against the committed ones only, and drops the
+	// samples out of order in a commit.
+	last := make(map[string]int64)
+	store := func(s *sample) (bool, error) {
+		var err error
+		if t, ok := last[s.series]; ok && s.timestamp <= t {
+			err = tsdb.ErrOutOfOrderSample
+		} else if _, err = appender.Add(s.labels, s.timestamp, float64(s.hits)); err == nil {
+			last[s.series] = s.timestamp
+		}
+
+		switch err {
+		case nil:
+			// The bytes are stored with the hits, so their series is in the same order.
+			if _, err := appender.Add(bytesLabels(s.labels), s.timestamp, float64(s.bytes)); err != nil {
+				appender.Rollback()
+				return false, err
+			}
+			return true, nil
+		case tsdb.ErrOutOfOrderSample, tsdb.ErrAmendSample, tsdb.ErrOutOfBounds:
+			skipped += s.hits
+			rejected = err
+			return false, nil
+		default:
+			appender.Rollback()
+			return false, err
+		}
+	}
+
+	for _, s := range flushed {
+		if _, err := store(s); err != nil {
+			return 0, err
+		}
+	}
+	for _, s := range samples {
+		if s.timestamp > closed {
+			k := sampleKey{series: s.series, timestamp: s.timestamp}
+			if p, ok := ld.pending[k]; ok {
+				p.hits += s.hits
+				p.bytes += s.bytes
+			} else {
+				ld.pending[k] = s
+			}
+			// The pending hits are read by the queries, and stored once their second is closed.
+			ld.top.add(s.timestamp, s.labels.Get, float64(s.hits))
+			continue
+		}
+
+		ok, err := store(s)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			ld.top.add(s.timestamp, s.labels.Get, float64(s.hits))
+		}
+	}
+	if err := appender.Commit(); err != nil {
+		return 0, err
+	}
+
+	return skipped, rejected
+}
+
+// sortSamples sorts the samples by timestamp.
+func sortSamples(samples []*sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].timestamp < samples[j].timestamp
+	})
+}
+
+// pendingSamples returns the pending samples selected by the matchers in the range, and the newest closed second:
+// the hits of the closed seconds are all in the database.
+func (ld *LoggingDatabase) pendingSamples(since int64, until int64, matchers []labels.Matcher) ([]sample, int64) {
+	ld.mu.RLock()
+	defer ld.mu.RUnlock()
+
+	var samples []sample
+	for _, s := range ld.pending {
+		if s.timestamp >= since && s.timestamp <= until && matchesAll(matchers, s.labels.Map()) {
+			samples = append(samples, *s)
+		}
+	}
+
+	return samples, ld.closed
+}
+
+// flush stores all the pending samples, closing their seconds.
+func (ld *LoggingDatabase) flush() error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+
+	flushed := make([]*sample, 0, len(ld.pending))
+	for _, s := range ld.pending {
+		flushed = append(flushed, s)
+		if s.timestamp > ld.closed {
+			ld.closed = s.timestamp
+		}
+	}
+	sortSamples(flushed)
+	ld.pending = make(map[sampleKey]*sample)
+
+	appender := ld.db.Appender()
+	for _, s := range flushed {
+		if _, err := appender.Add(s.labels, s.timestamp, float64(s.hits)); err != nil {
+			appender.Rollback()
+			return err
+		}
+		if _, err := appender.Add(bytesLabels(s.labels), s.timestamp, float64(s.bytes)); err != nil {
+			appender.Rollback()
+			return err
+		}
+	}
+
+	return appender.Commit()
+}
+
+// GetEntries can be used to collect all entries from a given label that match the pattern, and all the other matchers.
+func (ld *LoggingDatabase) GetEntries(label string, pattern string, since int64, until int64, matchers ...Matcher) (EntryList, error) {
+	compiled, err := compileMatchers(label, pattern, matchers)
 	if err != nil {
 		return nil, err
 	}
 
-	query, err := ld.db.Querier(since, until)
+	return ld.sumBy(label, since, until, compiled...)
+}
+
+// sumBy adds up the hits of the series selected by the matchers, grouped by the values of "label".
+func (ld *LoggingDatabase) sumBy(label string, since int64, until int64, matchers ...labels.Matcher) (EntryList, error) {
+	// Group the data by label
+	m := make(map[string]float64)
+	err := ld.forEachSeries(since, until, false, matchers, func(lset labels.Labels, hits float64) {
+		m[lset.Get(label)] += hits
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer query.Close()
 
-	series, err := query.Select(matcher)
+	return mapToEntryList(m), nil
+}
+
+// forEachSeries calls "fn" with the labels and the hits of each series selected by the matchers, or with its bytes,
+// which has samples in the range. The values of a series may be given in several calls, from the rollups and from the
+// raw samples.
+func (ld *LoggingDatabase) forEachSeries(since int64, until int64, bytes bool, matchers []labels.Matcher, fn func(labels.Labels, float64)) error {
+	defer ld.pauseCompactions()()
+
+	for _, s := range ld.segments(since, until, 0) {
+		if s.db == ld.db {
+			pending, closed := ld.pendingSamples(s.since, s.until, matchers)
+			for _, p := range pending {
+				fn(p.labels, p.value(bytes))
+			}
+			// The newer seconds were pending when read, but may have been stored since.
+			if s.until > closed {
+				s.until = closed
+			}
+		}
+		if s.since > s.until {
+			continue
+		}
+
+		if err := forEachSeriesOf(s.db, s.since, s.until, bytes, matchers, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachSeriesOf calls "fn" with the labels and the hits of each series of a database selected by the matchers, or
+// with its bytes, which has samples in the range.
+func forEachSeriesOf(db *tsdb.DB, since int64, until int64, bytes bool, matchers []labels.Matcher, fn func(labels.Labels, float64)) error {
+	// Collect the data
+	query, err := db.Querier(since, until)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer query.Close()
 
-	// Group the data by label
-	m := make(map[string]float64)
+	series, err := query.Select(append([]labels.Matcher{valueMatcher(bytes)}, matchers...)...)
+	if err != nil {
+		return err
+	}
 
 	for series.Next() {
 		s := series.At()
-		hits := 0.0
+		value, samples := 0.0, 0
 
 		it := s.Iterator()
 		for it.Next() {
 			_, v := it.At()
-			hits += v
+			value += v
+			samples++
 		}
 		if err := it.Err(); err != nil {
-			return nil, err
+			return err
 		}
 
-		labelValue := s.Labels().Get(label)
-		m[labelValue] += hits
+		// The series without samples in the range are skipped.
+		if samples > 0 {
+			fn(withoutName(s.Labels()), value)
+		}
 	}
 
-	return mapToEntryList(m), nil
+	return series.Err()
+}
+
+// Query adds up the hits or the bytes of the entries matching all the matchers of the query, grouped by its labels.
+func (ld *LoggingDatabase) Query(query Query) (GroupList, error) {
+	matchers, err := query.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	acc := newGroupAccumulator(query.GroupBy)
+	err = ld.forEachSeries(query.Since, query.Until, query.Bytes, matchers, func(lset labels.Labels, value float64) {
+		if query.GroupBySeries {
+			acc.addSeries(lset.Map(), value)
+		} else {
+			acc.add(lset.Get, value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return acc.list(query.Limit), nil
 }
 
 // TopEntries can be used to collect top entries from a given label that match the pattern.
-func (ld *LoggingDatabase) TopEntries(label string, pattern string, since int64, until int64, limit int) (EntryList, error) {
-	entries, err := ld.GetEntries(label, pattern, since, until)
+// The heavy hitters of the tracked labels answer the queries without pattern nor matchers.
+func (ld *LoggingDatabase) TopEntries(label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error) {
+	entries, ok, err := ld.top.top(label, pattern, since, until, limit, matchers, func(since int64, until int64) (EntryList, error) {
+		return ld.GetEntries(label, pattern, since, until)
+	})
+	if ok {
+		return entries, err
+	}
+
+	entries, err = ld.GetEntries(label, pattern, since, until, matchers...)
 	if err != nil {
 		return nil, err
 	}
 
+	return topN(entries, limit), nil
+}
+
+// topN sorts the entries descending by value and keeps the first "limit" ones (all if limit is not positive).
+func topN(entries EntryList, limit int) EntryList {
 	sort.Sort(sort.Reverse(entries))
 
 	if limit > 0 && limit < entries.Len() {
-		return entries[:limit], nil
+		return entries[:limit]
 	}
 
-	return entries, nil
+	return entries
 }
 
-// Cleanup is used to drop all stored data.
-func (ld *LoggingDatabase) Cleanup() error {
-	err := os.RemoveAll(ld.db.Dir())
+// TopEntriesBy returns the top values of "groupLabel" from the entries whose "label" matches the pattern.
+func (ld *LoggingDatabase) TopEntriesBy(groupLabel string, label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error) {
+	compiled, err := compileMatchers(label, pattern, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ld.sumBy(groupLabel, since, until, compiled...)
+	if err != nil {
+		return nil, err
+	}
+
+	return topN(entries, limit), nil
+}
+
+// GetRange can be used to collect the entries from a given label that match the pattern, counted by step.
+func (ld *LoggingDatabase) GetRange(label string, pattern string, since int64, until int64, step int64, matchers ...Matcher) (SeriesList, error) {
+	compiled, err := compileMatchers(label, pattern, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := newRangeAccumulator(since, until, step)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ld.pauseCompactions()()
+	for _, s := range ld.segments(since, until, step) {
+		if s.db == ld.db {
+			pending, closed := ld.pendingSamples(s.since, s.until, compiled)
+			for _, p := range pending {
+				acc.add(p.labels.Get(label), p.timestamp, float64(p.hits))
+			}
+			if s.until > closed {
+				s.until = closed
+			}
+		}
+		if s.since > s.until {
+			continue
+		}
+
+		if err := addRange(acc, s.db, label, s.since, s.until, compiled); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc.list(), nil
+}
+
+// addRange counts the hits of the series of a database selected by the matchers, by value of "label" and by step.
+func addRange(acc *rangeAccumulator, db *tsdb.DB, label string, since int64, until int64, matchers []labels.Matcher) error {
+	query, err := db.Querier(since, until)
+	if err != nil {
+		return err
+	}
+	defer query.Close()
+
+	series, err := query.Select(append([]labels.Matcher{valueMatcher(false)}, matchers...)...)
 	if err != nil {
 		return err
 	}
 
+	for series.Next() {
+		s := series.At()
+		labelValue := s.Labels().Get(label)
+
+		it := s.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			acc.add(labelValue, t, v)
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+
+	return series.Err()
+}
+
+// Close closes the database, keeping the stored data, the rollups and the distinct counts.
+func (ld *LoggingDatabase) Close() error {
+	if err := ld.flush(); err != nil {
+		closeRollups(ld.rollups)
+		ld.db.Close()
+		return err
+	}
+	if err := closeRollups(ld.rollups); err != nil {
+		ld.db.Close()
+		return err
+	}
+	if err := ld.distinct.save(filepath.Join(ld.db.Dir(), distinctFile)); err != nil {
+		ld.db.Close()
+		return err
+	}
+
 	return ld.db.Close()
 }
+
+// Cleanup is used to drop all stored data.
+func (ld *LoggingDatabase) Cleanup() error {
+	closeRollups(ld.rollups)
+	if err := ld.db.Close(); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(ld.db.Dir())
+}
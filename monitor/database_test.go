@@ -1,7 +1,9 @@
 package monitor
 
 import (
+	"io/ioutil"
 	"log"
+	"os"
 	"strconv"
 	"testing"
 	"time"
@@ -36,6 +38,8 @@ func (suite *DatabaseTestSuite) TestAddEntryl() {
 
 	err := suite.db.AddEntry(entry)
 	require.Nil(t, err, "No error should be returned while adding an entry.")
+	// The hits of the recent seconds are pending until their second is closed.
+	require.Nil(t, suite.db.flush(), "No error should be returned while storing the pending hits.")
 
 	matcher, err := labels.NewRegexpMatcher(HostLabel, ".*")
 	require.Nil(t, err, "No error should be returned while creating the label matcher.")
@@ -44,7 +48,8 @@ func (suite *DatabaseTestSuite) TestAddEntryl() {
 	require.Nil(t, err, "No error should be returned while creating the querier.")
 	defer query.Close()
 
-	series, err := query.Select(matcher)
+	// The series of the bytes are stored besides the series of the hits.
+	series, err := query.Select(valueMatcher(false), matcher)
 	require.Nil(t, err, "No error should be returned while selecting data.")
 
 	expectedLabels := []labels.Label{
@@ -55,6 +60,7 @@ func (suite *DatabaseTestSuite) TestAddEntryl() {
 		{Name: RequestURLLabel, Value: entry.Request.URL},
 		{Name: RequestProtocolLabel, Value: entry.Request.Protocol},
 		{Name: RequestURLSectionLabel, Value: entry.Request.Section()},
+		{Name: RouteLabel, Value: entry.Request.Route()},
 		{Name: StatusLabel, Value: strconv.Itoa(entry.Status)},
 	}
 
@@ -96,6 +102,22 @@ func (suite *DatabaseTestSuite) TestGetEntries() {
 	require.ElementsMatch(t, expectedEntries, entries)
 }
 
+func (suite *DatabaseTestSuite) TestAddEntries() {
+	t := suite.T()
+	now := time.Now()
+	err := suite.db.AddEntry(testEntry("james", now.Add(-30*time.Second)))
+	require.Nil(t, err, "No error should be returned while adding an entry.")
+
+	// The entry older than the stored samples of its series is skipped, once the newer entries closed their second.
+	skipped, err := suite.db.AddEntries([]*LoggingEntry{testEntry("james", now.Add(-time.Minute)), testEntry("jill", now), testEntry("james", now.Add(time.Second))})
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+	require.Equal(t, 1, skipped)
+
+	entries, err := suite.db.GetEntries(UserLabel, ".*", now.Add(-time.Hour).Unix(), now.Add(time.Hour).Unix())
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.ElementsMatch(t, []Entry{{Key: "james", Value: 2.0}, {Key: "jill", Value: 1.0}}, entries)
+}
+
 func (suite *DatabaseTestSuite) TestTopEntries() {
 	t := suite.T()
 	now := time.Now()
@@ -176,6 +198,95 @@ func (suite *DatabaseTestSuite) TestTopEntriesWithLimitOutBounds() {
 	require.ElementsMatch(t, expectedEntries, entries)
 }
 
+func TestOpenLoggingDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	entry := &LoggingEntry{RemoteHost: "127.0.0.1", RemoteLogname: "-", AuthUser: "james", Date: now, Request: &Request{Method: "GET", URL: "/report/user", Protocol: "HTTP/1.0"}, Status: 200, Bytes: 123}
+
+	db, err := OpenLoggingDatabase(DatabaseConfig{Dir: dir, Retention: 7 * 24 * time.Hour})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, db.AddEntry(entry), "No error should be returned while adding an entry.")
+	require.Nil(t, db.Close(), "Unexpected error raised")
+
+	// The entries are still there once the database is reopened.
+	db, err = OpenLoggingDatabase(DatabaseConfig{Dir: dir, Retention: 7 * 24 * time.Hour})
+	require.Nil(t, err, "Unexpected error raised")
+	entries, err := db.GetEntries(HostLabel, AllEntriesPattern, now.Unix(), now.Unix())
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "127.0.0.1", Value: 1.0}}, entries, "Unexpected entries")
+
+	require.Nil(t, db.Cleanup(), "Unexpected error raised")
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err), "The directory should be removed")
+}
+
+func TestAddEntriesTooOld(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	// The timestamps are in seconds: the entries of new series are accepted up to an hour before the newest entry.
+	now := time.Now()
+	skipped, err := db.AddEntries([]*LoggingEntry{testEntry("james", now), testEntry("jill", now.Add(-30*time.Minute)), testEntry("jack", now.Add(-2*time.Hour))})
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+	require.Equal(t, 1, skipped, "Unexpected skipped entries")
+}
+
+func TestAddEntriesAcrossBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batches")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	db, err := OpenLoggingDatabase(DatabaseConfig{Dir: dir})
+	require.Nil(t, err, "Unexpected error raised")
+
+	now := time.Now()
+	for name, storage := range map[string]Storage{"tsdb": db, "memory": NewMemoryStorage(time.Hour, LabelConfig{})} {
+		// The hits of a series during a second come in several batches, and one by one.
+		for i := 0; i < 3; i++ {
+			skipped, err := storage.AddEntries([]*LoggingEntry{testEntry("james", now), testEntry("james", now), testEntry("jill", now.Add(-time.Second))})
+			require.Nil(t, err, "Unexpected error raised for %s", name)
+			require.Equal(t, 0, skipped, "Unexpected skipped entries for %s", name)
+			require.Nil(t, storage.AddEntry(testEntry("james", now)), "Unexpected error raised for %s", name)
+		}
+
+		entries, err := storage.GetEntries(UserLabel, AllEntriesPattern, now.Unix()-1, now.Unix())
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.ElementsMatch(t, EntryList{{"james", 9}, {"jill", 3}}, entries, "Unexpected entries for %s", name)
+
+		// The second is closed by the newer entries, its hits are kept.
+		_, err = storage.AddEntries([]*LoggingEntry{testEntry("james", now.Add(time.Minute))})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		series, err := storage.GetRange(UserLabel, AllEntriesPattern, now.Unix()-1, now.Unix(), 1)
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.ElementsMatch(t, SeriesList{{Key: "james", Points: []Point{{now.Unix() - 1, 0}, {now.Unix(), 9}}}, {Key: "jill", Points: []Point{{now.Unix() - 1, 3}, {now.Unix(), 0}}}}, series, "Unexpected range for %s", name)
+	}
+
+	// The hits of a closed second can't be added anymore.
+	skipped, err := db.AddEntries([]*LoggingEntry{testEntry("james", now)})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 1, skipped, "The hits of a closed second should be skipped")
+
+	// The pending hits are stored when the database is closed.
+	require.Nil(t, db.Close(), "Unexpected error raised")
+	db, err = OpenLoggingDatabase(DatabaseConfig{Dir: dir})
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+	entries, err := db.GetEntries(UserLabel, AllEntriesPattern, now.Unix()-1, now.Unix()+60)
+	require.Nil(t, err, "Unexpected error raised")
+	require.ElementsMatch(t, EntryList{{"james", 10}, {"jill", 3}}, entries, "The hits should be kept after a restart")
+}
+
+func TestBlockRanges(t *testing.T) {
+	require.Equal(t, []int64{2 * 3600}, blockRanges(time.Hour), "Unexpected block ranges")
+	require.Equal(t, []int64{2 * 3600}, blockRanges(DefaultRetention), "Unexpected block ranges")
+	require.Equal(t, []int64{2 * 3600, 6 * 3600, 18 * 3600}, blockRanges(15*24*time.Hour), "Unexpected block ranges")
+	require.Equal(t, []int64{2 * 3600, 6 * 3600, 18 * 3600, 54 * 3600, 162 * 3600, 486 * 3600}, blockRanges(10*365*24*time.Hour), "Unexpected block ranges")
+}
+
 func TestDatabaseTestSuite(t *testing.T) {
 	suite.Run(t, new(DatabaseTestSuite))
 }
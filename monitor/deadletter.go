@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDeadLetterMaxSize is the default size of a dead-letter file before its rotation.
+	DefaultDeadLetterMaxSize = 10 << 20
+	// DefaultDeadLetterMaxFiles is the default number of rotated dead-letter files kept.
+	DefaultDeadLetterMaxFiles = 5
+)
+
+// deadLetterRecord is a rejected line, with the reason of its rejection.
+type deadLetterRecord struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Line   string    `json:"line"`
+	Field  string    `json:"field,omitempty"`
+	Reason string    `json:"reason"`
+}
+
+// DeadLetter keeps the rejected lines in a file, one JSON object per line, so they aren't lost.
+// When the file would exceed its maximum size, it's rotated like by logrotate: "dead.log" becomes "dead.log.1",
+// "dead.log.1" becomes "dead.log.2", and so on up to the maximum number of rotated files.
+type DeadLetter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	now      func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenDeadLetter opens a dead-letter file, appending to the existing one. The defaults are used for the limits
+// which aren't positive.
+func OpenDeadLetter(path string, maxSize int64, maxFiles int) (*DeadLetter, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultDeadLetterMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultDeadLetterMaxFiles
+	}
+
+	d := &DeadLetter{path: path, maxSize: maxSize, maxFiles: maxFiles, now: time.Now}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *DeadLetter) open() error {
+	file, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	d.file = file
+	d.size = info.Size()
+	return nil
+}
+
+// Write records a rejected line. The field and the reason are taken from a *ParseError.
+func (d *DeadLetter) Write(source string, line string, reason error) error {
+	record := deadLetterRecord{Time: d.now(), Source: source, Line: line, Reason: reason.Error()}
+	var parseErr *ParseError
+	if errors.As(reason, &parseErr) {
+		record.Field = parseErr.Field
+		record.Reason = parseErr.Reason
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return fmt.Errorf("dead-letter file %s is closed", d.path)
+	}
+
+	if d.size > 0 && d.size+int64(len(data)) > d.maxSize {
+		if err := d.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := d.file.Write(data)
+	d.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files and starts a new file.
+func (d *DeadLetter) rotate() error {
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	d.file = nil
+
+	for i := d.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", d.path, i), fmt.Sprintf("%s.%d", d.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(d.path, d.path+".1"); err != nil {
+		return err
+	}
+
+	return d.open()
+}
+
+// Close closes the file. The next writes fail.
+func (d *DeadLetter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readDeadLetter(t *testing.T, path string) []deadLetterRecord {
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err, "Unexpected error raised")
+
+	var records []deadLetterRecord
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var record deadLetterRecord
+		require.Nil(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead.log")
+	d, err := OpenDeadLetter(path, 0, 0)
+	require.Nil(t, err, "Unexpected error raised")
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	line := `127.0.0.1 - james [40/May/2018:16:00:39] "GET /report HTTP/1.0" 200 123`
+	_, parseErr := NewLoggingEntry(line)
+	require.Nil(t, d.Write("access.log", line, parseErr))
+	require.Nil(t, d.Write("ingest", "other", errors.New("failure")))
+	require.Nil(t, d.Close())
+
+	records := readDeadLetter(t, path)
+	require.Len(t, records, 2)
+	require.Equal(t, "access.log", records[0].Source)
+	require.Equal(t, line, records[0].Line)
+	require.Equal(t, FieldDate, records[0].Field)
+	require.NotEmpty(t, records[0].Reason)
+	require.True(t, now.Equal(records[0].Time))
+	require.Equal(t, deadLetterRecord{Time: records[1].Time, Source: "ingest", Line: "other", Reason: "failure"}, records[1])
+
+	require.NotNil(t, d.Write("ingest", "closed", errors.New("failure")), "The writes should fail once the file is closed")
+}
+
+func TestDeadLetterRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead.log")
+	// Each record is bigger than half of the maximum size, so each one rotates the file.
+	d, err := OpenDeadLetter(path, 150, 2)
+	require.Nil(t, err, "Unexpected error raised")
+	defer d.Close()
+
+	for _, line := range []string{"first", "second", "third", "fourth"} {
+		require.Nil(t, d.Write("access.log", line, errors.New("failure")))
+	}
+
+	require.Equal(t, "fourth", readDeadLetter(t, path)[0].Line)
+	require.Equal(t, "third", readDeadLetter(t, path+".1")[0].Line)
+	require.Equal(t, "second", readDeadLetter(t, path+".2")[0].Line)
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err), "Only 2 rotated files should be kept")
+}
+
+func TestMonitorRejectLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead.log")
+	d, err := OpenDeadLetter(path, 0, 0)
+	require.Nil(t, err, "Unexpected error raised")
+
+	m, err := NewMonitor(nil, nil, WithDeadLetter(d))
+	require.Nil(t, err, "Unexpected error raised")
+
+	line := logLine{source: "access.log", text: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report" 200 123`}
+	m.processLine(context.Background(), line)
+	require.Nil(t, m.Stop())
+
+	records := readDeadLetter(t, path)
+	require.Len(t, records, 1)
+	require.Equal(t, line.text, records[0].Line)
+	require.Equal(t, FieldRequest, records[0].Field)
+}
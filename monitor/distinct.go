@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// distinctBucket is the duration of the buckets of the distinct counts, in seconds. The windows of the distinct counts
+// are extended to whole buckets.
+const distinctBucket = 60
+
+// DefaultDistinctLabels are the labels whose distinct values are counted by default, used by the command line: the
+// clients and the authenticated users.
+var DefaultDistinctLabels = []string{HostLabel, UserLabel}
+
+// ErrDistinctNotCounted is returned for the distinct values of a label which aren't counted (see
+// LabelConfig.DistinctLabels).
+var ErrDistinctNotCounted = errors.New("distinct values not counted")
+
+// distinctCounter estimates the number of distinct values of some labels, with a HyperLogLog sketch per label and per
+// bucket of time. The sketches of a window are merged to count its distinct values.
+type distinctCounter struct {
+	labels    map[string]bool
+	retention int64
+
+	mu       sync.Mutex
+	sketches map[string]map[int64]*hyperLogLog
+	// newest is the start of the newest bucket. The buckets older than the retention before it are dropped.
+	newest int64
+}
+
+// newDistinctCounter creates a counter keeping the sketches of the retention before the newest entry.
+// DefaultRetention is used if the retention isn't positive.
+func newDistinctCounter(labels []string, retention time.Duration) *distinctCounter {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	d := &distinctCounter{
+		labels:    make(map[string]bool, len(labels)),
+		retention: int64(retention / time.Second),
+		sketches:  make(map[string]map[int64]*hyperLogLog, len(labels)),
+	}
+	for _, label := range labels {
+		d.labels[label] = true
+		d.sketches[label] = make(map[int64]*hyperLogLog)
+	}
+
+	return d
+}
+
+// add counts the values of the labels of an entry. The empty values and the entries older than the retention are
+// ignored.
+func (d *distinctCounter) add(timestamp int64, entryLabels map[string]string) {
+	if len(d.labels) == 0 {
+		return
+	}
+
+	bucket := timestamp - mod(timestamp, distinctBucket)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if bucket > d.newest {
+		d.newest = bucket
+		d.prune()
+	}
+	if bucket <= d.newest-d.retention-distinctBucket {
+		return
+	}
+
+	for label := range d.labels {
+		value := entryLabels[label]
+		if value == "" {
+			continue
+		}
+		sketch, ok := d.sketches[label][bucket]
+		if !ok {
+			sketch = newHyperLogLog()
+			d.sketches[label][bucket] = sketch
+		}
+		sketch.add(value)
+	}
+}
+
+// prune drops the buckets which are entirely older than the retention.
+func (d *distinctCounter) prune() {
+	for _, buckets := range d.sketches {
+		for bucket := range buckets {
+			if bucket <= d.newest-d.retention-distinctBucket {
+				delete(buckets, bucket)
+			}
+		}
+	}
+}
+
+// count estimates the number of distinct values of a label between two timestamps, both included, extended to whole
+// buckets.
+func (d *distinctCounter) count(label string, since int64, until int64) (float64, error) {
+	if !d.labels[label] {
+		return 0, fmt.Errorf("%w for the %s label", ErrDistinctNotCounted, label)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	merged := newHyperLogLog()
+	first := since - mod(since, distinctBucket)
+	for bucket, sketch := range d.sketches[label] {
+		if bucket >= first && bucket <= until {
+			merged.merge(sketch)
+		}
+	}
+
+	return merged.estimate(), nil
+}
+
+// distinctSketch is a saved sketch.
+type distinctSketch struct {
+	Label     string   `json:"label"`
+	Timestamp int64    `json:"timestamp"`
+	Sparse    []uint32 `json:"sparse,omitempty"`
+	Registers []byte   `json:"registers,omitempty"`
+}
+
+// save writes the sketches to a file, replaced atomically.
+func (d *distinctCounter) save(path string) error {
+	d.mu.Lock()
+	var sketches []distinctSketch
+	for label, buckets := range d.sketches {
+		for bucket, sketch := range buckets {
+			sketches = append(sketches, distinctSketch{Label: label, Timestamp: bucket, Sparse: sketch.sparse, Registers: sketch.dense})
+		}
+	}
+	data, err := json.Marshal(sketches)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// load reads the sketches saved in a file, of the labels which are still counted. A missing file is ignored.
+func (d *distinctCounter) load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var sketches []distinctSketch
+	if err := json.Unmarshal(data, &sketches); err != nil {
+		return fmt.Errorf("failed to parse the distinct counts %s: %w", path, err)
+	}
+	sort.Slice(sketches, func(i, j int) bool { return sketches[i].Timestamp > sketches[j].Timestamp })
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range sketches {
+		if !d.labels[s.Label] {
+			continue
+		}
+		if s.Registers != nil && len(s.Registers) != hllRegisters {
+			return fmt.Errorf("failed to parse the distinct counts %s: sketch with %d registers", path, len(s.Registers))
+		}
+		for _, r := range s.Sparse {
+			if r>>8 >= hllRegisters {
+				return fmt.Errorf("failed to parse the distinct counts %s: invalid register %d", path, r>>8)
+			}
+		}
+		if s.Timestamp > d.newest {
+			d.newest = s.Timestamp
+		}
+		if s.Timestamp <= d.newest-d.retention-distinctBucket {
+			continue
+		}
+		d.sketches[s.Label][s.Timestamp] = &hyperLogLog{sparse: s.Sparse, dense: s.Registers}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 500, 1000, 5000, 100000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.add("10.0." + strconv.Itoa(i))
+			h.add("10.0." + strconv.Itoa(i))
+		}
+		require.InDelta(t, n, h.estimate(), 0.05*float64(n)+0.5, "Unexpected estimate for %d values", n)
+		require.Equal(t, n > hllMaxSparse, h.dense != nil, "Unexpected representation for %d values", n)
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	sparse, dense, union := newHyperLogLog(), newHyperLogLog(), newHyperLogLog()
+	for i := 0; i < 100; i++ {
+		sparse.add(strconv.Itoa(i))
+		union.add(strconv.Itoa(i))
+	}
+	for i := 50; i < 3000; i++ {
+		dense.add(strconv.Itoa(i))
+		union.add(strconv.Itoa(i))
+	}
+
+	merged := newHyperLogLog()
+	merged.merge(sparse)
+	require.Nil(t, merged.dense, "The merge of sparse sketches should stay sparse")
+	merged.merge(dense)
+	require.Equal(t, union.estimate(), merged.estimate(), "The merged sketch should count the union")
+	require.InDelta(t, 3000, merged.estimate(), 150)
+
+	sparse.merge(dense)
+	require.Equal(t, union.estimate(), sparse.estimate(), "The merged sketch should count the union")
+}
+
+func TestCountDistinct(t *testing.T) {
+	db, err := OpenLoggingDatabase(DatabaseConfig{Labels: LabelConfig{DistinctLabels: DefaultDistinctLabels, MaxValues: 2}})
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	for name, storage := range map[string]Storage{"tsdb": db, "memory": NewMemoryStorage(time.Hour, LabelConfig{DistinctLabels: DefaultDistinctLabels})} {
+		start := time.Unix(1539874800, 0)
+		var entries []*LoggingEntry
+		for i := 0; i < 10; i++ {
+			for j := 0; j <= i; j++ {
+				// The minute i has the hosts 0 to i.
+				entry := testEntry("james", start.Add(time.Duration(i)*time.Minute+time.Duration(j)*time.Second))
+				entry.RemoteHost = "10.0.0." + strconv.Itoa(j)
+				entries = append(entries, entry)
+			}
+		}
+		_, err := storage.AddEntries(entries)
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+
+		for _, test := range []struct {
+			since, until time.Duration
+			expected     float64
+		}{
+			{0, 0, 1},
+			{0, 10 * time.Minute, 10},
+			{3 * time.Minute, 4 * time.Minute, 5},
+			// The window is extended to whole minutes.
+			{3*time.Minute + 30*time.Second, 3*time.Minute + 40*time.Second, 4},
+			{time.Hour, 2 * time.Hour, 0},
+		} {
+			count, err := storage.CountDistinct(HostLabel, start.Add(test.since).Unix(), start.Add(test.until).Unix())
+			require.Nil(t, err, "Unexpected error raised for %s", name)
+			require.Equal(t, test.expected, math.Round(count), "Unexpected count for %s between %v and %v", name, test.since, test.until)
+		}
+
+		count, err := storage.CountDistinct(UserLabel, start.Unix(), start.Add(time.Hour).Unix())
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, 1.0, math.Round(count), "Unexpected count for %s", name)
+
+		_, err = storage.CountDistinct(StatusLabel, start.Unix(), start.Add(time.Hour).Unix())
+		require.True(t, errors.Is(err, ErrDistinctNotCounted), "Unexpected error for %s: %v", name, err)
+	}
+}
+
+func TestDistinctCounterRetention(t *testing.T) {
+	d := newDistinctCounter([]string{HostLabel}, 10*time.Minute)
+	d.add(0, map[string]string{HostLabel: "10.0.0.1"})
+	d.add(5*60, map[string]string{HostLabel: "10.0.0.2"})
+	d.add(10*60+59, map[string]string{HostLabel: "10.0.0.3"})
+	require.Len(t, d.sketches[HostLabel], 3, "The buckets of the retention should be kept")
+
+	d.add(11*60, map[string]string{HostLabel: "10.0.0.4"})
+	require.Len(t, d.sketches[HostLabel], 3, "The buckets older than the retention should be dropped")
+	d.add(30, map[string]string{HostLabel: "10.0.0.5"})
+	require.Len(t, d.sketches[HostLabel], 3, "The entries older than the retention should be ignored")
+
+	count, err := d.count(HostLabel, 0, 20*60)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 3.0, math.Round(count))
+}
+
+func TestDistinctPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distinct")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	config := DatabaseConfig{Dir: dir, Labels: LabelConfig{DistinctLabels: []string{HostLabel}}}
+	db, err := OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+
+	now := time.Now()
+	var entries []*LoggingEntry
+	for i := 0; i < 2000; i++ {
+		entry := testEntry("james", now)
+		entry.RemoteHost = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+		entries = append(entries, entry)
+	}
+	entry := testEntry("james", now.Add(-time.Minute))
+	entry.RemoteHost = "172.16.0.1"
+	entries = append(entries, entry)
+	_, err = db.AddEntries(entries)
+	require.Nil(t, err, "Unexpected error raised")
+
+	expected, err := db.CountDistinct(HostLabel, now.Add(-time.Minute).Unix(), now.Unix())
+	require.Nil(t, err, "Unexpected error raised")
+	require.InDelta(t, 2001, expected, 100)
+	require.Nil(t, db.Close(), "Unexpected error raised")
+
+	db, err = OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	count, err := db.CountDistinct(HostLabel, now.Add(-time.Minute).Unix(), now.Unix())
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, expected, count, "The distinct counts should be reloaded")
+}
+
+func TestStatsSummaryDistinct(t *testing.T) {
+	db := NewMemoryStorage(time.Hour, LabelConfig{DistinctLabels: DefaultDistinctLabels})
+	now := time.Now()
+	for _, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.1"} {
+		entry := testEntry("james", now)
+		entry.RemoteHost = host
+		require.Nil(t, db.AddEntry(entry), "Unexpected error raised")
+	}
+
+	summary, err := NewStatsSummary(now.Unix(), now.Unix(), db)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, EntryList{{Key: HostLabel, Value: 3}, {Key: UserLabel, Value: 1}}, summary.Distinct)
+	require.Contains(t, summary.String(), "- Distinct values (estimated): [{host 3} {user 1}]")
+
+	summary, err = NewStatsSummary(now.Unix(), now.Unix(), db, Matcher{StatusLabel, MatchEqual, "200"})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Empty(t, summary.Distinct, "The distinct values can't be filtered by matchers")
+
+	summary, err = NewStatsSummary(now.Unix(), now.Unix(), NewMemoryStorage(time.Hour, LabelConfig{}))
+	require.Nil(t, err, "Unexpected error raised")
+	require.Empty(t, summary.Distinct, "The labels which aren't counted should be skipped")
+}
+
+func TestAlertDistinct(t *testing.T) {
+	db := NewMemoryStorage(time.Hour, LabelConfig{DistinctLabels: DefaultDistinctLabels})
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		entry := testEntry("james", now)
+		entry.RemoteHost = "10.0.0." + strconv.Itoa(i)
+		require.Nil(t, db.AddEntry(entry), "Unexpected error raised")
+	}
+
+	alert := NewAlert("clients", time.Second, time.Minute, 15, HostLabel, AllEntriesPattern, WithAggregation(AggregationDistinct, 0))
+	require.Nil(t, alert.CheckStatusAt(db, now), "No error should be returned while checking the status.")
+	require.Equal(t, Critical, alert.Status(), "The alert should fire on the distinct clients")
+	require.Equal(t, 20.0, math.Round(alert.State().Value))
+
+	alert = NewAlert("users", time.Second, time.Minute, 2, UserLabel, AllEntriesPattern, WithAggregation(AggregationDistinct, 0))
+	require.Nil(t, alert.CheckStatusAt(db, now), "No error should be returned while checking the status.")
+	require.Equal(t, OK, alert.Status(), "The alert shouldn't fire with one user")
+
+	alert = NewAlert("statuses", time.Second, time.Minute, 2, StatusLabel, AllEntriesPattern, WithAggregation(AggregationDistinct, 0))
+	require.NotNil(t, alert.CheckStatusAt(db, now), "An error should be returned for a label which isn't counted")
+}
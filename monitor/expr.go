@@ -0,0 +1,622 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The query language is a subset of PromQL over the hits of the entries. A selector with a range, e.g
+// `{status=~"5.."}[5m]`, selects the hits of the entries of the range, by series. Named "bytes", e.g
+// `bytes{status=~"5.."}[5m]`, it selects their bytes instead. The functions and aggregations are:
+//   - rate(selector[range]): the hits (or bytes) per second of each series over the range.
+//   - sum [by (labels)] (expr): the sum of the values, by group.
+//   - count [by (labels)] (expr): the number of hits of a selector, or the number of values of another expression.
+//   - topk [by (labels)] (k, expr): the k highest values, by group.
+// The aggregations also accept a selector without parentheses, e.g `count by (section) {status=~"5.."}[5m]`.
+
+// Expr is a parsed query.
+type Expr interface {
+	String() string
+	eval(ev *evaluator) (GroupList, error)
+}
+
+// QueryError describes where and why a query can't be parsed.
+type QueryError struct {
+	Query string
+	// Pos is the position of the error in the query, in bytes.
+	Pos int
+	Msg string
+}
+
+// Error describes the error on the first line, then shows the query with a caret under the position of the error.
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("parse error at position %d: %s\n%s\n%s^", e.Pos+1, e.Msg, e.Query, strings.Repeat(" ", e.Pos))
+}
+
+// selectorExpr selects the hits of the entries matching its matchers during its range, or their bytes, by series.
+type selectorExpr struct {
+	bytes    bool
+	matchers []Matcher
+	rng      time.Duration
+}
+
+func (e *selectorExpr) String() string {
+	matchers := make([]string, len(e.matchers))
+	for i, m := range e.matchers {
+		matchers[i] = m.String()
+	}
+
+	name := ""
+	if e.bytes {
+		name = bytesName
+	}
+
+	return fmt.Sprintf("%s{%s}[%s]", name, strings.Join(matchers, ", "), formatRange(e.rng))
+}
+
+// rateExpr is the hits per second of each series of a selector.
+type rateExpr struct {
+	selector *selectorExpr
+}
+
+func (e *rateExpr) String() string {
+	return fmt.Sprintf("rate(%s)", e.selector)
+}
+
+// aggregateExpr aggregates the values of an expression by group.
+type aggregateExpr struct {
+	op       string
+	grouping []string
+	// k is the parameter of topk.
+	k   int
+	arg Expr
+}
+
+func (e *aggregateExpr) String() string {
+	var b strings.Builder
+	b.WriteString(e.op)
+	if len(e.grouping) > 0 {
+		fmt.Fprintf(&b, " by (%s)", strings.Join(e.grouping, ", "))
+	}
+	if e.op == "topk" {
+		fmt.Fprintf(&b, " (%d, %s)", e.k, e.arg)
+	} else {
+		fmt.Fprintf(&b, " (%s)", e.arg)
+	}
+
+	return b.String()
+}
+
+var (
+	functionNames    = []string{"rate"}
+	aggregationNames = []string{"count", "sum", "topk"}
+)
+
+// ParseExpr parses a query. The errors are *QueryError.
+func ParseExpr(query string) (Expr, error) {
+	p := &parser{lexer: lexer{input: query}}
+	p.next()
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, p.errorf("unexpected %s after the end of the expression", p.token)
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	// tokenNumber is a number, or a duration like "5m".
+	tokenNumber
+	tokenString
+	tokenMatchOp
+	tokenPunctuation
+	tokenError
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of the query"
+	case tokenString:
+		return fmt.Sprintf("string %s", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lexer splits a query into tokens.
+type lexer struct {
+	input string
+	pos   int
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.input) && strings.IndexByte(" \t\r\n", l.input[l.pos]) >= 0 {
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, pos: l.pos}
+	}
+
+	start := l.pos
+	c := l.input[l.pos]
+	switch {
+	case isLabelNameChar(c, true):
+		for l.pos < len(l.input) && isLabelNameChar(l.input[l.pos], false) {
+			l.pos++
+		}
+		return token{kind: tokenIdentifier, text: l.input[start:l.pos], pos: start}
+
+	case isDigit(c) || c == '.':
+		for l.pos < len(l.input) && (isDigit(l.input[l.pos]) || l.input[l.pos] == '.' || isLabelNameChar(l.input[l.pos], true)) {
+			l.pos++
+		}
+		return token{kind: tokenNumber, text: l.input[start:l.pos], pos: start}
+
+	case c == '"' || c == '\'' || c == '`':
+		for l.pos++; l.pos < len(l.input) && l.input[l.pos] != c; l.pos++ {
+			if l.input[l.pos] == '\\' && c != '`' {
+				l.pos++
+			}
+		}
+		if l.pos >= len(l.input) {
+			return token{kind: tokenError, text: "unterminated string", pos: start}
+		}
+		l.pos++
+		return token{kind: tokenString, text: l.input[start:l.pos], pos: start}
+
+	case c == '=' || c == '!':
+		for _, op := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+			if strings.HasPrefix(l.input[l.pos:], string(op)) {
+				l.pos += len(op)
+				return token{kind: tokenMatchOp, text: string(op), pos: start}
+			}
+		}
+
+	case strings.IndexByte("(){}[],", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunctuation, text: string(c), pos: start}
+	}
+
+	l.pos++
+	return token{kind: tokenError, text: fmt.Sprintf("unexpected character %q", c), pos: start}
+}
+
+// parser is a recursive descent parser of the queries.
+type parser struct {
+	lexer lexer
+	token token
+}
+
+func (p *parser) next() {
+	p.token = p.lexer.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &QueryError{Query: p.lexer.input, Pos: p.token.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// expect consumes a punctuation token.
+func (p *parser) expect(punctuation string, context string) error {
+	if p.token.kind == tokenError {
+		return p.errorf("%s", p.token.text)
+	}
+	if p.token.kind != tokenPunctuation || p.token.text != punctuation {
+		return p.errorf("expected %q %s, found %s", punctuation, context, p.token)
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) is(punctuation string) bool {
+	return p.token.kind == tokenPunctuation && p.token.text == punctuation
+}
+
+// isSelector checks if a selector starts, with or without its name.
+func (p *parser) isSelector() bool {
+	return p.is("{") || (p.token.kind == tokenIdentifier && p.token.text == bytesName)
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	switch {
+	case p.token.kind == tokenError:
+		return nil, p.errorf("%s", p.token.text)
+
+	case p.is("("):
+		p.next()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")", "to close the parenthesis")
+
+	case p.isSelector():
+		return p.parseSelector()
+
+	case p.token.kind == tokenIdentifier:
+		name := p.token.text
+		for _, aggregation := range aggregationNames {
+			if name == aggregation {
+				return p.parseAggregation()
+			}
+		}
+		if name == "rate" {
+			return p.parseRate()
+		}
+		return nil, p.errorf("unknown function %q, expected one of %s", name, strings.Join(append(functionNames, aggregationNames...), ", "))
+
+	case p.token.kind == tokenEOF:
+		return nil, p.errorf("unexpected end of the query, expected a selector like {status=\"500\"}[5m] or a function")
+
+	default:
+		return nil, p.errorf("unexpected %s, expected a selector like {status=\"500\"}[5m] or a function", p.token)
+	}
+}
+
+// parseSelector parses `[bytes]{label="value", ...}[range]`.
+func (p *parser) parseSelector() (*selectorExpr, error) {
+	selector := &selectorExpr{}
+	if p.token.kind == tokenIdentifier && p.token.text == bytesName {
+		selector.bytes = true
+		p.next()
+	}
+	if err := p.expect("{", "to start the selector"); err != nil {
+		return nil, err
+	}
+
+	for !p.is("}") {
+		if p.token.kind != tokenIdentifier {
+			return nil, p.errorf("expected a label name in the selector, found %s", p.token)
+		}
+		m := Matcher{Name: p.token.text}
+		p.next()
+
+		if p.token.kind != tokenMatchOp {
+			return nil, p.errorf("expected one of =, !=, =~ or !~ after the label %s, found %s", m.Name, p.token)
+		}
+		m.Type = MatchType(p.token.text)
+		p.next()
+
+		if p.token.kind != tokenString {
+			return nil, p.errorf("expected a quoted value after %s%s, found %s", m.Name, m.Type, p.token)
+		}
+		value, err := unquoteString(p.token.text)
+		if err != nil {
+			return nil, p.errorf("invalid string %s: %v", p.token.text, err)
+		}
+		m.Value = value
+		if _, err := m.compile(); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		selector.matchers = append(selector.matchers, m)
+		p.next()
+
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect("}", "to close the selector"); err != nil {
+		return nil, err
+	}
+
+	if !p.is("[") {
+		return nil, p.errorf("expected a range after the selector, e.g [5m]: the hits are counted over a range")
+	}
+	p.next()
+	if p.token.kind != tokenNumber {
+		return nil, p.errorf("expected a range like 5m or 1h, found %s", p.token)
+	}
+	rng, err := parseRange(p.token.text)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	selector.rng = rng
+	p.next()
+
+	return selector, p.expect("]", "to close the range")
+}
+
+// parseRate parses `rate(selector[range])`.
+func (p *parser) parseRate() (Expr, error) {
+	p.next()
+	if err := p.expect("(", "after rate"); err != nil {
+		return nil, err
+	}
+	if !p.isSelector() {
+		return nil, p.errorf("rate expects a selector with a range, e.g rate({method=\"POST\"}[1m]), found %s", p.token)
+	}
+
+	selector, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateExpr{selector: selector}, p.expect(")", "to close rate")
+}
+
+// parseAggregation parses `op [by (labels)] ([k,] expr) [by (labels)]`, or `op [by (labels)] selector`.
+func (p *parser) parseAggregation() (Expr, error) {
+	e := &aggregateExpr{op: p.token.text}
+	p.next()
+
+	grouping, err := p.parseGrouping()
+	if err != nil {
+		return nil, err
+	}
+	e.grouping = grouping
+
+	if p.isSelector() {
+		if e.op == "topk" {
+			return nil, p.errorf("topk expects its parameter first, e.g topk(5, {status=\"500\"}[5m])")
+		}
+		if e.arg, err = p.parseSelector(); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	if err := p.expect("(", "after "+e.op); err != nil {
+		return nil, err
+	}
+	if e.op == "topk" {
+		if e.k, err = p.parseK(); err != nil {
+			return nil, err
+		}
+	}
+	if e.arg, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")", "to close "+e.op); err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == tokenIdentifier && p.token.text == "by" {
+		if e.grouping != nil {
+			return nil, p.errorf("the grouping of %s is already given", e.op)
+		}
+		if e.grouping, err = p.parseGrouping(); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// parseK parses the parameter of topk, followed by a comma.
+func (p *parser) parseK() (int, error) {
+	if p.token.kind != tokenNumber {
+		return 0, p.errorf("topk expects the number of values first, e.g topk(5, ...), found %s", p.token)
+	}
+	k, err := strconv.Atoi(p.token.text)
+	if err != nil || k <= 0 {
+		return 0, p.errorf("the parameter of topk must be a positive integer, found %s", p.token)
+	}
+	p.next()
+
+	return k, p.expect(",", "after the parameter of topk")
+}
+
+// parseGrouping parses an optional `by (label, ...)`.
+func (p *parser) parseGrouping() ([]string, error) {
+	if p.token.kind != tokenIdentifier || p.token.text != "by" {
+		return nil, nil
+	}
+	p.next()
+	if err := p.expect("(", "after by"); err != nil {
+		return nil, err
+	}
+
+	grouping := []string{}
+	for !p.is(")") {
+		if p.token.kind != tokenIdentifier {
+			return nil, p.errorf("expected a label name in by (...), found %s", p.token)
+		}
+		grouping = append(grouping, p.token.text)
+		p.next()
+
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	if len(grouping) == 0 {
+		return nil, p.errorf("expected at least a label name in by (...)")
+	}
+
+	return grouping, p.expect(")", "to close by (...)")
+}
+
+// unquoteString unquotes a string between double quotes, single quotes or backquotes.
+func unquoteString(s string) (string, error) {
+	if s[0] == '\'' {
+		// Convert it to a double quoted string.
+		inner := strings.Replace(s[1:len(s)-1], `\'`, `'`, -1)
+		s = `"` + strings.Replace(inner, `"`, `\"`, -1) + `"`
+	}
+
+	return strconv.Unquote(s)
+}
+
+// parseRange parses a duration like "5m" or "1h30m", and also accepts the days ("1d") and weeks ("2w").
+func parseRange(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	var rng time.Duration
+	if unit > 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q", s)
+		}
+		rng = time.Duration(n) * unit
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q, expected a duration like 5m or 1h", s)
+		}
+		rng = d
+	}
+
+	if rng < time.Second || rng%time.Second != 0 {
+		return 0, fmt.Errorf("the range %q must be a positive number of seconds", s)
+	}
+
+	return rng, nil
+}
+
+// formatRange formats a range with the shortest unit, e.g "5m" instead of "5m0s".
+func formatRange(d time.Duration) string {
+	for _, unit := range []struct {
+		suffix   string
+		duration time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}} {
+		if d%unit.duration == 0 {
+			return fmt.Sprintf("%d%s", d/unit.duration, unit.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// evaluator evaluates the queries at a given time, the ranges end with it.
+type evaluator struct {
+	db   Storage
+	time int64
+}
+
+// Evaluate evaluates a query at a given time, the ranges of the selectors end with it. The results are sorted
+// descending by value.
+func Evaluate(db Storage, expr Expr, t time.Time) (GroupList, error) {
+	result, err := expr.eval(&evaluator{db: db, time: t.Unix()})
+	if err != nil {
+		return nil, err
+	}
+
+	sortGroups(result)
+	return result, nil
+}
+
+// query selects the entries of a selector, grouped by the labels or by series if "bySeries" is set.
+func (ev *evaluator) query(e *selectorExpr, grouping []string, bySeries bool) (GroupList, error) {
+	return ev.db.Query(Query{
+		Matchers:      e.matchers,
+		GroupBy:       grouping,
+		GroupBySeries: bySeries,
+		Since:         ev.time - int64(e.rng/time.Second),
+		Until:         ev.time,
+		Bytes:         e.bytes,
+	})
+}
+
+func (e *selectorExpr) eval(ev *evaluator) (GroupList, error) {
+	return ev.query(e, nil, true)
+}
+
+func (e *rateExpr) eval(ev *evaluator) (GroupList, error) {
+	result, err := ev.query(e.selector, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := e.selector.rng.Seconds()
+	for i := range result {
+		result[i].Value /= seconds
+	}
+
+	return result, nil
+}
+
+func (e *aggregateExpr) eval(ev *evaluator) (GroupList, error) {
+	// The hits of a selector are grouped by the storage. count counts the hits of the entries, even with their bytes.
+	if selector, ok := e.arg.(*selectorExpr); ok && e.op != "topk" {
+		counted := *selector
+		counted.bytes = selector.bytes && e.op == "sum"
+		return ev.query(&counted, e.grouping, false)
+	}
+
+	values, err := e.arg.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]GroupList)
+	var keys []string
+	for _, value := range values {
+		key := groupingKey(value.Labels, e.grouping)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], value)
+	}
+
+	var result GroupList
+	for _, key := range keys {
+		group := groups[key]
+		switch e.op {
+		case "topk":
+			sortGroups(group)
+			if len(group) > e.k {
+				group = group[:e.k]
+			}
+			result = append(result, group...)
+		case "sum", "count":
+			aggregated := Group{Labels: make(map[string]string, len(e.grouping))}
+			for _, name := range e.grouping {
+				aggregated.Labels[name] = group[0].Labels[name]
+			}
+			for _, value := range group {
+				if e.op == "sum" {
+					aggregated.Value += value.Value
+				} else {
+					aggregated.Value++
+				}
+			}
+			result = append(result, aggregated)
+		}
+	}
+
+	return result, nil
+}
+
+// groupingKey identifies the group of a value, by the values of the grouping labels.
+func groupingKey(groupLabels map[string]string, grouping []string) string {
+	values := make([]string, len(grouping))
+	for i, name := range grouping {
+		values[i] = groupLabels[name]
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// sortGroups sorts the groups descending by value, then by labels.
+func sortGroups(groups GroupList) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		if vi, vj := groups[i].Value, groups[j].Value; vi != vj {
+			return vi > vj
+		}
+		return groups[i].String() < groups[j].String()
+	})
+}
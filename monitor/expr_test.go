@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpr(t *testing.T) {
+	for query, expected := range map[string]string{
+		`{status="500"}[5m]`:        `{status="500"}[5m]`,
+		`{}[90s]`:                   `{}[90s]`,
+		`rate({method="POST"}[1m])`: `rate({method="POST"}[1m])`,
+		`topk(5, count by (section) {status=~"5.."}[5m])`:      `topk (5, count by (section) ({status=~"5.."}[5m]))`,
+		`count by(section)({status=~'5..', host!="a"}[1h30m])`: `count by (section) ({status=~"5..", host!="a"}[90m])`,
+		"sum(rate({url!~`/static/.*`,}[1d])) by (host, user)":  `sum by (host, user) (rate({url!~"/static/.*"}[1d]))`,
+		`topk by (status) (3, (rate({}[2w])))`:                 `topk by (status) (3, rate({}[2w]))`,
+		`count(rate({method="GET"}[5m]))`:                      `count (rate({method="GET"}[5m]))`,
+		`sum by (section) bytes{status="200"}[1h]`:             `sum by (section) (bytes{status="200"}[1h])`,
+		`rate(bytes{}[1m])`:                                    `rate(bytes{}[1m])`,
+	} {
+		expr, err := ParseExpr(query)
+		require.Nil(t, err, "Unexpected error raised for %s", query)
+		require.Equal(t, expected, expr.String(), "Unexpected expression for %s", query)
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, test := range []struct {
+		query   string
+		pos     int
+		message string
+	}{
+		{``, 0, "unexpected end of the query"},
+		{`{status="500"}`, 14, "expected a range after the selector"},
+		{`{status=500}[5m]`, 8, `expected a quoted value after status=, found "500"`},
+		{`{status~"500"}[5m]`, 7, `unexpected character '~'`},
+		{`{status="500"[5m]`, 13, `expected "}" to close the selector, found "["`},
+		{`{status="500"}[5]`, 15, `invalid range "5"`},
+		{`{status="500"}[500ms]`, 15, `must be a positive number of seconds`},
+		{`{status=~"("}[5m]`, 9, "invalid matcher"},
+		{`{status="500}[5m]`, 8, "unterminated string"},
+		{`cont by (section) ({}[5m])`, 0, `unknown function "cont", expected one of rate, count, sum, topk`},
+		{`topk({}[5m])`, 5, "topk expects the number of values first"},
+		{`topk(0, {}[5m])`, 5, "must be a positive integer"},
+		{`topk {}[5m]`, 5, "topk expects its parameter first"},
+		{`rate(count({}[5m]))`, 5, "rate expects a selector with a range"},
+		{`sum by () ({}[5m])`, 8, "expected at least a label name"},
+		{`sum by (section) ({}[5m]) by (host)`, 26, "the grouping of sum is already given"},
+		{`sum({}[5m])) `, 11, `unexpected ")" after the end of the expression`},
+		{`(rate({}[5m])`, 13, `expected ")" to close the parenthesis, found end of the query`},
+	} {
+		_, err := ParseExpr(test.query)
+		require.NotNil(t, err, "An error should be raised for %s", test.query)
+		require.IsType(t, &QueryError{}, err)
+		require.Equal(t, test.pos, err.(*QueryError).Pos, "Unexpected position for %s: %v", test.query, err)
+		require.Contains(t, err.(*QueryError).Msg, test.message, "Unexpected error for %s", test.query)
+	}
+
+	_, err := ParseExpr(`sum({}[5m] `)
+	require.Equal(t, "parse error at position 12: expected \")\" to close sum, found end of the query\nsum({}[5m] \n           ^", err.Error())
+}
+
+func TestEvaluate(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	for name, storage := range map[string]Storage{"tsdb": db, "memory": NewMemoryStorage(time.Hour, LabelConfig{})} {
+		now := time.Unix(time.Now().Unix(), 0)
+		entry := func(method string, url string, status int, ago time.Duration) *LoggingEntry {
+			entry := testEntry("james", now.Add(-ago))
+			entry.Request.Method, entry.Request.URL, entry.Status = method, url, status
+			return entry
+		}
+		_, err := storage.AddEntries([]*LoggingEntry{
+			entry("GET", "/report/user", 500, 2*time.Minute),
+			entry("GET", "/report/user", 500, time.Minute),
+			entry("POST", "/report/user", 503, time.Minute),
+			entry("POST", "/home", 500, 30*time.Second),
+			entry("POST", "/home", 200, 30*time.Second),
+			entry("GET", "/api/v1", 404, 20*time.Second),
+			entry("GET", "/api/v1", 500, 10*time.Minute),
+		})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+
+		evaluate := func(query string) GroupList {
+			expr, err := ParseExpr(query)
+			require.Nil(t, err, "Unexpected error raised for %s", query)
+			result, err := Evaluate(storage, expr, now)
+			require.Nil(t, err, "Unexpected error raised for %s with %s", query, name)
+			return result
+		}
+		section := func(section string, value float64) Group {
+			return Group{Labels: map[string]string{RequestURLSectionLabel: section}, Value: value}
+		}
+
+		require.Equal(t, GroupList{section("/report", 3), section("/home", 1)},
+			evaluate(`count by (section) {status=~"5.."}[5m]`), "Unexpected result for %s", name)
+		require.Equal(t, GroupList{section("/report", 3)},
+			evaluate(`topk(1, count by (section) ({status=~"5.."}[5m]))`), "Unexpected result for %s", name)
+		require.Equal(t, GroupList{{Labels: map[string]string{}, Value: 4}},
+			evaluate(`sum({status=~"5.."}[5m])`), "Unexpected result for %s", name)
+		require.Equal(t, GroupList{{Labels: map[string]string{}, Value: 5}},
+			evaluate(`sum({status=~"5.."}[1h])`), "Unexpected result for %s", name)
+
+		// rate gives the hits per second of each series.
+		rates := evaluate(`rate({method="POST"}[1m])`)
+		require.Len(t, rates, 3, "Unexpected result for %s", name)
+		for _, rate := range rates {
+			require.Equal(t, 1.0/60, rate.Value, "Unexpected rate for %s", name)
+			require.Equal(t, "POST", rate.Labels[RequestMethodLabel], "Unexpected labels for %s", name)
+			require.Equal(t, "james", rate.Labels[UserLabel], "Unexpected labels for %s", name)
+		}
+		require.Equal(t, GroupList{section("/home", 2.0/60), section("/report", 1.0/60)},
+			evaluate(`sum by (section) (rate({method="POST"}[1m]))`), "Unexpected result for %s", name)
+		require.Equal(t, GroupList{{Labels: map[string]string{}, Value: 3}},
+			evaluate(`count(rate({method="POST"}[1m]))`), "Unexpected result for %s", name)
+
+		topk := evaluate(`topk by (method) (1, count by (method, status) ({}[5m]))`)
+		require.Equal(t, GroupList{
+			{Labels: map[string]string{RequestMethodLabel: "GET", StatusLabel: "500"}, Value: 2},
+			{Labels: map[string]string{RequestMethodLabel: "POST", StatusLabel: "200"}, Value: 1},
+		}, topk, "Unexpected result for %s", name)
+
+		require.Empty(t, evaluate(`count by (section) {status="302"}[5m]`), "Unexpected result for %s", name)
+
+		// A bytes selector adds up the bytes of the entries, but count still counts their hits.
+		require.Equal(t, GroupList{section("/report", 3*123), section("/home", 123)},
+			evaluate(`sum by (section) bytes{status=~"5.."}[5m]`), "Unexpected result for %s", name)
+		require.Equal(t, GroupList{section("/report", 3), section("/home", 1)},
+			evaluate(`count by (section) bytes{status=~"5.."}[5m]`), "Unexpected result for %s", name)
+		require.Equal(t, GroupList{{Labels: map[string]string{}, Value: 2 * 123.0 / 60}},
+			evaluate(`sum(rate(bytes{method="POST", section="/home"}[1m]))`), "Unexpected result for %s", name)
+	}
+}
+
+func TestAPIQuery(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithDatabase(DatabaseConfig{Storage: StorageMemory}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	now := time.Unix(time.Now().Unix(), 0)
+	_, err = m.db.AddEntries([]*LoggingEntry{testEntry("james", now.Add(-time.Minute)), testEntry("jill", now), testEntry("jill", now)})
+	require.Nil(t, err, "Unexpected error raised")
+
+	query := func(params url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		NewAPI(m).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query?"+params.Encode(), nil))
+		return recorder
+	}
+
+	recorder := query(url.Values{"query": {`topk(1, count by (user) {}[5m])`}, "time": {strconv.FormatInt(now.Unix(), 10)}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result QueryResult
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	require.Equal(t, QueryResult{
+		Query:  `topk (1, count by (user) ({}[5m]))`,
+		Time:   now.Unix(),
+		Result: GroupList{{Labels: map[string]string{UserLabel: "jill"}, Value: 2}},
+	}, result)
+
+	recorder = query(url.Values{"query": {`count by (user) {}[5m`}})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "parse error at position 22")
+
+	require.Equal(t, http.StatusBadRequest, query(url.Values{"query": {`count({}[5m])`}, "time": {"noon"}}).Code)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package monitor
+
+import (
+	"os"
+	"syscall"
+)
+
+// getFileID returns the device and inode of a file.
+func getFileID(info os.FileInfo) fileID {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+
+	return fileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}
+}
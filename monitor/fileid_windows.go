@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package monitor
+
+import (
+	"os"
+)
+
+// getFileID is not supported on Windows, so the renamed files can't be detected. Only the truncation is handled.
+func getFileID(info os.FileInfo) fileID {
+	return fileID{}
+}
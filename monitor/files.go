@@ -0,0 +1,347 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// globRescanInterval is how often the glob patterns are matched again to discover new files.
+	globRescanInterval = 10 * time.Second
+	// followPollInterval is how often a file is checked for new data, rotation or truncation.
+	followPollInterval = 250 * time.Millisecond
+)
+
+// logLine is a raw line read from a logging source.
+type logLine struct {
+	source string
+	text   string
+	// labels are added to the entry parsed from the line.
+	labels map[string]string
+	// position is where the line ends in its file.
+	position Position
+}
+
+// isGlob reports whether the path contains any of the special characters recognized by filepath.Match.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// matchFiles returns the files matching the patterns. The paths without special characters are returned as they are,
+// even if the files don't exist yet.
+func matchFiles(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if isGlob(pattern) {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// followFiles follows all the files matching the patterns and sends their lines. The patterns are matched again
+// periodically, so the files created later are picked up too. If a checkpoint is given, each file is resumed from
+// its saved position. The files found by the first scan without a saved position are backfilled with their last
+// "backfill" rotated files before any file is followed, see backfillFiles. The named pipes are read as they are
+// written. The method is blocking.
+func followFiles(ctx context.Context, patterns []string, checkpoint *Checkpoint, backfill int, lines chan<- logLine) error {
+	errg, ctx := errgroup.WithContext(ctx)
+	followed := make(map[string]bool)
+
+	errg.Go(func() error {
+		for first := true; ; first = false {
+			files, err := matchFiles(patterns)
+			if err != nil {
+				return err
+			}
+
+			var followers, backfilled []*fileFollower
+			for _, file := range files {
+				if followed[file] {
+					continue
+				}
+				followed[file] = true
+
+				if isNamedPipe(file) {
+					file := file
+					errg.Go(func() error {
+						return readPipe(ctx, file, lines)
+					})
+					continue
+				}
+
+				follower := &fileFollower{path: file, lines: lines}
+				if checkpoint != nil {
+					if position, ok := checkpoint.Get(file); ok {
+						follower.start = &position
+					}
+				}
+				if first && follower.start == nil && backfill > 0 {
+					backfilled = append(backfilled, follower)
+				}
+				followers = append(followers, follower)
+			}
+
+			if len(backfilled) > 0 {
+				if err := backfillFiles(ctx, backfilled, backfill, lines); err != nil || ctx.Err() != nil {
+					return err
+				}
+			}
+			for _, follower := range followers {
+				follower := follower
+				errg.Go(func() error {
+					return follower.run(ctx)
+				})
+			}
+
+			select {
+			case <-time.After(globRescanInterval):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+
+	return errg.Wait()
+}
+
+// fileFollower reads the lines appended to a file, like "tail -F".
+// When the file is renamed (e.g by logrotate), the old file is drained before switching to the new one. When the file
+// is truncated in place (e.g copytruncate), it's read again from the beginning.
+type fileFollower struct {
+	path  string
+	lines chan<- logLine
+	// start is the position where the reading is resumed.
+	start *Position
+
+	file    *os.File
+	reader  *bufio.Reader
+	id      fileID
+	offset  int64
+	partial string
+}
+
+// run follows the file until the context is done.
+func (f *fileFollower) run(ctx context.Context) error {
+	defer f.close()
+
+	if err := f.resume(ctx); err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	for {
+		if err := f.readLines(ctx); err != nil || ctx.Err() != nil {
+			return err
+		}
+
+		info, err := os.Stat(f.path)
+		switch {
+		case err != nil && !os.IsNotExist(err):
+			return err
+		case os.IsNotExist(err) || getFileID(info) != f.id:
+			// The file was renamed or removed: drain the old file, then switch to the new one.
+			if err := f.drain(ctx); err != nil || ctx.Err() != nil {
+				return err
+			}
+			if err := f.open(ctx, 0); err != nil || ctx.Err() != nil {
+				return err
+			}
+			continue
+		case info.Size() < f.offset+int64(len(f.partial)):
+			// The file was truncated.
+			if err := f.seek(0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-time.After(followPollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// resume opens the file at the start position. If the file was rotated since the position was saved, the rest of
+// the rotated file is read first, when it can be found next to the file (e.g "access.log.1").
+func (f *fileFollower) resume(ctx context.Context) error {
+	if f.start == nil {
+		return f.open(ctx, 0)
+	}
+
+	info, err := os.Stat(f.path)
+	if err == nil && getFileID(info) == f.start.File {
+		offset := f.start.Offset
+		if offset > info.Size() {
+			// Truncated while the monitoring was stopped.
+			offset = 0
+		}
+		return f.open(ctx, offset)
+	}
+
+	if rotated := findRotatedFile(f.path, f.start.File); rotated != "" {
+		file, err := os.Open(rotated)
+		if err != nil {
+			return err
+		}
+		f.setFile(file, f.start.File)
+		if err := f.seek(f.start.Offset); err != nil {
+			return err
+		}
+		if err := f.drain(ctx); err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return f.open(ctx, 0)
+}
+
+// open waits for the file to exist, then opens it at the given offset.
+func (f *fileFollower) open(ctx context.Context, offset int64) error {
+	f.close()
+
+	for {
+		file, err := os.Open(f.path)
+		if err == nil {
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return err
+			}
+
+			f.setFile(file, getFileID(info))
+			return f.seek(offset)
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(followPollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (f *fileFollower) setFile(file *os.File, id fileID) {
+	f.close()
+	f.file = file
+	f.id = id
+	f.reader = bufio.NewReaderSize(file, 64*1024)
+}
+
+func (f *fileFollower) seek(offset int64) error {
+	if _, err := f.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	f.reader.Reset(f.file)
+	f.offset = offset
+	f.partial = ""
+	return nil
+}
+
+// readLines sends the complete lines available in the file. An incomplete last line is kept until it's completed.
+func (f *fileFollower) readLines(ctx context.Context) error {
+	for {
+		data, err := f.reader.ReadString('\n')
+		if err == io.EOF {
+			f.partial += data
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		text := strings.TrimRight(f.partial+data, "\r\n")
+		f.offset += int64(len(f.partial) + len(data))
+		f.partial = ""
+
+		if !f.send(ctx, text) {
+			return nil
+		}
+	}
+}
+
+// drain reads the rest of the current file, including an incomplete last line.
+func (f *fileFollower) drain(ctx context.Context) error {
+	if err := f.readLines(ctx); err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	if f.partial != "" {
+		text := f.partial
+		f.offset += int64(len(f.partial))
+		f.partial = ""
+		f.send(ctx, text)
+	}
+
+	return nil
+}
+
+func (f *fileFollower) send(ctx context.Context, text string) bool {
+	line := logLine{source: f.path, text: text, position: Position{File: f.id, Offset: f.offset}}
+
+	select {
+	case f.lines <- line:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (f *fileFollower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// findRotatedFile looks for the file with the given id next to path (e.g "access.log.1"). Compressed files are ignored.
+func findRotatedFile(path string, id fileID) string {
+	if id == (fileID{}) {
+		return ""
+	}
+
+	candidates, err := filepath.Glob(path + "*")
+	if err != nil {
+		return ""
+	}
+
+	for _, candidate := range candidates {
+		if candidate == path || strings.HasSuffix(candidate, ".gz") || strings.HasSuffix(candidate, ".zst") {
+			continue
+		}
+
+		info, err := os.Stat(candidate)
+		if err == nil && getFileID(info) == id {
+			return candidate
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,217 @@
+package monitor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func receiveLines(t *testing.T, lines <-chan logLine, count int) []logLine {
+	var received []logLine
+	for len(received) < count {
+		select {
+		case line := <-lines:
+			received = append(received, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout while waiting for lines, received %v", received)
+		}
+	}
+
+	return received
+}
+
+func texts(lines []logLine) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, line.text)
+	}
+
+	return result
+}
+
+func appendToFile(t *testing.T, path string, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	require.Nil(t, err, "Unexpected error raised")
+	defer f.Close()
+
+	_, err = f.WriteString(data)
+	require.Nil(t, err, "Unexpected error raised")
+}
+
+// startFollower follows a file in background. The returned function stops the follower.
+func startFollower(t *testing.T, path string, start *Position) (<-chan logLine, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan logLine)
+	done := make(chan error)
+
+	follower := &fileFollower{path: path, lines: lines, start: start}
+	go func() {
+		done <- follower.run(ctx)
+	}()
+
+	return lines, func() {
+		cancel()
+		require.Nil(t, <-done)
+	}
+}
+
+func TestMatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.access.log", "b.access.log", "error.log"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	missing := filepath.Join(dir, "missing.log")
+	files, err := matchFiles([]string{filepath.Join(dir, "*.access.log"), missing, filepath.Join(dir, "a.*")})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{filepath.Join(dir, "a.access.log"), filepath.Join(dir, "b.access.log"), missing}, files)
+}
+
+func TestFollowFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	rescan := globRescanInterval
+	globRescanInterval = 50 * time.Millisecond
+	defer func() { globRescanInterval = rescan }()
+
+	first := filepath.Join(dir, "a.access.log")
+	require.Nil(t, ioutil.WriteFile(first, []byte("first\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan logLine)
+	done := make(chan error)
+	go func() {
+		done <- followFiles(ctx, []string{filepath.Join(dir, "*.access.log")}, nil, 0, lines)
+	}()
+
+	// A file created later is picked up by the next scan.
+	second := filepath.Join(dir, "b.access.log")
+	require.Nil(t, ioutil.WriteFile(second, []byte("second\n"), 0644))
+
+	received := receiveLines(t, lines, 2)
+	sort.Slice(received, func(i, j int) bool { return received[i].source < received[j].source })
+	require.Equal(t, first, received[0].source)
+	require.Equal(t, "first", received[0].text)
+	require.Equal(t, second, received[1].source)
+	require.Equal(t, "second", received[1].text)
+
+	cancel()
+	require.Nil(t, <-done)
+}
+
+func TestFileFollowerRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "first\n")
+
+	lines, stop := startFollower(t, path, nil)
+	defer stop()
+	require.Equal(t, []string{"first"}, texts(receiveLines(t, lines, 1)))
+
+	// The writer keeps writing into the renamed file until it reopens the log.
+	require.Nil(t, os.Rename(path, path+".1"))
+	appendToFile(t, path+".1", "second\nincomplete")
+	appendToFile(t, path, "third\n")
+
+	require.Equal(t, []string{"second", "incomplete", "third"}, texts(receiveLines(t, lines, 3)))
+}
+
+func TestFileFollowerTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "first line\nsecond line\n")
+
+	lines, stop := startFollower(t, path, nil)
+	defer stop()
+	require.Equal(t, []string{"first line", "second line"}, texts(receiveLines(t, lines, 2)))
+
+	require.Nil(t, os.Truncate(path, 0))
+	time.Sleep(2 * followPollInterval)
+	appendToFile(t, path, "third\n")
+
+	received := receiveLines(t, lines, 1)
+	require.Equal(t, []string{"third"}, texts(received))
+	require.Equal(t, int64(len("third\n")), received[0].position.Offset)
+}
+
+func TestFileFollowerResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "first\nsecond\n")
+
+	lines, stop := startFollower(t, path, nil)
+	received := receiveLines(t, lines, 1)
+	stop()
+
+	require.Equal(t, []string{"first"}, texts(received))
+	require.Equal(t, int64(len("first\n")), received[0].position.Offset)
+
+	// Restart from the position of the last processed line.
+	lines, stop = startFollower(t, path, &received[0].position)
+	defer stop()
+	require.Equal(t, []string{"second"}, texts(receiveLines(t, lines, 1)))
+}
+
+func TestFileFollowerResumeAfterRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "first\nsecond\n")
+
+	info, err := os.Stat(path)
+	require.Nil(t, err, "Unexpected error raised")
+	position := &Position{File: getFileID(info), Offset: int64(len("first\n"))}
+
+	// The file is rotated while the monitoring is stopped.
+	require.Nil(t, os.Rename(path, path+".1"))
+	appendToFile(t, path, "third\n")
+
+	lines, stop := startFollower(t, path, position)
+	defer stop()
+	require.Equal(t, []string{"second", "third"}, texts(receiveLines(t, lines, 2)))
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "offsets.json")
+	checkpoint, err := LoadCheckpoint(path)
+	require.Nil(t, err, "A missing checkpoint should be empty")
+
+	position := Position{File: fileID{Device: 1, Inode: 2}, Offset: 42}
+	checkpoint.Update("/var/log/access.log", position)
+	require.Nil(t, checkpoint.Save())
+
+	loaded, err := LoadCheckpoint(path)
+	require.Nil(t, err, "Unexpected error raised")
+	saved, ok := loaded.Get("/var/log/access.log")
+	require.True(t, ok, "The position should be saved")
+	require.Equal(t, position, saved)
+
+	_, ok = loaded.Get("/var/log/other.log")
+	require.False(t, ok)
+}
@@ -0,0 +1,244 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AlertNameLabel can be used in GroupConfig.GroupBy to group the events by alert name.
+	AlertNameLabel = "alertname"
+
+	defaultGroupWait      = 10 * time.Second
+	defaultGroupInterval  = 30 * time.Second
+	defaultRepeatInterval = time.Hour
+	groupTick             = time.Second
+)
+
+// GroupConfig describes how the alert events are grouped before being sent to the notifiers.
+type GroupConfig struct {
+	// GroupBy lists the labels whose values identify a group. An empty list puts all the events in the same group.
+	GroupBy []string `json:"group_by"`
+	// GroupWait is how long to wait before sending the first notification of a new group.
+	GroupWait Duration `json:"group_wait"`
+	// GroupInterval is how long to wait before notifying about changes in a group already notified.
+	GroupInterval Duration `json:"group_interval"`
+	// RepeatInterval is how long to wait before sending again a notification for a group still firing.
+	RepeatInterval Duration `json:"repeat_interval"`
+}
+
+// Validate checks the grouping configuration.
+func (c *GroupConfig) Validate() error {
+	if c.GroupWait < 0 || c.GroupInterval < 0 || c.RepeatInterval < 0 {
+		return errors.New("group intervals must not be negative")
+	}
+
+	return nil
+}
+
+func (c *GroupConfig) withDefaults() GroupConfig {
+	config := *c
+	if config.GroupWait == 0 {
+		config.GroupWait = Duration(defaultGroupWait)
+	}
+	if config.GroupInterval == 0 {
+		config.GroupInterval = Duration(defaultGroupInterval)
+	}
+	if config.RepeatInterval == 0 {
+		config.RepeatInterval = Duration(defaultRepeatInterval)
+	}
+
+	return config
+}
+
+// alertGroup holds the latest event of each alert from a group.
+type alertGroup struct {
+	labels   map[string]string
+	alerts   map[string]*AlertEvent
+	created  time.Time
+	lastSent time.Time
+	changed  bool
+}
+
+// Grouper aggregates the alert events into groups and sends one notification per group.
+// The events of a new group are sent after GroupWait, the later changes at most once every GroupInterval and
+// the groups with firing alerts are notified again every RepeatInterval.
+type Grouper struct {
+	config GroupConfig
+	next   Notifier
+	now    func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*alertGroup
+}
+
+// NewGrouper is used to create a grouping stage in front of the "next" notifier.
+func NewGrouper(config GroupConfig, next Notifier) *Grouper {
+	return &Grouper{
+		config: config.withDefaults(),
+		next:   next,
+		now:    time.Now,
+		groups: make(map[string]*alertGroup),
+	}
+}
+
+// Notify adds the events to their groups. The notifications are sent later, by Run.
+func (g *Grouper) Notify(n *Notification) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, event := range n.Alerts {
+		labels := g.groupLabels(event)
+		key := groupKey(labels)
+
+		group, ok := g.groups[key]
+		if !ok {
+			group = &alertGroup{labels: labels, alerts: make(map[string]*AlertEvent), created: g.now()}
+			g.groups[key] = group
+		}
+
+		group.alerts[event.Name] = event
+		group.changed = true
+	}
+
+	return nil
+}
+
+// Run periodically flushes the groups. The method is blocking.
+func (g *Grouper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(groupTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.flush()
+		case <-ctx.Done():
+			fmt.Println("Stop grouping alerts")
+			return nil
+		}
+	}
+}
+
+// flush sends the notifications for the groups that are due. A group is updated only once its notification is
+// delivered, a failed notification is sent again after GroupInterval.
+func (g *Grouper) flush() {
+	now := g.now()
+	for _, n := range g.due(now) {
+		err := g.next.Notify(n)
+		if err != nil {
+			// Delivery failures shouldn't stop the monitoring.
+			fmt.Printf("Failed to send notification for group %s: %v\n", groupKey(n.GroupLabels), err)
+		}
+		g.sent(n, now, err == nil)
+	}
+}
+
+// due collects the notifications to send, without updating the groups.
+func (g *Grouper) due(now time.Time) []*Notification {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	keys := make([]string, 0, len(g.groups))
+	for key := range g.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []*Notification
+	for _, key := range keys {
+		group := g.groups[key]
+
+		var send bool
+		switch {
+		case group.lastSent.IsZero():
+			send = group.changed && now.Sub(group.created) >= time.Duration(g.config.GroupWait)
+		case group.changed:
+			send = now.Sub(group.lastSent) >= time.Duration(g.config.GroupInterval)
+		default:
+			send = now.Sub(group.lastSent) >= time.Duration(g.config.RepeatInterval)
+		}
+
+		if !send {
+			continue
+		}
+
+		n := &Notification{GroupLabels: group.labels}
+		for _, event := range group.alerts {
+			n.Alerts = append(n.Alerts, event)
+		}
+		sort.Slice(n.Alerts, func(i, j int) bool { return n.Alerts[i].Name < n.Alerts[j].Name })
+		result = append(result, n)
+	}
+
+	return result
+}
+
+// sent updates the group of a notification after an attempt to send it. The group stays changed if the notification
+// failed or if new events were added in the meantime.
+func (g *Grouper) sent(n *Notification, now time.Time, delivered bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := groupKey(n.GroupLabels)
+	group, ok := g.groups[key]
+	if !ok {
+		return
+	}
+
+	// lastSent is the time of the last attempt, the failed notifications are retried after GroupInterval.
+	group.lastSent = now
+	if !delivered {
+		return
+	}
+
+	sentEvents := make(map[string]*AlertEvent, len(n.Alerts))
+	for _, event := range n.Alerts {
+		sentEvents[event.Name] = event
+	}
+
+	group.changed = false
+	for name, event := range group.alerts {
+		if sentEvents[name] != event {
+			group.changed = true
+			continue
+		}
+		// The resolved alerts are notified only once.
+		if !event.Firing() {
+			delete(group.alerts, name)
+		}
+	}
+	if len(group.alerts) == 0 {
+		delete(g.groups, key)
+	}
+}
+
+// groupLabels returns the values of the GroupBy labels for an event.
+func (g *Grouper) groupLabels(event *AlertEvent) map[string]string {
+	labels := make(map[string]string, len(g.config.GroupBy))
+	for _, name := range g.config.GroupBy {
+		if name == AlertNameLabel {
+			labels[name] = event.Name
+			continue
+		}
+		labels[name] = event.Labels[name]
+	}
+
+	return labels
+}
+
+// groupKey builds a string identifying the labels (e.g "alertname=traffic,team=web").
+func groupKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestGrouper(groupBy ...string) (*Grouper, *recordingNotifier, *fakeClock) {
+	clock := &fakeClock{now: ruleTestStart}
+	notifier := &recordingNotifier{}
+	config := GroupConfig{
+		GroupBy:        groupBy,
+		GroupWait:      Duration(10 * time.Second),
+		GroupInterval:  Duration(time.Minute),
+		RepeatInterval: Duration(time.Hour),
+	}
+
+	grouper := NewGrouper(config, notifier)
+	grouper.now = clock.Now
+
+	return grouper, notifier, clock
+}
+
+func event(name string, status Status, labels map[string]string) *Notification {
+	return &Notification{Alerts: []*AlertEvent{{Name: name, Status: status, Labels: labels}}}
+}
+
+func TestGrouperCombinesEvents(t *testing.T) {
+	grouper, notifier, clock := newTestGrouper("team")
+	web := map[string]string{"team": "web"}
+
+	require.Nil(t, grouper.Notify(event("b", Critical, web)))
+	clock.Advance(2 * time.Second)
+	require.Nil(t, grouper.Notify(event("a", Critical, web)))
+	require.Nil(t, grouper.Notify(event("c", Critical, map[string]string{"team": "db"})))
+
+	grouper.flush()
+	require.Empty(t, notifier.notifications, "Nothing should be sent before the group wait")
+
+	clock.Advance(8 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 1, "Only the first group should be due")
+
+	webGroup := notifier.notifications[0]
+	require.Equal(t, web, webGroup.GroupLabels)
+	require.Len(t, webGroup.Alerts, 2, "The events of the same group should be combined")
+	require.Equal(t, "a", webGroup.Alerts[0].Name)
+	require.Equal(t, "b", webGroup.Alerts[1].Name)
+
+	clock.Advance(2 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 2, "The second group should be due")
+
+	dbGroup := notifier.notifications[1]
+	require.Equal(t, map[string]string{"team": "db"}, dbGroup.GroupLabels)
+	require.Len(t, dbGroup.Alerts, 1)
+}
+
+func TestGrouperGroupInterval(t *testing.T) {
+	grouper, notifier, clock := newTestGrouper(AlertNameLabel)
+
+	require.Nil(t, grouper.Notify(event("a", Critical, nil)))
+	clock.Advance(10 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 1)
+	require.Equal(t, map[string]string{AlertNameLabel: "a"}, notifier.notifications[0].GroupLabels)
+
+	require.Nil(t, grouper.Notify(event("a", OK, nil)))
+	clock.Advance(30 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 1, "Changes should wait for the group interval")
+
+	clock.Advance(30 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 2, "Changes should be sent after the group interval")
+	require.Equal(t, OK, notifier.notifications[1].Alerts[0].Status)
+
+	clock.Advance(2 * time.Hour)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 2, "Resolved groups should be dropped")
+}
+
+func TestGrouperRepeatInterval(t *testing.T) {
+	grouper, notifier, clock := newTestGrouper()
+
+	require.Nil(t, grouper.Notify(event("a", Critical, nil)))
+	clock.Advance(10 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 1)
+
+	clock.Advance(30 * time.Minute)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 1, "Firing groups shouldn't be repeated before the repeat interval")
+
+	clock.Advance(30 * time.Minute)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 2, "Firing groups should be repeated after the repeat interval")
+	require.Equal(t, "a", notifier.notifications[1].Alerts[0].Name)
+}
+
+func TestGrouperFailedNotification(t *testing.T) {
+	grouper, notifier, clock := newTestGrouper(AlertNameLabel)
+
+	require.Nil(t, grouper.Notify(event("a", Critical, nil)))
+	clock.Advance(10 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 1)
+
+	// The resolved event fails once and is kept until it's delivered.
+	notifier.err = errors.New("failure")
+	require.Nil(t, grouper.Notify(event("a", OK, nil)))
+	clock.Advance(time.Minute)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 2)
+
+	notifier.err = nil
+	clock.Advance(30 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 2, "Failed notifications should be retried after the group interval")
+
+	clock.Advance(30 * time.Second)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 3, "Failed notifications should be retried")
+	require.Equal(t, OK, notifier.notifications[2].Alerts[0].Status)
+
+	clock.Advance(2 * time.Hour)
+	grouper.flush()
+	require.Len(t, notifier.notifications, 3, "Resolved groups should be dropped once delivered")
+}
+
+func TestGroupKey(t *testing.T) {
+	require.Equal(t, "", groupKey(nil))
+	require.Equal(t, "alertname=traffic,team=web", groupKey(map[string]string{"team": "web", AlertNameLabel: "traffic"}))
+}
@@ -0,0 +1,220 @@
+package monitor
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// topBucket is the duration of the buckets of the heavy hitters, in seconds.
+	topBucket = 60
+	// topCapacity is the number of values counted by label and bucket. A count is off by at most the hits of the
+	// bucket divided by the capacity, and the values with more hits than that are always counted.
+	topCapacity = 100
+)
+
+// DefaultTopLabels are the labels whose heavy hitters are tracked by default, used by the command line: the labels of
+// the top values of the stats and of the alerts.
+var DefaultTopLabels = []string{RequestURLSectionLabel, RouteLabel, UserLabel, HostLabel}
+
+// hitter is a value counted by a Space-Saving sketch.
+type hitter struct {
+	value string
+	hits  float64
+	index int
+}
+
+// hitterHeap is a min-heap of the hitters, by hits.
+type hitterHeap []*hitter
+
+func (h hitterHeap) Len() int           { return len(h) }
+func (h hitterHeap) Less(i, j int) bool { return h[i].hits < h[j].hits }
+func (h hitterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hitterHeap) Push(x interface{}) {
+	x.(*hitter).index = len(*h)
+	*h = append(*h, x.(*hitter))
+}
+
+func (h *hitterHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// spaceSaving counts the hits of the most frequent values in a fixed memory (the Space-Saving algorithm): once all its
+// counters are taken, a new value replaces the value with the fewest hits, and inherits its hits.
+type spaceSaving struct {
+	counters map[string]*hitter
+	heap     hitterHeap
+}
+
+func newSpaceSaving() *spaceSaving {
+	return &spaceSaving{counters: make(map[string]*hitter)}
+}
+
+// add counts the hits of a value.
+func (s *spaceSaving) add(value string, hits float64) {
+	if h, ok := s.counters[value]; ok {
+		h.hits += hits
+		heap.Fix(&s.heap, h.index)
+		return
+	}
+
+	if len(s.heap) < topCapacity {
+		h := &hitter{value: value, hits: hits}
+		s.counters[value] = h
+		heap.Push(&s.heap, h)
+		return
+	}
+
+	h := s.heap[0]
+	delete(s.counters, h.value)
+	h.value = value
+	h.hits += hits
+	s.counters[value] = h
+	heap.Fix(&s.heap, 0)
+}
+
+// topCounter tracks the heavy hitters of some labels, with a Space-Saving sketch per label and per bucket of time, so
+// the top values of a window are found without reading all its series.
+type topCounter struct {
+	labels    map[string]bool
+	retention int64
+
+	mu       sync.Mutex
+	sketches map[string]map[int64]*spaceSaving
+	// newest is the start of the newest bucket. The buckets older than the retention before it are dropped.
+	newest int64
+	// validFrom is the first bucket whose hits were all counted: the storage may have older hits, stored before the
+	// counter was created.
+	validFrom int64
+}
+
+// newTopCounter creates a counter keeping the sketches of the retention before the newest entry, whose hits are all
+// counted from "validFrom". DefaultRetention is used if the retention isn't positive.
+func newTopCounter(labels []string, retention time.Duration, validFrom int64) *topCounter {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	t := &topCounter{
+		labels:    make(map[string]bool, len(labels)),
+		retention: int64(retention / time.Second),
+		sketches:  make(map[string]map[int64]*spaceSaving, len(labels)),
+		newest:    math.MinInt64,
+		validFrom: validFrom,
+	}
+	for _, label := range labels {
+		t.labels[label] = true
+		t.sketches[label] = make(map[int64]*spaceSaving)
+	}
+
+	return t
+}
+
+// add counts the hits of a stored series, whose labels are given by the "get" function. The series older than the
+// retention are ignored.
+func (t *topCounter) add(timestamp int64, get func(name string) string, hits float64) {
+	if len(t.labels) == 0 {
+		return
+	}
+
+	bucket := timestamp - mod(timestamp, topBucket)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if bucket > t.newest {
+		t.newest = bucket
+		t.prune()
+	}
+	if bucket <= t.newest-t.retention-topBucket {
+		return
+	}
+
+	for label := range t.labels {
+		sketch, ok := t.sketches[label][bucket]
+		if !ok {
+			sketch = newSpaceSaving()
+			t.sketches[label][bucket] = sketch
+		}
+		sketch.add(get(label), hits)
+	}
+}
+
+// prune drops the buckets which are entirely older than the retention.
+func (t *topCounter) prune() {
+	for _, buckets := range t.sketches {
+		for bucket := range buckets {
+			if bucket <= t.newest-t.retention-topBucket {
+				delete(buckets, bucket)
+			}
+		}
+	}
+}
+
+// top returns the "limit" values of a label with the most hits between two timestamps, both included, from the
+// sketches of the whole buckets of the window. The hits of the rest of the window are read with the "exact" function.
+// It returns false if the sketches can't answer: the label isn't tracked, the entries are filtered by a pattern or by
+// matchers, the limit is more than the capacity or not positive, or the window has no whole bucket.
+func (t *topCounter) top(label string, pattern string, since int64, until int64, limit int, matchers []Matcher, exact func(since int64, until int64) (EntryList, error)) (EntryList, bool, error) {
+	if !t.labels[label] || pattern != AllEntriesPattern || len(matchers) > 0 || limit <= 0 || limit > topCapacity {
+		return nil, false, nil
+	}
+
+	// The lock isn't held while reading the storage, which adds the hits with its own lock held.
+	t.mu.Lock()
+	if t.newest == math.MinInt64 {
+		t.mu.Unlock()
+		return nil, false, nil
+	}
+
+	// The buckets older than the retention were dropped, the hits of the rest of the window are read.
+	oldest := t.newest - t.retention - topBucket + 1
+	oldest += mod(-oldest, topBucket)
+	first := since + mod(-since, topBucket)
+	if first < t.validFrom {
+		first = t.validFrom
+	}
+	if first < oldest {
+		first = oldest
+	}
+	end := until + 1 - mod(until+1, topBucket)
+	if first >= end {
+		t.mu.Unlock()
+		return nil, false, nil
+	}
+
+	m := make(map[string]float64)
+	for bucket, sketch := range t.sketches[label] {
+		if bucket >= first && bucket < end {
+			for value, h := range sketch.counters {
+				m[value] += h.hits
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for _, edge := range [][2]int64{{since, first - 1}, {end, until}} {
+		if edge[0] > edge[1] {
+			continue
+		}
+		entries, err := exact(edge[0], edge[1])
+		if err != nil {
+			return nil, true, err
+		}
+		for _, e := range entries {
+			m[e.Key] += e.Value
+		}
+	}
+
+	return topN(mapToEntryList(m), limit), true, nil
+}
@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving()
+	total := 0.0
+	for i := 0; i < 10000; i++ {
+		// Three heavy hitters, among values seen once.
+		s.add("/user/"+strconv.Itoa(i), 1)
+		s.add("/home", 1)
+		if i%2 == 0 {
+			s.add("/report", 2)
+		}
+		if i%10 == 0 {
+			s.add("/api", 1)
+		}
+		total += 3.1
+	}
+
+	require.Len(t, s.counters, topCapacity, "The sketch should keep its capacity")
+	require.Len(t, s.heap, topCapacity, "The sketch should keep its capacity")
+	for value, hits := range map[string]float64{"/home": 10000, "/report": 10000, "/api": 1000} {
+		require.Contains(t, s.counters, value, "The heavy hitter %s should be counted", value)
+		require.InDelta(t, hits, s.counters[value].hits, total/topCapacity, "Unexpected hits for %s", value)
+		require.True(t, s.counters[value].hits >= hits, "The hits of %s shouldn't be underestimated", value)
+	}
+}
+
+func TestTopEntriesHeavyHitters(t *testing.T) {
+	db, err := OpenLoggingDatabase(DatabaseConfig{Labels: LabelConfig{TopLabels: DefaultTopLabels}})
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	for name, storage := range map[string]Storage{"tsdb": db, "memory": NewMemoryStorage(time.Hour, LabelConfig{TopLabels: DefaultTopLabels})} {
+		start := time.Unix(1539874800, 0)
+		var entries []*LoggingEntry
+		for i := 0; i < 600; i++ {
+			date := start.Add(time.Duration(i) * time.Second)
+			// Many hosts seen once, and hosts seen more and more often.
+			entry := testEntry("james", date)
+			entry.RemoteHost = "10.1." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+			entries = append(entries, entry)
+			for j := 0; j < 4; j++ {
+				if i%(j+2) == 0 {
+					entry := testEntry("james", date)
+					entry.RemoteHost = "10.0.0." + strconv.Itoa(j)
+					entries = append(entries, entry)
+				}
+			}
+		}
+		_, err := storage.AddEntries(entries)
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+
+		for _, window := range [][2]int64{{0, 599}, {0, 59}, {30, 250}, {61, 118}, {10, 20}, {500, 1000}} {
+			since, until := start.Unix()+window[0], start.Unix()+window[1]
+			all, err := storage.GetEntries(HostLabel, AllEntriesPattern, since, until)
+			require.Nil(t, err, "Unexpected error raised for %s", name)
+
+			top, err := storage.TopEntries(HostLabel, AllEntriesPattern, since, until, 3)
+			require.Nil(t, err, "Unexpected error raised for %s", name)
+			// The values with as many hits may come in any order.
+			hits := make(map[string]float64)
+			for _, e := range all {
+				hits[e.Key] = e.Value
+			}
+			expected := topN(all, 3)
+			require.Len(t, top, len(expected), "Unexpected top entries for %s between %d and %d", name, window[0], window[1])
+			for i, e := range top {
+				require.Equal(t, expected[i].Value, e.Value, "Unexpected top entries for %s between %d and %d", name, window[0], window[1])
+				require.Equal(t, hits[e.Key], e.Value, "Unexpected hits of %s for %s between %d and %d", e.Key, name, window[0], window[1])
+			}
+		}
+
+		// The sketches don't filter the entries.
+		top, err := storage.TopEntries(HostLabel, "^10\\.1\\.0\\.[0-2]$", start.Unix(), start.Unix()+599, 3)
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.ElementsMatch(t, EntryList{{"10.1.0.0", 1}, {"10.1.0.1", 1}, {"10.1.0.2", 1}}, top, "Unexpected top entries for %s", name)
+
+		top, err = storage.TopEntries(HostLabel, AllEntriesPattern, start.Unix(), start.Unix()+599, 3, Matcher{HostLabel, MatchRegexp, "10\\.0\\.0\\.[23]"})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, EntryList{{"10.0.0.2", 150}, {"10.0.0.3", 120}}, top, "Unexpected top entries for %s", name)
+	}
+}
+
+func TestTopEntriesAfterReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hitters")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	config := DatabaseConfig{Dir: dir, Labels: LabelConfig{TopLabels: []string{HostLabel}}}
+	db, err := OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+
+	start := time.Unix(1539874800, 0)
+	var entries []*LoggingEntry
+	for i := 0; i < 90; i++ {
+		entry := testEntry("james", start.Add(time.Duration(i)*time.Second))
+		entry.RemoteHost = "10.0.0.1"
+		entries = append(entries, entry)
+	}
+	_, err = db.AddEntries(entries)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, db.Close(), "Unexpected error raised")
+
+	db, err = OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+	require.Equal(t, start.Unix()+120, db.top.validFrom, "The hits stored before should be read from the database")
+
+	entries = nil
+	for i := 90; i < 300; i++ {
+		entry := testEntry("james", start.Add(time.Duration(i)*time.Second))
+		entry.RemoteHost = "10.0.0.2"
+		entries = append(entries, entry)
+	}
+	_, err = db.AddEntries(entries)
+	require.Nil(t, err, "Unexpected error raised")
+
+	top, err := db.TopEntries(HostLabel, AllEntriesPattern, start.Unix(), start.Unix()+299, 2)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, EntryList{{"10.0.0.2", 210}, {"10.0.0.1", 90}}, top)
+}
+
+func TestTopCounterRetention(t *testing.T) {
+	c := newTopCounter([]string{HostLabel}, 10*time.Minute, math.MinInt64)
+	for minute := int64(0); minute <= 20; minute++ {
+		c.add(minute*60, func(string) string { return "10.0.0.1" }, 1)
+	}
+
+	// The buckets dropped with the retention are read from the storage.
+	var read [][2]int64
+	top, ok, err := c.top(HostLabel, AllEntriesPattern, 0, 21*60-1, 1, nil, func(since int64, until int64) (EntryList, error) {
+		read = append(read, [2]int64{since, until})
+		return EntryList{{"10.0.0.1", float64((until - since + 1) / 60)}}, nil
+	})
+	require.Nil(t, err, "Unexpected error raised")
+	require.True(t, ok, "The sketches should answer")
+	require.Equal(t, [][2]int64{{0, 10*60 - 1}}, read, "The dropped buckets should be read from the storage")
+	require.Equal(t, EntryList{{"10.0.0.1", 21}}, top)
+
+	_, ok, err = newTopCounter([]string{HostLabel}, time.Hour, math.MinInt64).top(HostLabel, AllEntriesPattern, 0, 3600, 1, nil, nil)
+	require.Nil(t, err, "Unexpected error raised")
+	require.False(t, ok, "An empty counter can't answer")
+}
+
+func TestTopEntriesStoredHits(t *testing.T) {
+	db, err := OpenLoggingDatabase(DatabaseConfig{Labels: LabelConfig{TopLabels: []string{HostLabel}}})
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	// Several hits of a host during a second, one by one, then the hits of a closed second which are skipped.
+	start := time.Unix(1539874800, 0)
+	first, second := testEntry("james", start), testEntry("james", start.Add(2*time.Minute))
+	first.RemoteHost, second.RemoteHost = "10.0.0.1", "10.0.0.2"
+	for i := 0; i < 5; i++ {
+		require.Nil(t, db.AddEntry(first), "Unexpected error raised")
+	}
+	require.Nil(t, db.AddEntry(second), "Unexpected error raised")
+	require.NotNil(t, db.AddEntry(first), "The hits of a closed second can't be stored")
+	skipped, err := db.AddEntries([]*LoggingEntry{first, first})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 2, skipped, "The hits of a closed second can't be stored")
+
+	all, err := db.GetEntries(HostLabel, AllEntriesPattern, start.Unix(), start.Unix()+179)
+	require.Nil(t, err, "Unexpected error raised")
+	require.ElementsMatch(t, EntryList{{"10.0.0.1", 5}, {"10.0.0.2", 1}}, all)
+	top, err := db.TopEntries(HostLabel, AllEntriesPattern, start.Unix(), start.Unix()+179, 2)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, EntryList{{"10.0.0.1", 5}, {"10.0.0.2", 1}}, top, "The sketches should count the stored hits only")
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// hllPrecision is the number of bits of the hashes selecting a register: the sketches have 4096 registers, for a
+	// standard error of 1.6%.
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+	// hllMaxSparse is the number of registers set in a sparse sketch before it's converted to a dense one, which
+	// takes as much memory.
+	hllMaxSparse = hllRegisters / 4
+)
+
+// hyperLogLog estimates the number of distinct values added to it, in a fixed memory. Two sketches can be merged, to
+// count the distinct values of both.
+// The sketches start sparse, with only the registers which are set, and become dense once they have many values.
+type hyperLogLog struct {
+	// sparse are the registers which are set, sorted by index, as index<<8 | value.
+	sparse []uint32
+	// dense are all the registers, once the sketch isn't sparse anymore.
+	dense []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{}
+}
+
+// add adds a value to the sketch.
+func (h *hyperLogLog) add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	// The first bits select the register, which keeps the longest run of leading zeros of the other bits.
+	index := uint32(x >> (64 - hllPrecision))
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	h.set(index, rank)
+}
+
+// set raises a register to "rank".
+func (h *hyperLogLog) set(index uint32, rank uint8) {
+	if h.dense != nil {
+		if rank > h.dense[index] {
+			h.dense[index] = rank
+		}
+		return
+	}
+
+	i := sort.Search(len(h.sparse), func(i int) bool { return h.sparse[i]>>8 >= index })
+	if i < len(h.sparse) && h.sparse[i]>>8 == index {
+		if rank > uint8(h.sparse[i]) {
+			h.sparse[i] = index<<8 | uint32(rank)
+		}
+		return
+	}
+
+	h.sparse = append(h.sparse, 0)
+	copy(h.sparse[i+1:], h.sparse[i:])
+	h.sparse[i] = index<<8 | uint32(rank)
+	if len(h.sparse) > hllMaxSparse {
+		h.densify()
+	}
+}
+
+// densify converts a sparse sketch into a dense one.
+func (h *hyperLogLog) densify() {
+	h.dense = make([]uint8, hllRegisters)
+	for _, r := range h.sparse {
+		h.dense[r>>8] = uint8(r)
+	}
+	h.sparse = nil
+}
+
+// merge adds the values of another sketch.
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	if other.dense != nil {
+		if h.dense == nil {
+			h.densify()
+		}
+		for i, rank := range other.dense {
+			if rank > h.dense[i] {
+				h.dense[i] = rank
+			}
+		}
+		return
+	}
+
+	for _, r := range other.sparse {
+		h.set(r>>8, uint8(r))
+	}
+}
+
+// estimate returns the estimated number of distinct values, using linear counting for the small numbers.
+func (h *hyperLogLog) estimate() float64 {
+	sum, zeros := 0.0, 0
+	if h.dense != nil {
+		for _, rank := range h.dense {
+			sum += math.Ldexp(1, -int(rank))
+			if rank == 0 {
+				zeros++
+			}
+		}
+	} else {
+		for _, r := range h.sparse {
+			sum += math.Ldexp(1, -int(uint8(r)))
+		}
+		zeros = hllRegisters - len(h.sparse)
+		sum += float64(zeros)
+	}
+
+	m := float64(hllRegisters)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		return m * math.Log(m/float64(zeros))
+	}
+
+	return estimate
+}
+
+// mix64 spreads the bits of a hash, since HyperLogLog needs uniform bits and FNV doesn't mix its high bits enough for
+// short values.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
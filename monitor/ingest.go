@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// IngestSourceName is the source label of the lines pushed to the ingest endpoint.
+	IngestSourceName = "ingest"
+	// DefaultIngestMaxBodySize is the default size limit of an ingested batch, after decompression.
+	DefaultIngestMaxBodySize = 10 << 20
+	// maxIngestErrors is how many line errors are detailed in an ingest response.
+	maxIngestErrors = 100
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// IngestConfig configures the endpoint where the agents push batches of logging lines.
+type IngestConfig struct {
+	// Secret is expected as a bearer token in the Authorization header. It's required, unless Insecure is set.
+	Secret string
+	// Insecure accepts the requests without authentication when there is no secret.
+	Insecure bool
+	// MaxBodySize limits the size of a batch, both before and after decompression. DefaultIngestMaxBodySize is used
+	// if it's not positive.
+	MaxBodySize int64
+}
+
+// IngestLineError explains why a line of a batch was rejected.
+type IngestLineError struct {
+	// Line is the number of the line in the batch, starting from 1.
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// IngestResult is the response of the ingest endpoint.
+type IngestResult struct {
+	// Accepted is the number of lines stored into the database.
+	Accepted int `json:"accepted"`
+	// Rejected is the number of invalid lines.
+	Rejected int `json:"rejected"`
+	// Skipped is the number of valid lines which the database couldn't store (e.g out of order).
+	Skipped int `json:"skipped"`
+	// Errors details the first rejected lines.
+	Errors []IngestLineError `json:"errors"`
+}
+
+// limitReader fails with errBodyTooLarge once more than n bytes are read.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// validate checks that the requests are authenticated, unless the configuration is explicitly insecure.
+func (c *IngestConfig) validate() error {
+	if c.Secret == "" && !c.Insecure {
+		return errors.New("the ingest endpoint needs a secret, unless it's explicitly insecure")
+	}
+
+	return nil
+}
+
+// authorized checks the bearer token of a request, in constant time.
+func (c *IngestConfig) authorized(r *http.Request) bool {
+	if c.Secret == "" {
+		return c.Insecure
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.Secret)) == 1
+}
+
+// readBatch reads the lines of a request body, decompressed if its Content-Encoding is gzip.
+func (c *IngestConfig) readBatch(r *http.Request) ([]string, error) {
+	maxBodySize := c.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultIngestMaxBodySize
+	}
+
+	var body io.Reader = &limitReader{r: r.Body, n: maxBodySize}
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = &limitReader{r: gz, n: maxBodySize}
+	default:
+		return nil, errors.New("unsupported content encoding")
+	}
+
+	var lines []string
+	reader := bufio.NewReader(body)
+	for {
+		data, err := reader.ReadString('\n')
+		lines = append(lines, strings.TrimRight(data, "\r\n"))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ingest adds a batch of newline-delimited logging lines to the database, with a single commit. The invalid lines
+// are rejected, but the other ones are added anyway.
+func (api *API) ingest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	config := api.monitor.ingest
+	if !config.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	lines, err := config.readBatch(r)
+	if err == errBodyTooLarge {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := IngestResult{Errors: []IngestLineError{}}
+	var entries []*LoggingEntry
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		l := logLine{source: IngestSourceName, text: line}
+		entry, err := parseLine(l)
+		if err != nil {
+			api.monitor.rejectLine(l, err)
+			result.Rejected++
+			if len(result.Errors) < maxIngestErrors {
+				result.Errors = append(result.Errors, IngestLineError{Line: i + 1, Error: err.Error()})
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	skipped, err := api.monitor.db.AddEntries(entries)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result.Accepted = len(entries) - skipped
+	result.Skipped = skipped
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ingestBatch posts a batch to the ingest endpoint of a monitor.
+func ingestBatch(m *Monitor, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", bytes.NewReader(body))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	NewAPI(m).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func ingestLines(date time.Time, users ...string) string {
+	var lines []string
+	for _, user := range users {
+		lines = append(lines, `127.0.0.1 - `+user+` [`+date.Format("02/Jan/2006:15:04:05 -0700")+`] "GET /report HTTP/1.0" 200 123`)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestAPIIngest(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithIngest(IngestConfig{Insecure: true}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	now := time.Now()
+	body := ingestLines(now, "james", "jill") + "\n\ninvalid line\n" + ingestLines(now, "frank") + "\n"
+	recorder := ingestBatch(m, []byte(body), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var result IngestResult
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	_, parseErr := NewLoggingEntry("invalid line")
+	require.Equal(t, IngestResult{Accepted: 3, Rejected: 1, Errors: []IngestLineError{{Line: 4, Error: parseErr.Error()}}}, result)
+
+	entries, err := m.db.GetEntries(SourceLabel, IngestSourceName, now.Unix(), now.Unix())
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, EntryList{{IngestSourceName, 3}}, entries)
+}
+
+func TestAPIIngestSkipped(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithIngest(IngestConfig{Insecure: true}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	// The identical lines of a second are all stored, the lines older than the database accepts are skipped.
+	now := time.Now()
+	body := ingestLines(now, "james", "james", "james") + "\n" + ingestLines(now.Add(-time.Minute), "jack")
+	recorder := ingestBatch(m, []byte(body), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"accepted":4,"rejected":0,"skipped":0,"errors":[]}`, recorder.Body.String())
+
+	body = ingestLines(now, "james", "james") + "\n" + ingestLines(now.Add(-2*time.Hour), "jill")
+	recorder = ingestBatch(m, []byte(body), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"accepted":2,"rejected":0,"skipped":1,"errors":[]}`, recorder.Body.String())
+
+	entries, err := m.db.GetEntries(UserLabel, AllEntriesPattern, now.Add(-3*time.Hour).Unix(), now.Unix())
+	require.Nil(t, err, "Unexpected error raised")
+	require.ElementsMatch(t, EntryList{{"james", 5}, {"jack", 1}}, entries)
+}
+
+func TestAPIIngestGzip(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithIngest(IngestConfig{Insecure: true}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	var body bytes.Buffer
+	w := gzip.NewWriter(&body)
+	_, err = w.Write([]byte(ingestLines(time.Now(), "james", "jill")))
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, w.Close())
+
+	recorder := ingestBatch(m, body.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"accepted":2,"rejected":0,"skipped":0,"errors":[]}`, recorder.Body.String())
+
+	recorder = ingestBatch(m, []byte("not gzip"), map[string]string{"Content-Encoding": "gzip"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = ingestBatch(m, body.Bytes(), map[string]string{"Content-Encoding": "br"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestAPIIngestMaxBodySize(t *testing.T) {
+	body := []byte(ingestLines(time.Now(), "james", "jill"))
+
+	m, err := NewMonitor(nil, nil, WithIngest(IngestConfig{Insecure: true, MaxBodySize: int64(len(body) - 1)}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	recorder := ingestBatch(m, body, nil)
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	// The limit also applies after the decompression.
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err = w.Write(bytes.Repeat(body, 10))
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, w.Close())
+	require.True(t, compressed.Len() < len(body))
+
+	recorder = ingestBatch(m, compressed.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	m.ingest.MaxBodySize = int64(len(body))
+	recorder = ingestBatch(m, body, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestAPIIngestSecret(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithIngest(IngestConfig{Secret: "secret"}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	body := []byte(ingestLines(time.Now(), "james"))
+	for _, authorization := range []string{"", "Bearer wrong", "secret"} {
+		recorder := ingestBatch(m, body, map[string]string{"Authorization": authorization})
+		require.Equal(t, http.StatusUnauthorized, recorder.Code, "Unexpected status for %q", authorization)
+	}
+
+	recorder := ingestBatch(m, body, map[string]string{"Authorization": "Bearer secret"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// The requests are authenticated, unless the endpoint is explicitly insecure.
+	_, err = NewMonitor(nil, nil, WithIngest(IngestConfig{}))
+	require.NotNil(t, err, "The ingest endpoint should need a secret")
+}
+
+func TestAPIIngestDisabled(t *testing.T) {
+	m, err := NewMonitor(nil, nil)
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	recorder := ingestBatch(m, []byte(ingestLines(time.Now(), "james")), nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// InhibitRule mutes the notifications of the target alerts while a source alert is firing.
+type InhibitRule struct {
+	// SourceMatch are the labels (including "alertname") that the inhibiting alert must have.
+	SourceMatch map[string]string `json:"source_match"`
+	// TargetMatch are the labels (including "alertname") of the inhibited alerts.
+	TargetMatch map[string]string `json:"target_match"`
+	// Equal lists the labels that must have the same value in the source and the target alerts.
+	Equal []string `json:"equal"`
+}
+
+// Validate checks the inhibition rule.
+func (r *InhibitRule) Validate() error {
+	if len(r.SourceMatch) == 0 || len(r.TargetMatch) == 0 {
+		return errors.New("inhibit rule requires source_match and target_match")
+	}
+
+	return nil
+}
+
+func matchLabels(match map[string]string, labels map[string]string) bool {
+	for name, value := range match {
+		if labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Inhibitor is a notification stage that drops the events of the inhibited alerts.
+// The resolution of an alert is forwarded only if its firing event was forwarded too. The inhibited alerts which are
+// still firing are forwarded once they aren't inhibited anymore.
+type Inhibitor struct {
+	rules []InhibitRule
+	next  Notifier
+
+	mu        sync.Mutex
+	firing    map[string]map[string]string
+	delivered map[string]bool
+	// held are the last firing events of the inhibited alerts, by name.
+	held map[string]*AlertEvent
+}
+
+// NewInhibitor is used to create an inhibition stage in front of the "next" notifier.
+func NewInhibitor(rules []InhibitRule, next Notifier) *Inhibitor {
+	return &Inhibitor{
+		rules:     rules,
+		next:      next,
+		firing:    make(map[string]map[string]string),
+		delivered: make(map[string]bool),
+		held:      make(map[string]*AlertEvent),
+	}
+}
+
+// Notify updates the firing alerts and forwards the events that are not inhibited.
+func (in *Inhibitor) Notify(n *Notification) error {
+	in.mu.Lock()
+	for _, event := range n.Alerts {
+		if event.Firing() {
+			in.firing[event.Name] = alertLabels(event.Name, event.Labels)
+		} else {
+			delete(in.firing, event.Name)
+		}
+	}
+
+	forward := &Notification{GroupLabels: n.GroupLabels}
+	resolved := false
+	for _, event := range n.Alerts {
+		if event.Firing() {
+			if in.inhibited(alertLabels(event.Name, event.Labels)) {
+				in.held[event.Name] = event
+				continue
+			}
+			delete(in.held, event.Name)
+			in.delivered[event.Name] = true
+		} else {
+			resolved = true
+			delete(in.held, event.Name)
+			if !in.delivered[event.Name] {
+				continue
+			}
+			delete(in.delivered, event.Name)
+		}
+		forward.Alerts = append(forward.Alerts, event)
+	}
+
+	// A resolved alert may have been the source inhibiting the held ones.
+	if resolved {
+		forward.Alerts = append(forward.Alerts, in.release()...)
+	}
+	in.mu.Unlock()
+
+	if len(forward.Alerts) == 0 {
+		return nil
+	}
+
+	return in.next.Notify(forward)
+}
+
+// release returns the held events of the alerts which aren't inhibited anymore, sorted by name, and marks them as
+// delivered.
+func (in *Inhibitor) release() []*AlertEvent {
+	var released []*AlertEvent
+	for name, event := range in.held {
+		if in.inhibited(alertLabels(event.Name, event.Labels)) {
+			continue
+		}
+		released = append(released, event)
+		in.delivered[name] = true
+		delete(in.held, name)
+	}
+	sort.Slice(released, func(i, j int) bool {
+		return released[i].Name < released[j].Name
+	})
+
+	return released
+}
+
+// Inhibited reports whether an alert with the given labels is currently inhibited.
+func (in *Inhibitor) Inhibited(labels map[string]string) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	return in.inhibited(labels)
+}
+
+func (in *Inhibitor) inhibited(target map[string]string) bool {
+	for _, rule := range in.rules {
+		if !matchLabels(rule.TargetMatch, target) {
+			continue
+		}
+
+		for name, source := range in.firing {
+			// An alert cannot inhibit itself.
+			if name == target[AlertNameLabel] || !matchLabels(rule.SourceMatch, source) {
+				continue
+			}
+
+			equal := true
+			for _, label := range rule.Equal {
+				if source[label] != target[label] {
+					equal = false
+					break
+				}
+			}
+			if equal {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInhibitor() (*Inhibitor, *recordingNotifier) {
+	rules := []InhibitRule{
+		{
+			SourceMatch: map[string]string{AlertNameLabel: "TrafficDrop"},
+			TargetMatch: map[string]string{"scope": "section"},
+			Equal:       []string{"team"},
+		},
+	}
+	notifier := &recordingNotifier{}
+
+	return NewInhibitor(rules, notifier), notifier
+}
+
+func TestInhibitorDropsTargets(t *testing.T) {
+	inhibitor, notifier := newTestInhibitor()
+	web := map[string]string{"team": "web"}
+	webSection := map[string]string{"team": "web", "scope": "section"}
+	dbSection := map[string]string{"team": "db", "scope": "section"}
+
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", Critical, web)))
+	require.Len(t, notifier.notifications, 1, "The source alert should be notified")
+
+	require.Nil(t, inhibitor.Notify(&Notification{Alerts: []*AlertEvent{
+		{Name: "ReportErrors", Status: Critical, Labels: webSection},
+		{Name: "DatabaseErrors", Status: Critical, Labels: dbSection},
+	}}))
+	require.Len(t, notifier.notifications, 2)
+	require.Len(t, notifier.notifications[1].Alerts, 1, "Only the alert with a different team should be notified")
+	require.Equal(t, "DatabaseErrors", notifier.notifications[1].Alerts[0].Name)
+
+	require.True(t, inhibitor.Inhibited(alertLabels("ReportErrors", webSection)))
+	require.False(t, inhibitor.Inhibited(alertLabels("DatabaseErrors", dbSection)))
+
+	// The resolution of an inhibited alert is not notified either.
+	require.Nil(t, inhibitor.Notify(event("ReportErrors", OK, webSection)))
+	require.Len(t, notifier.notifications, 2)
+
+	// Once the source is resolved, the targets are notified again.
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", OK, web)))
+	require.Nil(t, inhibitor.Notify(event("ReportErrors", Critical, webSection)))
+	require.Len(t, notifier.notifications, 4)
+	require.False(t, inhibitor.Inhibited(alertLabels("ReportErrors", webSection)))
+}
+
+func TestInhibitorForwardsResolutionOfDeliveredAlerts(t *testing.T) {
+	inhibitor, notifier := newTestInhibitor()
+	section := map[string]string{"scope": "section"}
+
+	require.Nil(t, inhibitor.Notify(event("ReportErrors", Critical, section)))
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", Critical, nil)))
+	require.Nil(t, inhibitor.Notify(event("ReportErrors", OK, section)))
+
+	require.Len(t, notifier.notifications, 3, "The resolution of an alert already notified should be forwarded")
+	require.Equal(t, OK, notifier.notifications[2].Alerts[0].Status)
+}
+
+func TestInhibitorSelfMatch(t *testing.T) {
+	rules := []InhibitRule{{SourceMatch: map[string]string{"scope": "global"}, TargetMatch: map[string]string{"scope": "global"}}}
+	notifier := &recordingNotifier{}
+	inhibitor := NewInhibitor(rules, notifier)
+
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", Critical, map[string]string{"scope": "global"})))
+	require.Len(t, notifier.notifications, 1, "An alert shouldn't inhibit itself")
+}
+
+func TestInhibitorReleasesTargets(t *testing.T) {
+	inhibitor, notifier := newTestInhibitor()
+	web := map[string]string{"team": "web"}
+	webSection := map[string]string{"team": "web", "scope": "section"}
+
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", Critical, web)))
+	require.Nil(t, inhibitor.Notify(event("ReportErrors", Critical, webSection)))
+	require.Len(t, notifier.notifications, 1, "The target should be inhibited")
+
+	// The target is still firing when the source is resolved, so it's delivered with the resolution.
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", OK, web)))
+	require.Len(t, notifier.notifications, 2)
+	alerts := notifier.notifications[1].Alerts
+	require.Len(t, alerts, 2)
+	require.Equal(t, "TrafficDrop", alerts[0].Name)
+	require.Equal(t, OK, alerts[0].Status)
+	require.Equal(t, "ReportErrors", alerts[1].Name)
+	require.Equal(t, Critical, alerts[1].Status)
+
+	// Its resolution is delivered too, once.
+	require.Nil(t, inhibitor.Notify(event("ReportErrors", OK, webSection)))
+	require.Nil(t, inhibitor.Notify(event("TrafficDrop", OK, web)))
+	require.Len(t, notifier.notifications, 3)
+	require.Equal(t, "ReportErrors", notifier.notifications[2].Alerts[0].Name)
+}
@@ -0,0 +1,231 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// OtherLabelValue replaces the values of a label once it has too many of them.
+	OtherLabelValue = "__other__"
+	// DefaultMaxLabelValues is the default number of distinct values of each label, used by the command line.
+	DefaultMaxLabelValues = 1000
+	// labelPruneInterval is how often the values older than the retention are forgotten, in seconds.
+	labelPruneInterval = 60
+)
+
+// LabelConfig configures which labels of the entries are stored and how many values they can take.
+type LabelConfig struct {
+	// Labels are the names of the stored labels (e.g HostLabel, RequestURLSectionLabel). All the labels are stored if
+	// it's empty. The queries see the other labels as empty.
+	Labels []string
+	// KeepQueryString keeps the query strings of the URLs (e.g "/search?q=term"), which are removed by default.
+	KeepQueryString bool
+	// Routes are route patterns (e.g "/api/:version/users/:name", "/static/*"), whose segments starting with ':' match
+	// any segment and whose final '*' matches the rest of the path. The route label of an entry is the first pattern
+	// matching its path, or its normalized path (see Request.Route).
+	Routes []string
+	// MaxValues is the number of distinct values of each label during the retention. Once it's reached, the new
+	// values are stored as OtherLabelValue, until the oldest values leave the retention. The values aren't limited if
+	// it's not positive.
+	MaxValues int
+	// DistinctLabels are the labels whose distinct values are estimated by minute (see Storage.CountDistinct), e.g
+	// DefaultDistinctLabels. They don't need to be stored, and their values are counted before being limited.
+	DistinctLabels []string
+	// TopLabels are the labels whose heavy hitters are tracked by minute, so the top values of the windows of whole
+	// minutes are found without reading all their series (e.g DefaultTopLabels). The counts are approximate once a
+	// minute has too many values.
+	TopLabels []string
+}
+
+// labeler computes the stored labels of the entries. It tracks the distinct values of each label during the
+// retention, exposed as a metric, and counts the distinct values of the DistinctLabels if the storage sets its distinct
+// counter.
+type labeler struct {
+	config    LabelConfig
+	retention int64
+	indexed   map[string]bool
+	router    router
+	distinct  *distinctCounter
+
+	mu sync.Mutex
+	// values are the stored values of each label, with the timestamp of their newest entry. The values older than the
+	// retention before the newest entry are forgotten every labelPruneInterval.
+	values      map[string]map[string]int64
+	newest      int64
+	prunedAt    int64
+	cardinality *prometheus.GaugeVec
+}
+
+// newLabeler creates a labeler tracking the values of the retention. DefaultRetention is used if the retention isn't
+// positive.
+func newLabeler(config LabelConfig, retention time.Duration) *labeler {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	l := &labeler{
+		config:    config,
+		retention: int64(retention / time.Second),
+		router:    newRouter(config.Routes),
+		values:    make(map[string]map[string]int64),
+		newest:    math.MinInt64,
+		prunedAt:  math.MinInt64,
+		cardinality: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "label_values",
+			Help:      "Number of distinct values stored for each label during the retention, which bounds the number of series.",
+		}, []string{"label"}),
+	}
+
+	if len(config.Labels) > 0 {
+		l.indexed = make(map[string]bool)
+		for _, name := range config.Labels {
+			l.indexed[name] = true
+		}
+	}
+
+	return l
+}
+
+// labels returns the stored labels of an entry.
+func (l *labeler) labels(entry *LoggingEntry) map[string]string {
+	labels := entry.Labels()
+	if !l.config.KeepQueryString {
+		url := stripQueryString(entry.Request.URL)
+		labels[RequestURLLabel] = url
+		labels[RequestURLSectionLabel] = (&Request{URL: url}).Section()
+	}
+	if route, ok := l.router.route(stripQueryString(entry.Request.URL)); ok {
+		labels[RouteLabel] = route
+	}
+	if l.distinct != nil {
+		l.distinct.add(entry.Date.Unix(), labels)
+	}
+
+	timestamp := entry.Date.Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if timestamp > l.newest {
+		l.newest = timestamp
+		if l.prunedAt == math.MinInt64 || l.newest-l.prunedAt >= labelPruneInterval {
+			l.prune()
+		}
+	}
+
+	for name, value := range labels {
+		if l.indexed != nil && !l.indexed[name] {
+			delete(labels, name)
+			continue
+		}
+		labels[name] = l.capValue(name, value, timestamp)
+	}
+
+	return labels
+}
+
+// capValue returns the value of a label, or OtherLabelValue if the label has already too many values, and records
+// the timestamp of its entry.
+func (l *labeler) capValue(name string, value string, timestamp int64) string {
+	values, ok := l.values[name]
+	if !ok {
+		values = make(map[string]int64)
+		l.values[name] = values
+	}
+
+	// OtherLabelValue doesn't count in the limit.
+	count := len(values)
+	if _, ok := values[OtherLabelValue]; ok {
+		count--
+	}
+
+	seen, ok := values[value]
+	if !ok && l.config.MaxValues > 0 && count >= l.config.MaxValues {
+		value = OtherLabelValue
+		seen, ok = values[value]
+	}
+	if !ok || timestamp > seen {
+		values[value] = timestamp
+	}
+	if !ok {
+		l.cardinality.WithLabelValues(name).Set(float64(len(values)))
+	}
+
+	return value
+}
+
+// seed records the values of a label already stored, seen at a timestamp.
+func (l *labeler) seed(name string, values []string, timestamp int64) {
+	if l.indexed != nil && !l.indexed[name] {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if timestamp > l.newest {
+		l.newest = timestamp
+	}
+	for _, value := range values {
+		if value != "" {
+			l.capValue(name, value, timestamp)
+		}
+	}
+}
+
+// prune forgets the values whose newest entry is older than the retention, and updates the metric.
+func (l *labeler) prune() {
+	if l.newest == math.MinInt64 {
+		return
+	}
+
+	for name, values := range l.values {
+		for value, seen := range values {
+			if seen <= l.newest-l.retention {
+				delete(values, value)
+			}
+		}
+		l.cardinality.WithLabelValues(name).Set(float64(len(values)))
+	}
+	l.prunedAt = l.newest
+}
+
+// CountDistinct estimates the number of distinct values of a label between two timestamps, both included. The window
+// is extended to whole minutes. ErrDistinctNotCounted is returned if the label isn't one of the DistinctLabels.
+func (l *labeler) CountDistinct(label string, since int64, until int64) (float64, error) {
+	if l.distinct == nil {
+		return 0, fmt.Errorf("%w for the %s label", ErrDistinctNotCounted, label)
+	}
+
+	return l.distinct.count(label, since, until)
+}
+
+// Describe implements prometheus.Collector.
+func (l *labeler) Describe(ch chan<- *prometheus.Desc) {
+	l.cardinality.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. The values older than the retention aren't counted.
+func (l *labeler) Collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	l.prune()
+	l.mu.Unlock()
+
+	l.cardinality.Collect(ch)
+}
+
+// stripQueryString removes the query string and the fragment of a URL.
+func stripQueryString(url string) string {
+	if end := strings.IndexAny(url, "?#"); end >= 0 {
+		return url[:end]
+	}
+
+	return url
+}
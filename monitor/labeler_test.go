@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelerQueryString(t *testing.T) {
+	l := newLabeler(LabelConfig{}, DefaultRetention)
+	entry := testEntry("james", time.Now())
+	entry.Request.URL = "/search?q=term#results"
+	labels := l.labels(entry)
+	require.Equal(t, "/search", labels[RequestURLLabel], "Unexpected url label")
+	require.Equal(t, "/search", labels[RequestURLSectionLabel], "Unexpected section label")
+
+	l = newLabeler(LabelConfig{KeepQueryString: true}, DefaultRetention)
+	entry.Request.URL = "/search?q=term"
+	labels = l.labels(entry)
+	require.Equal(t, "/search?q=term", labels[RequestURLLabel], "Unexpected url label")
+}
+
+func TestLabelerLabels(t *testing.T) {
+	l := newLabeler(LabelConfig{Labels: []string{HostLabel, RequestURLSectionLabel, SourceLabel}}, DefaultRetention)
+	entry := testEntry("james", time.Now())
+	entry.Request.URL = "/report/user"
+	entry.Source = "access.log"
+
+	require.Equal(t, map[string]string{HostLabel: "127.0.0.1", RequestURLSectionLabel: "/report", SourceLabel: "access.log"}, l.labels(entry))
+}
+
+func TestLabelerMaxValues(t *testing.T) {
+	l := newLabeler(LabelConfig{MaxValues: 2}, DefaultRetention)
+
+	var users []string
+	for _, user := range []string{"james", "jill", "james", "frank", "jack", "jill"} {
+		users = append(users, l.labels(testEntry(user, time.Now()))[UserLabel])
+	}
+	require.Equal(t, []string{"james", "jill", "james", OtherLabelValue, OtherLabelValue, "jill"}, users)
+
+	require.Equal(t, 3.0, testutil.ToFloat64(l.cardinality.WithLabelValues(UserLabel)))
+	require.Equal(t, 1.0, testutil.ToFloat64(l.cardinality.WithLabelValues(HostLabel)))
+}
+
+func TestLabelerRetention(t *testing.T) {
+	l := newLabeler(LabelConfig{MaxValues: 2}, 10*time.Minute)
+	start := time.Now()
+	user := func(name string, date time.Time) string {
+		return l.labels(testEntry(name, date))[UserLabel]
+	}
+
+	require.Equal(t, "james", user("james", start))
+	require.Equal(t, "jill", user("jill", start.Add(5*time.Minute)))
+	require.Equal(t, OtherLabelValue, user("frank", start.Add(6*time.Minute)))
+
+	// The values older than the retention are forgotten, the other ones are kept.
+	require.Equal(t, "frank", user("frank", start.Add(11*time.Minute)))
+	require.Equal(t, OtherLabelValue, user("jack", start.Add(11*time.Minute)))
+	require.Equal(t, 3.0, testutil.ToFloat64(l.cardinality.WithLabelValues(UserLabel)))
+
+	// The metric counts the values of the retention when it's collected.
+	require.Equal(t, "frank", user("frank", start.Add(16*time.Minute+30*time.Second)))
+	l.Collect(make(chan prometheus.Metric, 100))
+	require.Equal(t, 2.0, testutil.ToFloat64(l.cardinality.WithLabelValues(UserLabel)))
+}
+
+func TestDatabaseLabelsAfterReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "labels")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	config := DatabaseConfig{Dir: dir, Labels: LabelConfig{Labels: []string{UserLabel}, MaxValues: 2}}
+	db, err := OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+	_, err = db.AddEntries([]*LoggingEntry{testEntry("james", time.Now()), testEntry("jill", time.Now())})
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+	require.Nil(t, db.Close(), "Unexpected error raised")
+
+	// The stored values are counted again.
+	db, err = OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+	require.Equal(t, 2.0, testutil.ToFloat64(db.cardinality.WithLabelValues(UserLabel)))
+	require.Equal(t, OtherLabelValue, db.labels(testEntry("frank", time.Now()))[UserLabel])
+	require.Equal(t, "jill", db.labels(testEntry("jill", time.Now()))[UserLabel])
+}
+
+func TestDatabaseLabels(t *testing.T) {
+	db, err := OpenLoggingDatabase(DatabaseConfig{Labels: LabelConfig{Labels: []string{UserLabel, RequestURLLabel}, MaxValues: 1}})
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	now := time.Now()
+	var added []*LoggingEntry
+	for i, user := range []string{"james", "james", "jill"} {
+		entry := testEntry(user, now)
+		entry.Request.URL = "/a?b=" + strconv.Itoa(i+1)
+		added = append(added, entry)
+	}
+	_, err = db.AddEntries(added)
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+
+	entries, err := db.GetEntries(RequestURLLabel, AllEntriesPattern, now.Unix(), now.Unix())
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "/a", Value: 3.0}}, entries)
+
+	entries, err = db.TopEntries(UserLabel, AllEntriesPattern, now.Unix(), now.Unix(), 0)
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "james", Value: 2.0}, {Key: OtherLabelValue, Value: 1.0}}, entries)
+
+	// The labels which aren't stored are empty.
+	entries, err = db.GetEntries(HostLabel, AllEntriesPattern, now.Unix(), now.Unix())
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "", Value: 3.0}}, entries)
+}
+
+func TestAPILabelMetrics(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithDatabase(DatabaseConfig{Storage: StorageMemory, Labels: LabelConfig{Labels: []string{UserLabel}}}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	_, err = m.db.AddEntries([]*LoggingEntry{testEntry("james", time.Now()), testEntry("jill", time.Now())})
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+
+	recorder := httptest.NewRecorder()
+	NewAPI(m).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `httpmonitor_label_values{label="user"} 2`)
+}
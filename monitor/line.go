@@ -15,15 +15,85 @@ var (
 	// ErrInvalidFormatLine is used to signal that line supplied doesn't match the expected format.
 	ErrInvalidFormatLine = errors.New("invalid format line")
 
-	lineRegex = regexp.MustCompile(`^(\S+)\s` + // remote host
-		`([^ ]*)\s` + // remote logname
-		`([^ ]*)\s` + // authuser
-		`(?:-|\[([^\]]*)\])\s` + // date
-		`(?:-|\"(.*)\")\s` + // request
-		`(-|[\d]{3})\s` + //status
-		`(-|[\d]+)$`) // size
+	// lineFormat describes the fields of a line, in order.
+	lineFormat = []struct {
+		field    string
+		pattern  string
+		expected string
+	}{
+		{FieldHost, `^(\S+)\s`, "a remote host"},
+		{FieldLogName, `([^ ]*)\s`, "a remote logname"},
+		{FieldUser, `([^ ]*)\s`, "an auth user"},
+		{FieldDate, `(?:-|\[([^\]]*)\])\s`, `"[date]" or "-"`},
+		{FieldRequest, `(?:-|\"(.*)\")\s`, `a quoted request or "-"`},
+		{FieldStatus, `(-|[\d]{3})\s`, `a 3 digits status or "-"`},
+		{FieldBytes, `(-|[\d]+)(?:\s"([^"]*)"\s"([^"]*)")?$`, `a size or "-", then a quoted referer and user agent or the end of the line`},
+	}
+
+	// linePrefixRegexes match the beginning of a line, up to each field. They find the first invalid field of a line.
+	linePrefixRegexes = compileLinePrefixes()
+	lineRegex         = linePrefixRegexes[len(linePrefixRegexes)-1]
 )
 
+// compileLinePrefixes compiles a regular expression for each prefix of the line format.
+func compileLinePrefixes() []*regexp.Regexp {
+	regexes := make([]*regexp.Regexp, 0, len(lineFormat))
+	pattern := ""
+	for _, f := range lineFormat {
+		pattern += f.pattern
+		regexes = append(regexes, regexp.MustCompile(pattern))
+	}
+
+	return regexes
+}
+
+const (
+	// FieldHost is the remote host field of a line.
+	FieldHost = "host"
+	// FieldLogName is the remote logname field of a line.
+	FieldLogName = "logname"
+	// FieldUser is the auth user field of a line.
+	FieldUser = "user"
+	// FieldDate is the date field of a line.
+	FieldDate = "date"
+	// FieldRequest is the request field of a line.
+	FieldRequest = "request"
+	// FieldStatus is the status field of a line.
+	FieldStatus = "status"
+	// FieldBytes is the size field of a line.
+	FieldBytes = "bytes"
+)
+
+// ParseError describes why a line couldn't be parsed. It wraps ErrInvalidFormatLine.
+type ParseError struct {
+	// Line is the invalid line.
+	Line string
+	// Field is the first invalid field of the line (e.g FieldDate).
+	Field  string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: invalid %s: %s", ErrInvalidFormatLine, e.Field, e.Reason)
+}
+
+// Unwrap makes the errors.Is(err, ErrInvalidFormatLine) checks succeed.
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidFormatLine
+}
+
+// formatError finds the first field of a line which doesn't match the format.
+func formatError(raw string) *ParseError {
+	for i, regex := range linePrefixRegexes {
+		if !regex.MatchString(raw) {
+			return &ParseError{Line: raw, Field: lineFormat[i].field, Reason: "expected " + lineFormat[i].expected}
+		}
+	}
+
+	// Not reached, the last prefix is the whole line.
+	return &ParseError{Line: raw, Field: FieldBytes, Reason: "expected " + lineFormat[len(lineFormat)-1].expected}
+}
+
 const (
 	// Fields with missing data are represented as "-" (https://en.wikipedia.org/wiki/Common_Log_Format).
 	missingData = "-"
@@ -43,6 +113,14 @@ const (
 	RequestURLSectionLabel = "section"
 	// RequestProtocolLabel is the label used to store requests' protocols into dabatase.
 	RequestProtocolLabel = "protocol"
+	// RouteLabel is the label used to store requests' routes (see Request.Route) into database.
+	RouteLabel = "route"
+	// SourceLabel is the label used to store the source of the entries (e.g the logging file) into database.
+	SourceLabel = "source"
+	// SyslogHostLabel is the label used to store the hostname of the syslog messages into database.
+	SyslogHostLabel = "syslog_host"
+	// SyslogAppLabel is the label used to store the application name of the syslog messages into database.
+	SyslogAppLabel = "syslog_app"
 )
 
 // Request contains information about the method used, the URL and the protocol.
@@ -74,16 +152,32 @@ func (r *Request) Section() string {
 
 // NewRequest is used to create a request from a raw string.
 func NewRequest(raw string) (*Request, error) {
-	entries := strings.Split(raw, " ")
-	if len(entries) != 3 {
+	request := &Request{}
+	if !request.parse(raw) {
 		return nil, ErrInvalidFormatLine
 	}
 
-	return &Request{
-		Method:   entries[0],
-		URL:      entries[1],
-		Protocol: entries[2],
-	}, nil
+	return request, nil
+}
+
+// parse splits a raw "METHOD URL PROTOCOL" string, separated by exactly two spaces. The request is unchanged if the
+// string is invalid.
+func (r *Request) parse(raw string) bool {
+	first := strings.IndexByte(raw, ' ')
+	if first < 0 {
+		return false
+	}
+	second := strings.IndexByte(raw[first+1:], ' ')
+	if second < 0 {
+		return false
+	}
+	second += first + 1
+	if strings.IndexByte(raw[second+1:], ' ') >= 0 {
+		return false
+	}
+
+	r.Method, r.URL, r.Protocol = raw[:first], raw[first+1:second], raw[second+1:]
+	return true
 }
 
 // LoggingEntry holds parsed information about a w3c-formatted HTTP access log (https://www.w3.org/Daemon/User/Config/Logging.html#common-logfile-format).
@@ -95,6 +189,13 @@ type LoggingEntry struct {
 	Request       *Request
 	Status        int
 	Bytes         int
+	// Referer and UserAgent are only given by the lines in the combined format.
+	Referer   string
+	UserAgent string
+	// Source is where the entry was read from (e.g the path of the logging file). It's optional.
+	Source string
+	// ExtraLabels are given by the source (e.g the syslog hostname). They are optional.
+	ExtraLabels map[string]string
 }
 
 func (l *LoggingEntry) String() string {
@@ -115,8 +216,9 @@ func (l *LoggingEntry) String() string {
 }
 
 // Labels returns a map between labels used to store into database and their logging values.
+// The source label is present only for entries with a known source. The extra labels can't replace the other ones.
 func (l *LoggingEntry) Labels() map[string]string {
-	return map[string]string{
+	labels := map[string]string{
 		HostLabel:              l.RemoteHost,
 		LogNameLabel:           l.RemoteLogname,
 		UserLabel:              l.AuthUser,
@@ -124,60 +226,107 @@ func (l *LoggingEntry) Labels() map[string]string {
 		RequestURLLabel:        l.Request.URL,
 		RequestProtocolLabel:   l.Request.Protocol,
 		RequestURLSectionLabel: l.Request.Section(),
+		RouteLabel:             l.Request.Route(),
 		StatusLabel:            strconv.Itoa(l.Status),
 	}
+	if l.Source != "" {
+		labels[SourceLabel] = l.Source
+	}
+	for name, value := range l.ExtraLabels {
+		if _, ok := labels[name]; !ok {
+			labels[name] = value
+		}
+	}
+
+	return labels
 }
 
-// NewLoggingEntry creates a LoggingLine from a raw string.
+// NewLoggingEntry creates a LoggingLine from a raw string, in the common or combined format.
+// The errors are *ParseError, describing the first invalid field of the line.
 func NewLoggingEntry(raw string) (*LoggingEntry, error) {
-	entries := lineRegex.FindStringSubmatch(raw)
-	if len(entries) != 8 {
-		return nil, ErrInvalidFormatLine
+	// The entry and its request are allocated at once.
+	e := &struct {
+		entry   LoggingEntry
+		request Request
+	}{}
+	e.entry.Request = &e.request
+
+	if err := ParseLoggingEntry(raw, &e.entry); err != nil {
+		return nil, err
+	}
+
+	return &e.entry, nil
+}
+
+// ParseLoggingEntry parses a raw string into an existing entry, replacing all its fields. The request of the entry is
+// reused if it's set, so parsing the lines into the same entry doesn't allocate. The fields of the entry are strings
+// sharing the memory of the raw string.
+// The errors are *ParseError, describing the first invalid field of the line. The entry is undefined after an error.
+func ParseLoggingEntry(raw string, entry *LoggingEntry) error {
+	var fields lineFields
+	if !splitLine(raw, &fields) {
+		return formatError(raw)
 	}
 
 	var err error
 	var date time.Time
-	if entries[4] != missingData {
-		// First check the format "02/Jan/2006:15:04:05 -0700"
-		date, err = time.Parse("02/Jan/2006:15:04:05 -0700", entries[4])
+	if fields[fieldDate] != missingData {
+		date, err = parseDate(fields[fieldDate])
 		if err != nil {
-			// Otherwise try to use dateparse library that is supposed to support multiple formats except the one above :).
-			date, err = dateparse.ParseAny(entries[4])
-			if err != nil {
-				// TODO wrap the error
-				return nil, ErrInvalidFormatLine
-			}
+			return &ParseError{Line: raw, Field: FieldDate, Reason: err.Error()}
 		}
 	}
 
-	request, err := NewRequest(entries[5])
-	if err != nil {
-		return nil, err
+	request := entry.Request
+	if request == nil {
+		request = &Request{}
+	}
+	if !request.parse(fields[fieldRequest]) {
+		return &ParseError{Line: raw, Field: FieldRequest, Reason: fmt.Sprintf("%q isn't \"METHOD URL PROTOCOL\"", fields[fieldRequest])}
 	}
 
 	var status int
-	if entries[6] != missingData {
-		status, err = strconv.Atoi(entries[6])
+	if fields[fieldStatus] != missingData {
+		status, err = strconv.Atoi(fields[fieldStatus])
 		if err != nil {
-			return nil, err
+			return &ParseError{Line: raw, Field: FieldStatus, Reason: err.Error()}
 		}
 	}
 
 	var bytes int
-	if entries[7] != missingData {
-		bytes, err = strconv.Atoi(entries[7])
+	if fields[fieldBytes] != missingData {
+		bytes, err = strconv.Atoi(fields[fieldBytes])
 		if err != nil {
-			return nil, err
+			return &ParseError{Line: raw, Field: FieldBytes, Reason: err.Error()}
 		}
 	}
 
-	return &LoggingEntry{
-		RemoteHost:    entries[1],
-		RemoteLogname: entries[2],
-		AuthUser:      entries[3],
+	*entry = LoggingEntry{
+		RemoteHost:    fields[fieldHost],
+		RemoteLogname: fields[fieldLogName],
+		AuthUser:      fields[fieldUser],
 		Date:          date,
 		Request:       request,
 		Status:        status,
 		Bytes:         bytes,
-	}, nil
+		Referer:       fields[fieldReferer],
+		UserAgent:     fields[fieldUserAgent],
+	}
+	return nil
+}
+
+// parseDate parses the date of a line. The format "02/Jan/2006:15:04:05 -0700" is expected, but the other formats
+// supported by the dateparse library are accepted too.
+func parseDate(raw string) (time.Time, error) {
+	if date, ok := parseCLFDate(raw); ok {
+		return date, nil
+	}
+
+	date, err := time.Parse(clfDateLayout, raw)
+	if err == nil {
+		return date, nil
+	}
+
+	// Otherwise try to use dateparse library that is supposed to support multiple formats except the one above :).
+	return dateparse.ParseAny(raw)
 }
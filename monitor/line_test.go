@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"errors"
 	"reflect"
 	"strconv"
 	"testing"
@@ -9,6 +10,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// testEntry returns an entry of a user at a date, the tests change its other fields when they need to.
+func testEntry(user string, date time.Time) *LoggingEntry {
+	return &LoggingEntry{RemoteHost: "127.0.0.1", RemoteLogname: "-", AuthUser: user, Date: date, Request: &Request{Method: "GET", URL: "/report", Protocol: "HTTP/1.0"}, Status: 200, Bytes: 123}
+}
+
 func TestRequestSection(t *testing.T) {
 	requestWithoutDashes := &Request{URL: "pages"}
 	require.Equal(t, "pages", requestWithoutDashes.Section(), "Unexpected section")
@@ -24,14 +30,22 @@ func TestLoggingEntryInvalidFormat(t *testing.T) {
 	entry, err := NewLoggingEntry("invalid")
 
 	require.Nil(t, entry, "Unexpected logging entry")
-	require.Equal(t, ErrInvalidFormatLine, err, "Unexpected error")
+	require.True(t, errors.Is(err, ErrInvalidFormatLine), "Unexpected error %v", err)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr), "Unexpected error %v", err)
+	require.Equal(t, FieldHost, parseErr.Field, "Unexpected invalid field")
 }
 
 func TestLoggingEntryInvalidDate(t *testing.T) {
 	entry, err := NewLoggingEntry("127.0.0.1 - james [40/May/2018:16:00:39 ] \"GET /report HTTP/1.0\" 200 123")
 
 	require.Nil(t, entry, "Unexpected logging entry")
-	require.Equal(t, ErrInvalidFormatLine, err, "Unexpected error")
+	require.True(t, errors.Is(err, ErrInvalidFormatLine), "Unexpected error %v", err)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr), "Unexpected error %v", err)
+	require.Equal(t, FieldDate, parseErr.Field, "Unexpected invalid field")
 }
 
 func TestLoggingEntry(t *testing.T) {
@@ -58,21 +72,33 @@ func TestLoggingEntryInvalidRequest(t *testing.T) {
 	entry, err := NewLoggingEntry("127.0.0.1 - james [09 May 2018 16:00 +0000] \"GET /report\" 200 123")
 
 	require.Nil(t, entry, "Unexpected logging entry")
-	require.Equal(t, ErrInvalidFormatLine, err, "Unexpected error")
+	require.True(t, errors.Is(err, ErrInvalidFormatLine), "Unexpected error %v", err)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr), "Unexpected error %v", err)
+	require.Equal(t, FieldRequest, parseErr.Field, "Unexpected invalid field")
 }
 
 func TestLoggingEntryInvalidStatus(t *testing.T) {
 	entry, err := NewLoggingEntry("127.0.0.1 - james [09 May 2018 16:00 +0000] \"GET /report HTTP/1.0\" 20 123")
 
 	require.Nil(t, entry, "Unexpected logging entry")
-	require.Equal(t, ErrInvalidFormatLine, err, "Unexpected error")
+	require.True(t, errors.Is(err, ErrInvalidFormatLine), "Unexpected error %v", err)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr), "Unexpected error %v", err)
+	require.Equal(t, FieldStatus, parseErr.Field, "Unexpected invalid field")
 }
 
 func TestLoggingEntryInvalidSize(t *testing.T) {
 	entry, err := NewLoggingEntry("127.0.0.1 - james [09 May 2018 16:00 +0000] \"GET /report HTTP/1.0\" 123 invalid")
 
 	require.Nil(t, entry, "Unexpected logging entry")
-	require.Equal(t, ErrInvalidFormatLine, err, "Unexpected error")
+	require.True(t, errors.Is(err, ErrInvalidFormatLine), "Unexpected error %v", err)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr), "Unexpected error %v", err)
+	require.Equal(t, FieldBytes, parseErr.Field, "Unexpected invalid field")
 }
 
 func TestLabels(t *testing.T) {
@@ -85,8 +111,23 @@ func TestLabels(t *testing.T) {
 		RequestURLLabel:        entry.Request.URL,
 		RequestProtocolLabel:   entry.Request.Protocol,
 		RequestURLSectionLabel: entry.Request.Section(),
+		RouteLabel:             entry.Request.Route(),
 		StatusLabel:            strconv.Itoa(entry.Status),
 	}
 
 	require.True(t, reflect.DeepEqual(expectedLabels, entry.Labels()), "Unexpected labels")
 }
+
+func TestLabelsWithSource(t *testing.T) {
+	entry := &LoggingEntry{RemoteHost: "127.0.0.1", RemoteLogname: "-", AuthUser: "james", Date: time.Now(), Request: &Request{Method: "GET", URL: "/report", Protocol: "HTTP/1.0"}, Status: 200, Bytes: 123, Source: "/var/log/nginx/a.access.log"}
+
+	require.Equal(t, "/var/log/nginx/a.access.log", entry.Labels()[SourceLabel], "Unexpected source label")
+}
+
+func TestLabelsWithExtraLabels(t *testing.T) {
+	entry := &LoggingEntry{RemoteHost: "127.0.0.1", RemoteLogname: "-", AuthUser: "james", Date: time.Now(), Request: &Request{Method: "GET", URL: "/report", Protocol: "HTTP/1.0"}, Status: 200, Bytes: 123, ExtraLabels: map[string]string{SyslogHostLabel: "web1", HostLabel: "ignored"}}
+
+	labels := entry.Labels()
+	require.Equal(t, "web1", labels[SyslogHostLabel], "Unexpected syslog host label")
+	require.Equal(t, "127.0.0.1", labels[HostLabel], "The extra labels can't replace the other ones")
+}
@@ -0,0 +1,243 @@
+package monitor
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/tsdb/labels"
+)
+
+// ErrEntryTooOld is returned by the memory storage for the entries older than its window.
+var ErrEntryTooOld = errors.New("entry older than the storage window")
+
+// memorySeries counts the hits and the bytes of a series during one second.
+type memorySeries struct {
+	labels map[string]string
+	hits   float64
+	bytes  float64
+}
+
+// memoryBucket holds the series of one second.
+type memoryBucket struct {
+	timestamp int64
+	series    map[string]*memorySeries
+}
+
+// MemoryStorage keeps the entries of a short window in memory, without any disk. The hits are counted by series and
+// by second, in a ring of buckets: the bucket of a second is reused once the second leaves the window.
+type MemoryStorage struct {
+	*labeler
+	top *topCounter
+
+	mu      sync.RWMutex
+	buckets []memoryBucket
+	// newest is the timestamp of the newest entry. The window ends with it.
+	newest int64
+}
+
+// NewMemoryStorage creates a memory storage keeping the entries of a window before the newest one.
+// DefaultRetention is used if the window isn't positive.
+func NewMemoryStorage(window time.Duration, labels LabelConfig) *MemoryStorage {
+	if window <= 0 {
+		window = DefaultRetention
+	}
+
+	size := int64(window / time.Second)
+	if size < 1 {
+		size = 1
+	}
+
+	l := newLabeler(labels, window)
+	l.distinct = newDistinctCounter(labels.DistinctLabels, window)
+
+	return &MemoryStorage{
+		labeler: l,
+		top:     newTopCounter(labels.TopLabels, window, math.MinInt64),
+		buckets: make([]memoryBucket, size),
+	}
+}
+
+// AddEntry adds a new entry. ErrEntryTooOld is returned if it's older than the window.
+func (ms *MemoryStorage) AddEntry(entry *LoggingEntry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.add(entry)
+}
+
+// AddEntries adds a batch of entries. The entries older than the window are skipped.
+func (ms *MemoryStorage) AddEntries(entries []*LoggingEntry) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	skipped := 0
+	for _, entry := range entries {
+		if err := ms.add(entry); err != nil {
+			skipped++
+		}
+	}
+
+	return skipped, nil
+}
+
+func (ms *MemoryStorage) add(entry *LoggingEntry) error {
+	timestamp := entry.Date.Unix()
+	size := int64(len(ms.buckets))
+	if timestamp <= ms.newest-size {
+		return ErrEntryTooOld
+	}
+	if timestamp > ms.newest {
+		ms.newest = timestamp
+	}
+
+	bucket := &ms.buckets[mod(timestamp, size)]
+	if bucket.timestamp != timestamp || bucket.series == nil {
+		// The bucket was used by a second which left the window.
+		bucket.timestamp = timestamp
+		bucket.series = make(map[string]*memorySeries)
+	}
+
+	entryLabels := ms.labels(entry)
+	key := labels.FromMap(entryLabels).String()
+	series, ok := bucket.series[key]
+	if !ok {
+		series = &memorySeries{labels: entryLabels}
+		bucket.series[key] = series
+	}
+	series.hits++
+	series.bytes += float64(entry.Bytes)
+	ms.top.add(timestamp, func(name string) string { return entryLabels[name] }, 1)
+
+	return nil
+}
+
+// mod returns the positive remainder of a division, even for the timestamps before 1970.
+func mod(a int64, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+
+	return m
+}
+
+// forEachSeries calls "fn" with the labels and the hits of each series of the window selected by the matchers, or with
+// its bytes, once per second.
+func (ms *MemoryStorage) forEachSeries(since int64, until int64, bytes bool, matchers []labels.Matcher, fn func(timestamp int64, seriesLabels map[string]string, value float64)) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	oldest := ms.newest - int64(len(ms.buckets))
+	for _, bucket := range ms.buckets {
+		if bucket.series == nil || bucket.timestamp <= oldest || bucket.timestamp < since || bucket.timestamp > until {
+			continue
+		}
+
+		for _, series := range bucket.series {
+			if !matchesAll(matchers, series.labels) {
+				continue
+			}
+			if bytes {
+				fn(bucket.timestamp, series.labels, series.bytes)
+			} else {
+				fn(bucket.timestamp, series.labels, series.hits)
+			}
+		}
+	}
+}
+
+// sumBy adds up the hits of the series selected by the matchers, grouped by the values of "groupLabel".
+func (ms *MemoryStorage) sumBy(groupLabel string, since int64, until int64, matchers []labels.Matcher) EntryList {
+	m := make(map[string]float64)
+	ms.forEachSeries(since, until, false, matchers, func(_ int64, seriesLabels map[string]string, hits float64) {
+		m[seriesLabels[groupLabel]] += hits
+	})
+
+	return mapToEntryList(m)
+}
+
+// GetEntries can be used to collect all entries from a given label that match the pattern, and all the other matchers.
+func (ms *MemoryStorage) GetEntries(label string, pattern string, since int64, until int64, matchers ...Matcher) (EntryList, error) {
+	return ms.TopEntriesBy(label, label, pattern, since, until, 0, matchers...)
+}
+
+// TopEntries can be used to collect top entries from a given label that match the pattern.
+// The heavy hitters of the tracked labels answer the queries without pattern nor matchers.
+func (ms *MemoryStorage) TopEntries(label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error) {
+	entries, ok, err := ms.top.top(label, pattern, since, until, limit, matchers, func(since int64, until int64) (EntryList, error) {
+		return ms.GetEntries(label, pattern, since, until)
+	})
+	if ok {
+		return entries, err
+	}
+
+	return ms.TopEntriesBy(label, label, pattern, since, until, limit, matchers...)
+}
+
+// TopEntriesBy returns the top values of "groupLabel" from the entries whose "label" matches the pattern.
+func (ms *MemoryStorage) TopEntriesBy(groupLabel string, label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error) {
+	compiled, err := compileMatchers(label, pattern, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	return topN(ms.sumBy(groupLabel, since, until, compiled), limit), nil
+}
+
+// GetRange can be used to collect the entries from a given label that match the pattern, counted by step.
+func (ms *MemoryStorage) GetRange(label string, pattern string, since int64, until int64, step int64, matchers ...Matcher) (SeriesList, error) {
+	compiled, err := compileMatchers(label, pattern, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := newRangeAccumulator(since, until, step)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.forEachSeries(since, until, false, compiled, func(timestamp int64, seriesLabels map[string]string, hits float64) {
+		acc.add(seriesLabels[label], timestamp, hits)
+	})
+
+	return acc.list(), nil
+}
+
+// Query adds up the hits or the bytes of the entries matching all the matchers of the query, grouped by its labels.
+func (ms *MemoryStorage) Query(query Query) (GroupList, error) {
+	matchers, err := query.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	acc := newGroupAccumulator(query.GroupBy)
+	ms.forEachSeries(query.Since, query.Until, query.Bytes, matchers, func(_ int64, seriesLabels map[string]string, value float64) {
+		if query.GroupBySeries {
+			acc.addSeries(seriesLabels, value)
+		} else {
+			acc.add(func(name string) string { return seriesLabels[name] }, value)
+		}
+	})
+
+	return acc.list(query.Limit), nil
+}
+
+// Close does nothing, the entries are kept until the storage is garbage collected.
+func (ms *MemoryStorage) Close() error {
+	return nil
+}
+
+// Cleanup drops all the entries.
+func (ms *MemoryStorage) Cleanup() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i := range ms.buckets {
+		ms.buckets[i] = memoryBucket{}
+	}
+	ms.newest = 0
+
+	return nil
+}
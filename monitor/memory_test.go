@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ms := NewMemoryStorage(time.Minute, LabelConfig{})
+	now := time.Now()
+
+	entry := func(host string, user string, url string, date time.Time) *LoggingEntry {
+		return &LoggingEntry{RemoteHost: host, RemoteLogname: "-", AuthUser: user, Date: date, Request: &Request{Method: "GET", URL: url, Protocol: "HTTP/1.0"}, Status: 200, Bytes: 123}
+	}
+	skipped, err := ms.AddEntries([]*LoggingEntry{
+		entry("127.0.0.1", "james", "/report/user", now),
+		entry("127.0.0.1", "james", "/report/user", now),
+		entry("127.0.0.1", "jill", "/home", now.Add(time.Second)),
+		entry("172.16.0.1", "james", "/report/summary", now.Add(-time.Second)),
+	})
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+	require.Equal(t, 0, skipped, "Unexpected skipped entries")
+
+	entries, err := ms.GetEntries(UserLabel, "james", now.Unix(), now.Add(time.Second).Unix())
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "james", Value: 2.0}}, entries)
+
+	entries, err = ms.TopEntries(RequestURLSectionLabel, AllEntriesPattern, now.Add(-time.Second).Unix(), now.Unix(), 1)
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "/report", Value: 3.0}}, entries)
+
+	entries, err = ms.TopEntriesBy(HostLabel, UserLabel, "james", now.Add(-time.Minute).Unix(), now.Add(time.Minute).Unix(), 0)
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "127.0.0.1", Value: 2.0}, {Key: "172.16.0.1", Value: 1.0}}, entries)
+
+	_, err = ms.GetEntries(UserLabel, "(", now.Unix(), now.Unix())
+	require.NotNil(t, err, "The pattern is invalid")
+}
+
+func TestMemoryStorageWindow(t *testing.T) {
+	ms := NewMemoryStorage(10*time.Second, LabelConfig{})
+	now := time.Now()
+
+	require.Nil(t, ms.AddEntry(testEntry("james", now)), "Unexpected error raised")
+	// The entries out of order are accepted in the window.
+	require.Nil(t, ms.AddEntry(testEntry("jill", now.Add(-9*time.Second))), "Unexpected error raised")
+	require.Equal(t, ErrEntryTooOld, ms.AddEntry(testEntry("jill", now.Add(-10*time.Second))))
+
+	// The newest entry moves the window: the bucket of the first entry is reused.
+	require.Nil(t, ms.AddEntry(testEntry("frank", now.Add(10*time.Second))), "Unexpected error raised")
+	entries, err := ms.TopEntries(UserLabel, AllEntriesPattern, now.Add(-time.Hour).Unix(), now.Add(time.Hour).Unix(), 0)
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Equal(t, EntryList{{Key: "frank", Value: 1.0}}, entries)
+
+	skipped, err := ms.AddEntries([]*LoggingEntry{testEntry("james", now), testEntry("james", now.Add(5*time.Second))})
+	require.Nil(t, err, "No error should be returned while adding the entries.")
+	require.Equal(t, 1, skipped, "Unexpected skipped entries")
+
+	require.Nil(t, ms.Cleanup(), "Unexpected error raised")
+	entries, err = ms.GetEntries(UserLabel, AllEntriesPattern, now.Add(-time.Hour).Unix(), now.Add(time.Hour).Unix())
+	require.Nil(t, err, "No error should be returned while getting the entries.")
+	require.Empty(t, entries)
+}
+
+// TestMemoryStorageSameAsTSDB checks that both storages give the same results for the entries of their window.
+func TestMemoryStorageSameAsTSDB(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+	ms := NewMemoryStorage(time.Hour, LabelConfig{})
+
+	r := rand.New(rand.NewSource(1))
+	users := []string{"james", "jill", "frank", "-"}
+	urls := []string{"/", "/report", "/report/user", "/home/index.html"}
+	start := time.Now().Add(-time.Minute)
+
+	var entries []*LoggingEntry
+	for i := 0; i < 1000; i++ {
+		entry := testEntry(users[r.Intn(len(users))], start.Add(time.Duration(i/20)*time.Second))
+		entry.Request.URL = urls[r.Intn(len(urls))]
+		entry.Status = []int{200, 404, 500}[r.Intn(3)]
+		entries = append(entries, entry)
+	}
+
+	// The series are added in order, as expected by the timeseries database.
+	_, err = db.AddEntries(entries)
+	require.Nil(t, err, "Unexpected error raised")
+	_, err = ms.AddEntries(entries)
+	require.Nil(t, err, "Unexpected error raised")
+
+	for i := 0; i < 20; i++ {
+		since := start.Add(time.Duration(r.Intn(50)) * time.Second).Unix()
+		until := since + int64(r.Intn(20))
+		for _, query := range []struct{ group, label, pattern string }{
+			{UserLabel, UserLabel, AllEntriesPattern},
+			{RequestURLSectionLabel, RequestURLSectionLabel, "/report.*"},
+			{HostLabel, StatusLabel, "5.."},
+			{StatusLabel, UserLabel, "j.*"},
+		} {
+			expected, err := db.TopEntriesBy(query.group, query.label, query.pattern, since, until, 0)
+			require.Nil(t, err, "Unexpected error raised")
+			actual, err := ms.TopEntriesBy(query.group, query.label, query.pattern, since, until, 0)
+			require.Nil(t, err, "Unexpected error raised")
+			require.ElementsMatch(t, expected, actual, "Unexpected entries for %+v between %d and %d", query, since, until)
+		}
+
+		query := Query{
+			Matchers: []Matcher{{StatusLabel, MatchNotEqual, "404"}, {UserLabel, MatchNotRegexp, "-"}},
+			GroupBy:  []string{UserLabel, RequestURLSectionLabel},
+			Since:    since,
+			Until:    until,
+		}
+		expected, err := db.Query(query)
+		require.Nil(t, err, "Unexpected error raised")
+		actual, err := ms.Query(query)
+		require.Nil(t, err, "Unexpected error raised")
+		require.Equal(t, expected, actual, "Unexpected groups between %d and %d", since, until)
+	}
+}
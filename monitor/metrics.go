@@ -0,0 +1,28 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace prefixes the names of the metrics.
+const metricsNamespace = "httpmonitor"
+
+// metrics are the Prometheus metrics of a monitor, served by the HTTP API.
+type metrics struct {
+	registry    *prometheus.Registry
+	parseErrors *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		parseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "parse_errors_total",
+			Help:      "Number of lines which couldn't be parsed, by first invalid field.",
+		}, []string{"field"}),
+	}
+	m.registry.MustRegister(m.parseErrors)
+
+	return m
+}
@@ -2,59 +2,308 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"runtime"
 	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/sync/errgroup"
 )
 
-// Monitor stores information neccessary to monitor the activity from a logging file.
+// Monitor stores information neccessary to monitor the activity from logging files.
 type Monitor struct {
-	db         *LoggingDatabase
+	db         Storage
 	errg       *errgroup.Group
 	ctx        context.Context
 	cancelFunc context.CancelFunc
-	filename   string
+	patterns   []string
+	sources    []LineSource
 	alerts     []*Alert
+	notifiers  []Notifier
+	grouping   *GroupConfig
+	grouper    *Grouper
+	inhibition []InhibitRule
+	inhibitor  *Inhibitor
+	apiAddress string
+	checkpoint *Checkpoint
+	backfill   int
+	ingest     *IngestConfig
+	deadLetter *DeadLetter
+	workers    int
+	database   DatabaseConfig
+	statsMatch []Matcher
+	writing    WriterConfig
+	writer     *batchWriter
+	metrics    *metrics
 }
 
-// NewMonitor is used to create a new monitoring for a specifc file, with some configured alerts.
-func NewMonitor(filename string, alerts []*Alert) (*Monitor, error) {
-	db, err := NewLoggingDatabase()
+// checkpointInterval is how often the read positions are saved.
+var checkpointInterval = 5 * time.Second
+
+// Option is used to customize a monitor.
+type Option func(*Monitor)
+
+// WithNotifiers sends the notifications of all alerts to the given notifiers, instead of the standard output. The
+// notifiers which are io.Closer are closed by Stop.
+func WithNotifiers(ns ...Notifier) Option {
+	return func(m *Monitor) {
+		m.notifiers = ns
+	}
+}
+
+// WithGrouping groups the alert events and sends one combined notification per group.
+func WithGrouping(config GroupConfig) Option {
+	return func(m *Monitor) {
+		m.grouping = &config
+	}
+}
+
+// WithInhibitRules drops the notifications of the alerts inhibited by the rules.
+func WithInhibitRules(rules []InhibitRule) Option {
+	return func(m *Monitor) {
+		m.inhibition = rules
+	}
+}
+
+// WithAPI serves the HTTP API on the given address (e.g ":8080") while the monitor is running.
+func WithAPI(address string) Option {
+	return func(m *Monitor) {
+		m.apiAddress = address
+	}
+}
+
+// WithIngest accepts the batches of logging lines pushed to the HTTP API (see WithAPI).
+func WithIngest(config IngestConfig) Option {
+	return func(m *Monitor) {
+		m.ingest = &config
+	}
+}
+
+// WithParseWorkers parses the lines with n workers in parallel. By default, there is one worker per CPU.
+func WithParseWorkers(n int) Option {
+	return func(m *Monitor) {
+		m.workers = n
+	}
+}
+
+// WithWriter configures how the entries are written into the database.
+func WithWriter(config WriterConfig) Option {
+	return func(m *Monitor) {
+		m.writing = config
+	}
+}
+
+// WithDatabase configures where and how long the entries are stored. By default, they are stored in a temporary
+// directory, deleted when the monitor is stopped.
+func WithDatabase(config DatabaseConfig) Option {
+	return func(m *Monitor) {
+		m.database = config
+	}
+}
+
+// WithStatsMatchers restricts the printed traffic stats to the entries matching all the matchers.
+func WithStatsMatchers(matchers ...Matcher) Option {
+	return func(m *Monitor) {
+		m.statsMatch = matchers
+	}
+}
+
+// WithDeadLetter writes the lines which can't be parsed into a dead-letter file.
+func WithDeadLetter(deadLetter *DeadLetter) Option {
+	return func(m *Monitor) {
+		m.deadLetter = deadLetter
+	}
+}
+
+// WithCheckpoint saves the read position of each file into a checkpoint, so the monitoring is resumed from the same
+// position after a restart.
+func WithCheckpoint(checkpoint *Checkpoint) Option {
+	return func(m *Monitor) {
+		m.checkpoint = checkpoint
+	}
+}
+
+// WithBackfill reads the last n rotated versions of each file (e.g "access.log.2.gz", then "access.log.1") before
+// following the files, in the order of the dates of the lines. The backfill is skipped for the files resumed from a
+// checkpoint.
+func WithBackfill(n int) Option {
+	return func(m *Monitor) {
+		m.backfill = n
+	}
+}
+
+// WithSources reads the lines from additional sources, besides the files.
+func WithSources(sources ...LineSource) Option {
+	return func(m *Monitor) {
+		m.sources = append(m.sources, sources...)
+	}
+}
+
+// NewMonitor is used to create a new monitoring for some files, with some configured alerts.
+// The files are given as paths or glob patterns (e.g "/var/log/nginx/*.access.log"). StdinPath reads the standard
+// input instead.
+func NewMonitor(patterns []string, alerts []*Alert, opts ...Option) (*Monitor, error) {
+	m := &Monitor{patterns: patterns, alerts: alerts, workers: runtime.NumCPU(), metrics: newMetrics()}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.ingest != nil {
+		if err := m.ingest.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := OpenStorage(m.database)
 	if err != nil {
 		return nil, err
 	}
+	m.db = db
+	// The storages expose the cardinality of their labels.
+	if collector, ok := db.(prometheus.Collector); ok {
+		m.metrics.registry.MustRegister(collector)
+	}
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
-	errg, ctx := errgroup.WithContext(ctx)
+	m.errg, m.ctx = errgroup.WithContext(ctx)
+	m.cancelFunc = cancelFunc
+
+	m.writer = newBatchWriter(db, m.writing, m.checkpoint, m.metrics)
+	m.setupSources()
+	m.setupNotifications()
+
+	return m, nil
+}
+
+// setupSources creates the sources for the files: the standard input and the followed files.
+func (m *Monitor) setupSources() {
+	var patterns []string
+	for _, pattern := range m.patterns {
+		if pattern == "" {
+			continue
+		}
+		if pattern == StdinPath {
+			m.sources = append(m.sources, NewReaderSource(StdinSource, os.Stdin))
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) > 0 {
+		m.sources = append(m.sources, NewFollowSource(patterns, m.checkpoint, m.backfill))
+	}
+}
+
+// setupNotifications builds the pipeline between the alerts and the notifiers:
+// alerts -> inhibitor -> grouper -> notifiers.
+func (m *Monitor) setupNotifications() {
+	if m.notifiers == nil && m.grouping == nil && len(m.inhibition) == 0 {
+		// Keep the notifiers of the alerts.
+		return
+	}
+
+	var pipeline Notifier = notifiers(m.notifiers)
+	if m.notifiers == nil {
+		pipeline = defaultNotifier
+	}
+
+	if m.grouping != nil {
+		m.grouper = NewGrouper(*m.grouping, pipeline)
+		pipeline = m.grouper
+	}
+
+	if len(m.inhibition) > 0 {
+		m.inhibitor = NewInhibitor(m.inhibition, pipeline)
+		pipeline = m.inhibitor
+	}
 
-	return &Monitor{db: db, errg: errg, filename: filename, ctx: ctx, cancelFunc: cancelFunc, alerts: alerts}, nil
+	for _, a := range m.alerts {
+		a.notifier = pipeline
+	}
 }
 
-// processLogs reads each line from the file, parses it and inserts it into the database.
+// processLogs reads each line from the sources, parses it and queues it to be inserted into the database.
+// Each entry is labeled with the source it was read from. The monitoring continues when a source is exhausted.
 func (m *Monitor) processLogs() error {
-	t, err := tail.TailFile(m.filename, tail.Config{Follow: true})
+	lines := make(chan logLine)
+	errg, ctx := errgroup.WithContext(m.ctx)
+
+	for _, source := range m.sources {
+		source := source
+		errg.Go(func() error {
+			return source.Lines(ctx, lines)
+		})
+	}
+
+	errg.Go(func() error {
+		return m.writer.run(ctx)
+	})
+
+	errg.Go(func() error {
+		return m.parseLines(ctx, lines)
+	})
+
+	return errg.Wait()
+}
+
+// processLine parses a line and queues it to be inserted into the database.
+func (m *Monitor) processLine(ctx context.Context, line logLine) {
+	entry, err := parseLine(line)
+	m.queueEntry(ctx, line, entry, err)
+}
+
+// queueEntry queues a parsed line to be inserted into the database.
+func (m *Monitor) queueEntry(ctx context.Context, line logLine, entry *LoggingEntry, err error) {
+	// Skip invalid entries but don't stop the whole process.
+	if err != nil {
+		m.rejectLine(line, err)
+	}
+
+	m.writer.write(ctx, writeItem{entry: entry, source: line.source, position: line.position})
+}
+
+// rejectLine counts a line which can't be parsed and writes it into the dead-letter file.
+func (m *Monitor) rejectLine(line logLine, err error) {
+	field := "unknown"
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		field = parseErr.Field
+	}
+	m.metrics.parseErrors.WithLabelValues(field).Inc()
+
+	if m.deadLetter == nil {
+		fmt.Printf("Failed to parse one entry from %s: %v: %q\n", line.source, err, line.text)
+		return
+	}
+
+	if err := m.deadLetter.Write(line.source, line.text, err); err != nil {
+		fmt.Printf("Failed to write one entry into the dead-letter file: %v\n", err)
+	}
+}
+
+// parseLine parses a line into an entry labeled with the source of the line.
+func parseLine(line logLine) (*LoggingEntry, error) {
+	entry, err := NewLoggingEntry(line.text)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	entry.Source = line.source
+	entry.ExtraLabels = line.labels
+
+	return entry, nil
+}
 
+// saveCheckpoint periodically saves the read positions.
+func (m *Monitor) saveCheckpoint() error {
 	for {
 		select {
-		case line := <-t.Lines:
-			entry, err := NewLoggingEntry(line.Text)
-			// Skip invalid entries but don't stop the whole process.
-			if err != nil {
-				fmt.Printf("Failed to parse one entry %v\n", err)
-				continue
-			}
-
-			err = m.db.AddEntry(entry)
-			if err != nil {
+		case <-time.After(checkpointInterval):
+			if err := m.checkpoint.Save(); err != nil {
 				return err
 			}
 		case <-m.ctx.Done():
-			fmt.Println("Stop processing logs")
 			return nil
 		}
 	}
@@ -68,7 +317,7 @@ func (m *Monitor) monitorLogs() error {
 			now := time.Now()
 			since := now.Add(-10 * time.Second)
 
-			stats, err := NewStatsSummary(since.Unix(), now.Unix(), m.db)
+			stats, err := NewStatsSummary(since.Unix(), now.Unix(), m.db, m.statsMatch...)
 			if err != nil {
 				return err
 			}
@@ -81,6 +330,24 @@ func (m *Monitor) monitorLogs() error {
 	}
 }
 
+// serveAPI runs the HTTP API until the monitor is stopped.
+func (m *Monitor) serveAPI() error {
+	server := &http.Server{Addr: m.apiAddress, Handler: NewAPI(m)}
+
+	go func() {
+		<-m.ctx.Done()
+		server.Close()
+	}()
+
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		fmt.Println("Stop serving the API")
+		return nil
+	}
+
+	return err
+}
+
 // Run is used to start the monitoring system.
 // It processes the logs and display statistics about the traffic generated in the past 10 seconds.
 // Besides that, it also starts to monitor the activiy for configured alerts.
@@ -89,7 +356,36 @@ func (m *Monitor) Run() error {
 	m.errg.Go(m.processLogs)
 	m.errg.Go(m.monitorLogs)
 
+	if m.grouper != nil {
+		m.errg.Go(func() error {
+			return m.grouper.Run(m.ctx)
+		})
+	}
+
+	for _, n := range m.notifiers {
+		if r, ok := n.(runner); ok {
+			m.errg.Go(func() error {
+				return r.Run(m.ctx)
+			})
+		}
+	}
+
+	if m.apiAddress != "" {
+		m.errg.Go(m.serveAPI)
+	}
+
+	if m.checkpoint != nil {
+		m.errg.Go(m.saveCheckpoint)
+	}
+
+	if r, ok := m.db.(runner); ok {
+		m.errg.Go(func() error {
+			return r.Run(m.ctx)
+		})
+	}
+
 	for _, a := range m.alerts {
+		a := a
 		m.errg.Go(func() error {
 			return a.Run(m.ctx, m.db)
 		})
@@ -99,8 +395,36 @@ func (m *Monitor) Run() error {
 }
 
 // Stop is used to stop the monitoring and to do the cleanup.
+// It waits for the running tasks to finish, so the read positions saved in the checkpoint are final. All the cleanup
+// steps are done even if some of them fail, the first error is returned.
 func (m *Monitor) Stop() error {
 	m.cancelFunc()
+	// The errors are returned by Run.
+	m.errg.Wait()
+
+	var err error
+	cleanup := func(stepErr error) {
+		if stepErr != nil && err == nil {
+			err = stepErr
+		}
+	}
+
+	if m.checkpoint != nil {
+		cleanup(m.checkpoint.Save())
+	}
+
+	if m.deadLetter != nil {
+		cleanup(m.deadLetter.Close())
+	}
+
+	cleanup(closeNotifiers(m.notifiers))
+
+	// Without a directory, the database is temporary.
+	if m.database.Dir == "" {
+		cleanup(m.db.Cleanup())
+	} else {
+		cleanup(m.db.Close())
+	}
 
-	return m.db.Cleanup()
+	return err
 }
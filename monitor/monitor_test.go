@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorStopAfterFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	// The checkpoint can't be saved in a missing directory.
+	checkpoint, err := LoadCheckpoint(filepath.Join(dir, "missing", "offsets.json"))
+	require.Nil(t, err, "Unexpected error raised")
+	deadLetter, err := OpenDeadLetter(filepath.Join(dir, "dead.log"), 0, 0)
+	require.Nil(t, err, "Unexpected error raised")
+	config := DatabaseConfig{Dir: filepath.Join(dir, "data")}
+
+	notifier, err := (&NotifierConfig{Type: "file", Path: filepath.Join(dir, "alerts.log")}).Notifier()
+	require.Nil(t, err, "Unexpected error raised")
+
+	m, err := NewMonitor(nil, nil, WithCheckpoint(checkpoint), WithDeadLetter(deadLetter), WithDatabase(config), WithNotifiers(notifier))
+	require.Nil(t, err, "Unexpected error raised")
+	require.NotNil(t, m.Stop(), "The error of the checkpoint should be returned")
+
+	// The other steps are done anyway.
+	require.Nil(t, deadLetter.file, "The dead-letter file should be closed")
+	require.NotNil(t, notifier.(*fileNotifier).file.Close(), "The file of the notifier should be closed")
+	db, err := OpenLoggingDatabase(config)
+	require.Nil(t, err, "The database should be closed")
+	require.Nil(t, db.Close())
+}
@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"text/template"
+	"time"
+)
+
+// AlertEvent describes a change of an alert's status.
+type AlertEvent struct {
+	Name        string
+	Status      Status
+	Value       float64
+	Threshold   float64
+	Window      time.Duration
+	Label       string
+	Pattern     string
+	Labels      map[string]string
+	TopSections EntryList
+	TopHosts    EntryList
+	Time        time.Time
+	// Message is rendered from the alert's message template.
+	Message string
+}
+
+// Firing reports whether the alert is in the critical state.
+func (e *AlertEvent) Firing() bool {
+	return e.Status == Critical
+}
+
+// alertLabels returns the labels of an alert, including its name as "alertname".
+func alertLabels(name string, labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for n, v := range labels {
+		result[n] = v
+	}
+	result[AlertNameLabel] = name
+
+	return result
+}
+
+// Notification is what notifiers receive: one or more alert events.
+type Notification struct {
+	// GroupLabels identify the group of the alerts, when the events are grouped.
+	GroupLabels map[string]string
+	Alerts      []*AlertEvent
+}
+
+// Notifier is used to deliver notifications about alerts.
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// runner is implemented by the notification stages and the storages that need a background task.
+type runner interface {
+	Run(ctx context.Context) error
+}
+
+// notifiers sends each notification to multiple notifiers.
+type notifiers []Notifier
+
+func (ns notifiers) Notify(n *Notification) error {
+	var errs []string
+	for _, notifier := range ns {
+		if err := notifier.Notify(n); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send notification: %v", errs)
+	}
+
+	return nil
+}
+
+// closeNotifiers closes the notifiers which are io.Closer, and returns the first error.
+func closeNotifiers(ns []Notifier) error {
+	var err error
+	for _, notifier := range ns {
+		if c, ok := notifier.(io.Closer); ok {
+			if closeErr := c.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+
+	return err
+}
+
+// discardNotifier drops all notifications.
+type discardNotifier struct{}
+
+func (discardNotifier) Notify(*Notification) error { return nil }
+
+// WriterNotifier writes the notifications to an io.Writer (e.g the standard output).
+type WriterNotifier struct {
+	w        io.Writer
+	template *template.Template
+}
+
+// NewWriterNotifier is used to create a notifier writing to w. If tmpl is nil, DefaultNotificationTemplate is used.
+func NewWriterNotifier(w io.Writer, tmpl *template.Template) *WriterNotifier {
+	if tmpl == nil {
+		tmpl = template.Must(NewTemplate("notification", DefaultNotificationTemplate))
+	}
+
+	return &WriterNotifier{w: w, template: tmpl}
+}
+
+// Notify renders the notification and writes it.
+func (wn *WriterNotifier) Notify(n *Notification) error {
+	text, err := executeTemplate(wn.template, n)
+	if err != nil {
+		return fmt.Errorf("failed to render notification: %w", err)
+	}
+
+	_, err = io.WriteString(wn.w, text)
+	return err
+}
+
+// fileNotifier appends the notifications to a file, which is closed by Close.
+type fileNotifier struct {
+	*WriterNotifier
+	file *os.File
+}
+
+// Close closes the file.
+func (fn *fileNotifier) Close() error {
+	return fn.file.Close()
+}
+
+// NotifierConfig describes a notifier in a configuration file.
+type NotifierConfig struct {
+	// Type is one of "stdout", "file" or "alertmanager".
+	Type string `json:"type"`
+	// Path is the file where the notifications are appended, for the "file" notifiers.
+	Path string `json:"path"`
+	// Template is used to render the notifications. It receives a Notification.
+	// For the "alertmanager" notifiers, it renders the "description" annotation of each alert.
+	Template string `json:"template"`
+	// URL is the address of the Alertmanager (e.g "http://localhost:9093").
+	URL string `json:"url"`
+	// GeneratorURL is sent as the "generatorURL" of the alerts.
+	GeneratorURL string `json:"generator_url"`
+	// ResendInterval is how often the firing alerts are sent again to the Alertmanager.
+	ResendInterval Duration `json:"resend_interval"`
+}
+
+// Validate checks the notifier configuration.
+func (c *NotifierConfig) Validate() error {
+	switch c.Type {
+	case "stdout":
+	case "file":
+		if c.Path == "" {
+			return errors.New("file notifier without path")
+		}
+	case "alertmanager":
+		if _, err := url.ParseRequestURI(c.URL); err != nil {
+			return fmt.Errorf("alertmanager notifier with invalid url: %w", err)
+		}
+		if c.ResendInterval < 0 {
+			return errors.New("alertmanager notifier with negative resend_interval")
+		}
+	default:
+		return fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+
+	if c.Template != "" {
+		if _, err := NewTemplate(c.Type, c.Template); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Notifier creates the notifier described by the configuration. The "file" notifiers are io.Closer, they must be
+// closed once the notifications are sent.
+func (c *NotifierConfig) Notifier() (Notifier, error) {
+	var tmpl *template.Template
+	if c.Template != "" {
+		var err error
+		tmpl, err = NewTemplate(c.Type, c.Template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.Type {
+	case "stdout":
+		return NewWriterNotifier(os.Stdout, tmpl), nil
+	case "file":
+		f, err := os.OpenFile(c.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &fileNotifier{WriterNotifier: NewWriterNotifier(f, tmpl), file: f}, nil
+	case "alertmanager":
+		return NewAlertmanagerNotifier(c.URL, c.GeneratorURL, time.Duration(c.ResendInterval), tmpl), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+}
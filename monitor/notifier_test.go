@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier keeps all the received notifications.
+type recordingNotifier struct {
+	notifications []*Notification
+	err           error
+}
+
+func (r *recordingNotifier) Notify(n *Notification) error {
+	r.notifications = append(r.notifications, n)
+	return r.err
+}
+
+func TestWriterNotifier(t *testing.T) {
+	var output bytes.Buffer
+	notifier := NewWriterNotifier(&output, nil)
+
+	err := notifier.Notify(&Notification{Alerts: []*AlertEvent{{Message: "first"}, {Message: "second"}}})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, "first\nsecond\n", output.String())
+}
+
+func TestWriterNotifierTemplate(t *testing.T) {
+	var output bytes.Buffer
+	tmpl, err := NewTemplate("test", `{{ range .Alerts }}[{{ .Status }}] {{ .Name }}{{ end }}`)
+	require.Nil(t, err, "Unexpected error raised")
+	notifier := NewWriterNotifier(&output, tmpl)
+
+	err = notifier.Notify(&Notification{Alerts: []*AlertEvent{{Name: "traffic", Status: Critical}}})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, "[critical] traffic", output.String())
+}
+
+func TestNotifiers(t *testing.T) {
+	first := &recordingNotifier{err: errors.New("failure")}
+	second := &recordingNotifier{}
+	n := &Notification{}
+
+	err := notifiers{first, second}.Notify(n)
+	require.NotNil(t, err, "The error of the first notifier should be returned")
+	require.Equal(t, []*Notification{n}, first.notifications)
+	require.Equal(t, []*Notification{n}, second.notifications, "The second notifier should be called even if the first one failed")
+}
+
+func TestNotifierConfigValidate(t *testing.T) {
+	require.Nil(t, (&NotifierConfig{Type: "stdout", Template: "{{ range .Alerts }}{{ .Name }}{{ end }}"}).Validate())
+	require.NotNil(t, (&NotifierConfig{Type: "file"}).Validate(), "A file notifier requires a path")
+	require.NotNil(t, (&NotifierConfig{Type: "email"}).Validate(), "Unknown types should be rejected")
+	require.NotNil(t, (&NotifierConfig{Type: "stdout", Template: "{{"}).Validate(), "Invalid templates should be rejected")
+}
+
+func TestFileNotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifier")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "alerts.log")
+	notifier, err := (&NotifierConfig{Type: "file", Path: path, Template: "{{ range .Alerts }}{{ .Name }}\n{{ end }}"}).Notifier()
+	require.Nil(t, err, "Unexpected error raised")
+	require.Nil(t, notifier.Notify(&Notification{Alerts: []*AlertEvent{{Name: "first"}}}))
+
+	require.Implements(t, (*io.Closer)(nil), notifier)
+	require.Nil(t, closeNotifiers([]Notifier{notifier, &recordingNotifier{}}))
+	require.NotNil(t, notifier.Notify(&Notification{Alerts: []*AlertEvent{{Name: "second"}}}), "The file should be closed")
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, "first\n", string(data))
+}
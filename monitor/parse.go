@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// parseChunkSize is the largest number of lines parsed by a worker at once. The lines are grouped to reduce the
+	// synchronization between the workers.
+	parseChunkSize = 256
+	// parseQueueFactor is how many chunks per worker can be parsed ahead of the oldest chunk not parsed yet.
+	parseQueueFactor = 4
+)
+
+// parseJob is a chunk of lines parsed by a worker. done is closed once the lines are parsed.
+type parseJob struct {
+	lines   []logLine
+	entries []*LoggingEntry
+	errs    []error
+	done    chan struct{}
+}
+
+func (job *parseJob) parse() {
+	job.entries = make([]*LoggingEntry, len(job.lines))
+	job.errs = make([]error, len(job.lines))
+	for i, line := range job.lines {
+		job.entries[i], job.errs[i] = parseLine(line)
+	}
+	close(job.done)
+}
+
+// nextChunk waits for a line, then takes the lines already available, up to parseChunkSize lines.
+func nextChunk(ctx context.Context, lines <-chan logLine) []logLine {
+	var chunk []logLine
+	select {
+	case line := <-lines:
+		chunk = append(chunk, line)
+	case <-ctx.Done():
+		return nil
+	}
+
+	for len(chunk) < parseChunkSize {
+		select {
+		case line := <-lines:
+			chunk = append(chunk, line)
+		default:
+			return chunk
+		}
+	}
+
+	return chunk
+}
+
+// parseLines parses the lines with the workers and queues the entries in the order of the lines, so the entries of
+// each source are appended in order. The method is blocking.
+func (m *Monitor) parseLines(ctx context.Context, lines <-chan logLine) error {
+	defer fmt.Println("Stop processing logs")
+
+	if m.workers <= 1 {
+		for {
+			select {
+			case line := <-lines:
+				m.processLine(ctx, line)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+
+	jobs := make(chan *parseJob, m.workers)
+	// The jobs in the order of the lines.
+	pending := make(chan *parseJob, m.workers*parseQueueFactor)
+	errg, ctx := errgroup.WithContext(ctx)
+
+	errg.Go(func() error {
+		defer close(jobs)
+		defer close(pending)
+
+		for {
+			chunk := nextChunk(ctx, lines)
+			if chunk == nil {
+				return nil
+			}
+
+			job := &parseJob{lines: chunk, done: make(chan struct{})}
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+				return nil
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+
+	for i := 0; i < m.workers; i++ {
+		errg.Go(func() error {
+			for job := range jobs {
+				job.parse()
+			}
+			return nil
+		})
+	}
+
+	errg.Go(func() error {
+		for job := range pending {
+			select {
+			case <-job.done:
+			case <-ctx.Done():
+				return nil
+			}
+
+			for i, line := range job.lines {
+				m.queueEntry(ctx, line, job.entries[i], job.errs[i])
+			}
+		}
+		return nil
+	})
+
+	return errg.Wait()
+}
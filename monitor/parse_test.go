@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// parseTestLines generates valid lines, with an invalid line every 10 lines.
+func parseTestLines(n int) []logLine {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lines := make([]logLine, n)
+	for i := range lines {
+		text := fmt.Sprintf(`127.0.0.1 - user%d [%s] "GET /report HTTP/1.0" 200 123`, i%100, start.Add(time.Duration(i/100)*time.Second).Format("02/Jan/2006:15:04:05 -0700"))
+		if i%10 == 9 {
+			text = "invalid"
+		}
+		lines[i] = logLine{source: fmt.Sprintf("access%d.log", i%3), text: text, position: Position{Offset: int64(i + 1)}}
+	}
+
+	return lines
+}
+
+func TestParseLinesOrder(t *testing.T) {
+	lines := parseTestLines(1000)
+
+	m, err := NewMonitor(nil, nil, WithParseWorkers(4), WithWriter(WriterConfig{QueueSize: len(lines)}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	input := make(chan logLine)
+	done := make(chan error)
+	go func() {
+		done <- m.parseLines(ctx, input)
+	}()
+
+	for _, line := range lines {
+		input <- line
+	}
+
+	// The entries are queued in the order of the lines, even when the workers finish in another order.
+	require.Eventually(t, func() bool { return len(m.writer.queue) == len(lines) }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.Nil(t, <-done)
+
+	for i, line := range lines {
+		item := <-m.writer.queue
+		require.Equal(t, line.source, item.source)
+		require.Equal(t, line.position, item.position)
+		if i%10 == 9 {
+			require.Nil(t, item.entry, "The invalid line %d shouldn't have an entry", i)
+		} else {
+			require.NotNil(t, item.entry, "The valid line %d should have an entry", i)
+			require.Equal(t, line.source, item.entry.Source)
+			require.Equal(t, fmt.Sprintf("user%d", i%100), item.entry.AuthUser)
+		}
+	}
+}
+
+// BenchmarkParseLines parses and commits lines, with one and several workers. The gain depends on the CPUs.
+func BenchmarkParseLines(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			lines := parseTestLines(b.N)
+			for i := range lines {
+				// Only valid lines.
+				if lines[i].text == "invalid" {
+					lines[i] = lines[i-1]
+				}
+			}
+
+			m, err := NewMonitor(nil, nil, WithParseWorkers(workers), WithWriter(WriterConfig{FlushInterval: time.Millisecond}))
+			require.Nil(b, err, "Unexpected error raised")
+			defer m.Stop()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			input := make(chan logLine)
+			errg := make(chan error, 2)
+			go func() {
+				errg <- m.parseLines(ctx, input)
+			}()
+			go func() {
+				errg <- m.writer.run(ctx)
+			}()
+
+			b.ResetTimer()
+			start := time.Now()
+			for _, line := range lines {
+				input <- line
+			}
+			for testutil.ToFloat64(m.writer.committed)+testutil.ToFloat64(m.writer.skipped) < float64(b.N) {
+				time.Sleep(time.Millisecond)
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "lines/s")
+
+			cancel()
+			require.Nil(b, <-errg)
+			require.Nil(b, <-errg)
+		})
+	}
+}
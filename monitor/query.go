@@ -0,0 +1,347 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/tsdb/labels"
+)
+
+// MatchType is the comparison of a matcher.
+type MatchType string
+
+const (
+	// MatchEqual selects the entries whose label is equal to the value.
+	MatchEqual MatchType = "="
+	// MatchNotEqual selects the entries whose label is different from the value.
+	MatchNotEqual MatchType = "!="
+	// MatchRegexp selects the entries whose label matches the regular expression, like the patterns.
+	MatchRegexp MatchType = "=~"
+	// MatchNotRegexp selects the entries whose label doesn't match the regular expression.
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher selects the entries by the value of a label. The labels which aren't stored are empty.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+}
+
+func (m Matcher) String() string {
+	return m.Name + string(m.Type) + strconv.Quote(m.Value)
+}
+
+// compile converts the matcher into a matcher of the timeseries database, also used by the memory storage.
+func (m Matcher) compile() (labels.Matcher, error) {
+	switch m.Type {
+	case MatchEqual:
+		return labels.NewEqualMatcher(m.Name, m.Value), nil
+	case MatchNotEqual:
+		return labels.Not(labels.NewEqualMatcher(m.Name, m.Value)), nil
+	case MatchRegexp, MatchNotRegexp:
+		matcher, err := labels.NewRegexpMatcher(m.Name, m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %s: %w", m, err)
+		}
+		if m.Type == MatchNotRegexp {
+			return labels.Not(matcher), nil
+		}
+		return matcher, nil
+	default:
+		return nil, fmt.Errorf("unknown match type %q", m.Type)
+	}
+}
+
+// compileMatchers selects the entries whose "label" matches the pattern, and which match all the other matchers.
+func compileMatchers(label string, pattern string, matchers []Matcher) ([]labels.Matcher, error) {
+	compiled := make([]labels.Matcher, 0, len(matchers)+1)
+	for _, m := range append([]Matcher{{Name: label, Type: MatchRegexp, Value: pattern}}, matchers...) {
+		c, err := m.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+
+	return compiled, nil
+}
+
+// matchesAll checks if the labels of a series match all the matchers.
+func matchesAll(matchers []labels.Matcher, seriesLabels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(seriesLabels[m.Name()]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseMatcher parses a matcher like `status=~"5.."` or `host!=127.0.0.1`. The value may be quoted, as a Go string.
+// The regular expressions are checked.
+func ParseMatcher(s string) (Matcher, error) {
+	matchers, err := ParseMatchers(s)
+	if err != nil {
+		return Matcher{}, err
+	}
+	if len(matchers) != 1 {
+		return Matcher{}, fmt.Errorf("expected one matcher in %q", s)
+	}
+
+	return matchers[0], nil
+}
+
+// ParseMatchers parses a list of matchers separated by commas, optionally in braces, e.g
+// `{status=~"5..", host="10.0.0.1"}`. The values containing commas or braces must be quoted.
+func ParseMatchers(s string) ([]Matcher, error) {
+	rest := strings.TrimSpace(s)
+	if strings.HasPrefix(rest, "{") {
+		if !strings.HasSuffix(rest, "}") {
+			return nil, fmt.Errorf("missing closing brace in %q", s)
+		}
+		rest = strings.TrimSpace(rest[1 : len(rest)-1])
+	}
+
+	var matchers []Matcher
+	for rest != "" {
+		var m Matcher
+		var err error
+		m, rest, err = cutMatcher(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matchers %q: %w", s, err)
+		}
+		if _, err := m.compile(); err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("invalid matchers %q: expected a comma before %q", s, rest)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+
+	return matchers, nil
+}
+
+// cutMatcher parses the matcher at the start of s and returns the rest of s.
+func cutMatcher(s string) (Matcher, string, error) {
+	end := 0
+	for end < len(s) && isLabelNameChar(s[end], end == 0) {
+		end++
+	}
+	if end == 0 {
+		return Matcher{}, "", fmt.Errorf("expected a label name at %q", s)
+	}
+	m := Matcher{Name: s[:end]}
+	s = strings.TrimLeft(s[end:], " ")
+
+	for _, t := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(s, string(t)) {
+			m.Type = t
+			break
+		}
+	}
+	if m.Type == "" {
+		return Matcher{}, "", fmt.Errorf("expected one of =, !=, =~ or !~ after the label %s", m.Name)
+	}
+	s = strings.TrimLeft(s[len(m.Type):], " ")
+
+	if strings.HasPrefix(s, `"`) {
+		quoted := quotedPrefix(s)
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return Matcher{}, "", fmt.Errorf("invalid quoted value at %s", s)
+		}
+		m.Value = value
+		return m, s[len(quoted):], nil
+	}
+
+	end = strings.IndexAny(s, ",}")
+	if end < 0 {
+		end = len(s)
+	}
+	m.Value = strings.TrimSpace(s[:end])
+
+	return m, s[end:], nil
+}
+
+// quotedPrefix returns the double-quoted string at the start of s, up to its closing quote which isn't escaped, or s
+// if it's not closed.
+func quotedPrefix(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1]
+		}
+	}
+
+	return s
+}
+
+// isLabelNameChar checks if a character can be part of a label name, like [a-zA-Z_][a-zA-Z0-9_]*.
+func isLabelNameChar(c byte, first bool) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (!first && isDigit(c))
+}
+
+// Query selects the entries matching all its matchers and adds up their hits, or their bytes, grouped by the values of
+// some labels.
+type Query struct {
+	Matchers []Matcher
+	// GroupBy are the labels whose values make the groups. All the hits are added up into one group without them.
+	GroupBy []string
+	// GroupBySeries makes a group of each series, with all its labels which aren't empty. GroupBy is ignored.
+	GroupBySeries bool
+	// Since and Until bound the dates of the entries, as Unix timestamps in seconds, both included.
+	Since int64
+	Until int64
+	// Limit keeps the groups with the most hits, all if it's not positive.
+	Limit int
+	// Bytes adds up the bytes of the entries instead of their hits.
+	Bytes bool
+}
+
+// compile converts the matchers of the query. The query selects all the entries without matchers.
+func (q *Query) compile() ([]labels.Matcher, error) {
+	if len(q.Matchers) == 0 {
+		return compileMatchers(HostLabel, AllEntriesPattern, nil)
+	}
+
+	compiled := make([]labels.Matcher, 0, len(q.Matchers))
+	for _, m := range q.Matchers {
+		c, err := m.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+
+	return compiled, nil
+}
+
+// Group is the number of hits of the entries which have the same values of the grouping labels.
+type Group struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+func (g Group) String() string {
+	names := make([]string, 0, len(g.Labels))
+	for name := range g.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(g.Labels[name])
+	}
+
+	return fmt.Sprintf("{%s} %g", strings.Join(pairs, ", "), g.Value)
+}
+
+// GroupList is the result of a query, sorted descending by number of hits.
+type GroupList []Group
+
+// Entries converts the groups of a single label into entries.
+func (g GroupList) Entries(label string) EntryList {
+	entries := make(EntryList, len(g))
+	for i, group := range g {
+		entries[i] = Entry{Key: group.Labels[label], Value: group.Value}
+	}
+
+	return entries
+}
+
+// groupAccumulator adds up the hits of the series by values of the grouping labels.
+type groupAccumulator struct {
+	groupBy []string
+	groups  map[string]*Group
+}
+
+func newGroupAccumulator(groupBy []string) *groupAccumulator {
+	return &groupAccumulator{groupBy: groupBy, groups: make(map[string]*Group)}
+}
+
+// add counts the hits of a series, whose labels are given by the "get" function.
+func (g *groupAccumulator) add(get func(name string) string, hits float64) {
+	values := make([]string, len(g.groupBy))
+	for i, name := range g.groupBy {
+		values[i] = get(name)
+	}
+
+	key := strings.Join(values, "\xff")
+	group, ok := g.groups[key]
+	if !ok {
+		group = &Group{Labels: make(map[string]string, len(g.groupBy))}
+		for i, name := range g.groupBy {
+			group.Labels[name] = values[i]
+		}
+		g.groups[key] = group
+	}
+	group.Value += hits
+}
+
+// addSeries counts the hits of a series, in the group of all its labels which aren't empty.
+func (g *groupAccumulator) addSeries(seriesLabels map[string]string, hits float64) {
+	names := make([]string, 0, len(seriesLabels))
+	for name, value := range seriesLabels {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name)
+		key.WriteByte('\xff')
+		key.WriteString(seriesLabels[name])
+		key.WriteByte('\xff')
+	}
+
+	group, ok := g.groups[key.String()]
+	if !ok {
+		group = &Group{Labels: make(map[string]string, len(names))}
+		for _, name := range names {
+			group.Labels[name] = seriesLabels[name]
+		}
+		g.groups[key.String()] = group
+	}
+	group.Value += hits
+}
+
+// list returns the "limit" groups with the most hits (all if limit is not positive). The groups with as many hits are
+// sorted by values of the grouping labels.
+func (g *groupAccumulator) list(limit int) GroupList {
+	keys := make([]string, 0, len(g.groups))
+	for key := range g.groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if vi, vj := g.groups[keys[i]].Value, g.groups[keys[j]].Value; vi != vj {
+			return vi > vj
+		}
+		return keys[i] < keys[j]
+	})
+
+	if limit > 0 && limit < len(keys) {
+		keys = keys[:limit]
+	}
+
+	list := make(GroupList, len(keys))
+	for i, key := range keys {
+		list[i] = *g.groups[key]
+	}
+
+	return list
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMatchers(t *testing.T) {
+	for s, expected := range map[string][]Matcher{
+		``:                  nil,
+		`{}`:                nil,
+		`status=200`:        {{StatusLabel, MatchEqual, "200"}},
+		`host != 127.0.0.1`: {{HostLabel, MatchNotEqual, "127.0.0.1"}},
+		`{status=~"5..", section!~"/(report|home)"}`: {
+			{StatusLabel, MatchRegexp, "5.."},
+			{RequestURLSectionLabel, MatchNotRegexp, "/(report|home)"},
+		},
+		`url=~"/a{1,3}",user="ja\"mes"`: {{RequestURLLabel, MatchRegexp, "/a{1,3}"}, {UserLabel, MatchEqual, `ja"mes`}},
+		`user=`:                         {{UserLabel, MatchEqual, ""}},
+	} {
+		matchers, err := ParseMatchers(s)
+		require.Nil(t, err, "Unexpected error raised for %q", s)
+		require.Equal(t, expected, matchers, "Unexpected matchers for %q", s)
+	}
+
+	for _, s := range []string{`status`, `status<200`, `5xx="a"`, `{status="200"`, `status="200" host="a"`, `url=~"("`, `user="james`} {
+		_, err := ParseMatchers(s)
+		require.NotNil(t, err, "An error should be raised for %q", s)
+	}
+
+	m, err := ParseMatcher(`status=~"5.."`)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, `status=~"5.."`, m.String())
+	_, err = ParseMatcher(`status=500,host=a`)
+	require.NotNil(t, err, "Only one matcher is expected")
+}
+
+func TestQuery(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	for name, storage := range map[string]Storage{"tsdb": db, "memory": NewMemoryStorage(time.Hour, LabelConfig{})} {
+		now := time.Now()
+		entry := func(host string, url string, status int) *LoggingEntry {
+			entry := testEntry("james", now)
+			entry.RemoteHost, entry.Request.URL, entry.Status = host, url, status
+			return entry
+		}
+		_, err := storage.AddEntries([]*LoggingEntry{
+			entry("10.0.0.1", "/report/user", 500),
+			entry("10.0.0.1", "/report/user", 500),
+			entry("10.0.0.1", "/home", 503),
+			entry("10.0.0.1", "/report", 200),
+			entry("10.0.0.2", "/report", 500),
+			entry("10.0.0.2", "/home", 404),
+		})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+
+		// The top sections for the status 5xx from a host.
+		groups, err := storage.Query(Query{
+			Matchers: []Matcher{{StatusLabel, MatchRegexp, "5.."}, {HostLabel, MatchEqual, "10.0.0.1"}},
+			GroupBy:  []string{RequestURLSectionLabel},
+			Since:    now.Unix(),
+			Until:    now.Unix(),
+		})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, GroupList{
+			{Labels: map[string]string{RequestURLSectionLabel: "/report"}, Value: 2},
+			{Labels: map[string]string{RequestURLSectionLabel: "/home"}, Value: 1},
+		}, groups, "Unexpected groups for %s", name)
+		require.Equal(t, EntryList{{Key: "/report", Value: 2}, {Key: "/home", Value: 1}}, groups.Entries(RequestURLSectionLabel))
+
+		groups, err = storage.Query(Query{
+			Matchers: []Matcher{{StatusLabel, MatchNotEqual, "200"}, {RequestURLSectionLabel, MatchNotRegexp, "/home"}},
+			GroupBy:  []string{HostLabel, StatusLabel},
+			Since:    now.Unix(),
+			Until:    now.Unix(),
+			Limit:    1,
+		})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, GroupList{{Labels: map[string]string{HostLabel: "10.0.0.1", StatusLabel: "500"}, Value: 2}}, groups, "Unexpected groups for %s", name)
+		require.Equal(t, `{host="10.0.0.1", status="500"} 2`, groups[0].String())
+
+		// All the entries are added up without matchers nor grouping labels.
+		groups, err = storage.Query(Query{Since: now.Unix(), Until: now.Unix()})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, GroupList{{Labels: map[string]string{}, Value: 6}}, groups, "Unexpected groups for %s", name)
+
+		entries, err := storage.TopEntriesBy(HostLabel, RequestURLSectionLabel, "/home", now.Unix(), now.Unix(), 0, Matcher{StatusLabel, MatchRegexp, "5.."})
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, EntryList{{Key: "10.0.0.1", Value: 1}}, entries, "Unexpected entries for %s", name)
+
+		_, err = storage.Query(Query{Matchers: []Matcher{{StatusLabel, "==", "200"}}})
+		require.NotNil(t, err, "The match type is unknown for %s", name)
+		_, err = storage.GetEntries(HostLabel, AllEntriesPattern, now.Unix(), now.Unix(), Matcher{StatusLabel, MatchRegexp, "("})
+		require.NotNil(t, err, "The regular expression is invalid for %s", name)
+	}
+}
+
+func TestAlertMatchers(t *testing.T) {
+	db := NewMemoryStorage(time.Hour, LabelConfig{})
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		entry := testEntry("james", now)
+		if i%2 == 0 {
+			entry.Status = 500
+		}
+		require.Nil(t, db.AddEntry(entry), "Unexpected error raised")
+	}
+
+	notifier := &recordingNotifier{}
+	alert := NewAlert("errors", time.Second, 5*time.Second, 1.0, RequestURLSectionLabel, "/report",
+		WithMatchers(Matcher{StatusLabel, MatchRegexp, "5.."}))
+	alert.notifier = notifier
+	require.Nil(t, alert.CheckStatusAt(db, now), "No error should be returned while checking the status.")
+	require.Equal(t, Critical, alert.Status())
+	require.Equal(t, 1.0, alert.State().Value, "Only the errors should be counted")
+	require.Equal(t, EntryList{{Key: "/report", Value: 5}}, notifier.notifications[0].Alerts[0].TopSections)
+}
@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// maxRangePoints limits the number of steps of a range query.
+const maxRangePoints = 11000
+
+// Point is the number of hits during a step, which starts at Timestamp.
+type Point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Series is the number of hits of a label value over time.
+type Series struct {
+	Key    string  `json:"key"`
+	Points []Point `json:"points"`
+}
+
+// SeriesList is the result of a range query, sorted by key.
+type SeriesList []Series
+
+// rangeSteps checks the time range of a range query and returns its number of steps. The steps start at "since", the
+// last one is cut at "until".
+func rangeSteps(since int64, until int64, step int64) (int, error) {
+	if step <= 0 {
+		return 0, errors.New("the step of a range query must be positive")
+	}
+	if until < since {
+		return 0, errors.New("the end of a range query is before its start")
+	}
+
+	steps := (until-since)/step + 1
+	if steps > maxRangePoints {
+		return 0, fmt.Errorf("range query with %d steps, more than the %d allowed: increase the step", steps, maxRangePoints)
+	}
+
+	return int(steps), nil
+}
+
+// rangeAccumulator adds up the hits of each label value by step.
+type rangeAccumulator struct {
+	since  int64
+	until  int64
+	step   int64
+	steps  int
+	series map[string][]float64
+}
+
+func newRangeAccumulator(since int64, until int64, step int64) (*rangeAccumulator, error) {
+	steps, err := rangeSteps(since, until, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rangeAccumulator{since: since, until: until, step: step, steps: steps, series: make(map[string][]float64)}, nil
+}
+
+// add counts the hits of a label value at a timestamp. The hits out of the range are ignored.
+func (r *rangeAccumulator) add(key string, timestamp int64, hits float64) {
+	if timestamp < r.since || timestamp > r.until {
+		return
+	}
+
+	values, ok := r.series[key]
+	if !ok {
+		values = make([]float64, r.steps)
+		r.series[key] = values
+	}
+	values[(timestamp-r.since)/r.step] += hits
+}
+
+// list returns the series, with a point for every step even without hits.
+func (r *rangeAccumulator) list() SeriesList {
+	list := make(SeriesList, 0, len(r.series))
+	for key, values := range r.series {
+		points := make([]Point, len(values))
+		for i, v := range values {
+			points[i] = Point{Timestamp: r.since + int64(i)*r.step, Value: v}
+		}
+		list = append(list, Series{Key: key, Points: points})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
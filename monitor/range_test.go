@@ -0,0 +1,162 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeSteps(t *testing.T) {
+	steps, err := rangeSteps(100, 100, 60)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 1, steps)
+
+	steps, err = rangeSteps(100, 220, 60)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 3, steps, "The last step is cut at the end of the range")
+
+	_, err = rangeSteps(100, 200, 0)
+	require.NotNil(t, err, "The step must be positive")
+	_, err = rangeSteps(200, 100, 1)
+	require.NotNil(t, err, "The range ends before its start")
+	_, err = rangeSteps(0, maxRangePoints, 1)
+	require.NotNil(t, err, "The range has too many steps")
+}
+
+func TestGetRange(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	for name, storage := range map[string]Storage{"tsdb": db, "memory": NewMemoryStorage(time.Hour, LabelConfig{})} {
+		start := time.Unix(time.Now().Unix()-60, 0)
+		entries := []*LoggingEntry{
+			testEntry("james", start),
+			testEntry("james", start.Add(time.Second)),
+			testEntry("jill", start.Add(5*time.Second)),
+			testEntry("james", start.Add(25*time.Second)),
+			testEntry("jill", start.Add(40*time.Second)),
+		}
+		_, err = storage.AddEntries(entries)
+		require.Nil(t, err, "Unexpected error raised")
+
+		series, err := storage.GetRange(UserLabel, AllEntriesPattern, start.Unix(), start.Unix()+29, 10)
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		base := start.Unix()
+		require.Equal(t, SeriesList{
+			{Key: "james", Points: []Point{{base, 2}, {base + 10, 0}, {base + 20, 1}}},
+			{Key: "jill", Points: []Point{{base, 1}, {base + 10, 0}, {base + 20, 0}}},
+		}, series, "Unexpected series for %s", name)
+
+		series, err = storage.GetRange(UserLabel, "jill", start.Unix()+30, start.Unix()+45, 10)
+		require.Nil(t, err, "Unexpected error raised for %s", name)
+		require.Equal(t, SeriesList{{Key: "jill", Points: []Point{{base + 30, 0}, {base + 40, 1}}}}, series, "Unexpected series for %s", name)
+
+		_, err = storage.GetRange(UserLabel, "(", start.Unix(), start.Unix(), 1)
+		require.NotNil(t, err, "The pattern is invalid for %s", name)
+		_, err = storage.GetRange(UserLabel, AllEntriesPattern, start.Unix(), start.Unix(), 0)
+		require.NotNil(t, err, "The step is invalid for %s", name)
+	}
+}
+
+func TestAlertAggregations(t *testing.T) {
+	db := NewMemoryStorage(time.Hour, LabelConfig{})
+	now := time.Unix(time.Now().Unix(), 0)
+
+	// A burst of 20 hits during one second, then 2 hits per second.
+	for i := 0; i < 20; i++ {
+		require.Nil(t, db.AddEntry(testEntry("james", now.Add(-5*time.Second))), "Unexpected error raised")
+	}
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 2; j++ {
+			require.Nil(t, db.AddEntry(testEntry("james", now.Add(-time.Duration(i)*time.Second))), "Unexpected error raised")
+		}
+	}
+
+	for _, test := range []struct {
+		aggregation string
+		step        time.Duration
+		threshold   float64
+		value       float64
+		status      Status
+	}{
+		{AggregationAverage, 0, 5, 30.0 / 10, OK},
+		{AggregationPeak, time.Second, 5, 20, Critical},
+		{AggregationPeak, 5 * time.Second, 5, 20.0 / 5, OK},
+		{AggregationSustained, time.Second, 2, 0, OK},
+		{AggregationSustained, 5 * time.Second, 2, 2, Critical},
+	} {
+		alert := NewAlert("test", time.Second, 10*time.Second, test.threshold, UserLabel, AllEntriesPattern, WithAggregation(test.aggregation, test.step))
+		alert.notifier = &recordingNotifier{}
+		require.Nil(t, alert.CheckStatusAt(db, now), "Unexpected error raised")
+		require.Equal(t, test.value, alert.State().Value, "Unexpected value for %s by %s", test.aggregation, test.step)
+		require.Equal(t, test.status, alert.Status(), "Unexpected status for %s by %s", test.aggregation, test.step)
+	}
+}
+
+func TestAPIQueryRange(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithDatabase(DatabaseConfig{Storage: StorageMemory}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	now := time.Unix(time.Now().Unix(), 0)
+	_, err = m.db.AddEntries([]*LoggingEntry{testEntry("james", now.Add(-time.Minute)), testEntry("jill", now)})
+	require.Nil(t, err, "Unexpected error raised")
+
+	query := func(params url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		NewAPI(m).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query_range?"+params.Encode(), nil))
+		return recorder
+	}
+
+	since := strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)
+	recorder := query(url.Values{"label": {UserLabel}, "pattern": {"j.*"}, "since": {since}, "until": {now.Format(time.RFC3339)}, "step": {"30s"}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result RangeResult
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	base := now.Add(-time.Minute).Unix()
+	require.Equal(t, RangeResult{
+		Label:   UserLabel,
+		Pattern: "j.*",
+		Since:   base,
+		Until:   now.Unix(),
+		Step:    30,
+		Series: SeriesList{
+			{Key: "james", Points: []Point{{base, 1}, {base + 30, 0}, {base + 60, 0}}},
+			{Key: "jill", Points: []Point{{base, 0}, {base + 30, 0}, {base + 60, 1}}},
+		},
+	}, result)
+
+	// The range is the last hour by default, by step of a minute.
+	recorder = query(url.Values{"label": {UserLabel}, "until": {strconv.FormatInt(now.Unix(), 10)}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	require.Equal(t, now.Add(-time.Hour).Unix(), result.Since)
+	require.Equal(t, int64(60), result.Step)
+	require.Len(t, result.Series, 2)
+	require.Len(t, result.Series[0].Points, 61)
+
+	// The entries can be filtered by other labels.
+	recorder = query(url.Values{"label": {UserLabel}, "match": {`{user!="james"}`}, "since": {since}, "step": {"60"}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	require.Equal(t, SeriesList{{Key: "jill", Points: []Point{{base, 0}, {base + 60, 1}}}}, result.Series)
+
+	for _, params := range []url.Values{
+		{},
+		{"label": {UserLabel}, "match": {"user"}},
+		{"label": {UserLabel}, "since": {"yesterday"}},
+		{"label": {UserLabel}, "step": {"500ms"}},
+		{"label": {UserLabel}, "step": {"1s"}, "since": {"0"}},
+		{"label": {UserLabel}, "pattern": {"("}},
+	} {
+		require.Equal(t, http.StatusBadRequest, query(params).Code, "The query %v is invalid", params)
+	}
+}
@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ReplayResult describes the lines ingested by a replay.
+type ReplayResult struct {
+	Lines   int
+	Invalid int
+	// Skipped is the number of valid entries rejected by the database (e.g out of order).
+	Skipped int
+	Since   time.Time
+	Until   time.Time
+}
+
+// replayClock evaluates the alerts at the moments given by the dates of the entries.
+type replayClock struct {
+	db     Storage
+	alerts []*Alert
+	// next is the next evaluation time of each alert.
+	next []time.Time
+}
+
+func newReplayClock(db Storage, alerts []*Alert, start time.Time) *replayClock {
+	c := &replayClock{db: db, alerts: alerts, next: make([]time.Time, len(alerts))}
+	for i, a := range alerts {
+		c.next[i] = start.Truncate(a.CheckingInterval()).Add(a.CheckingInterval())
+	}
+
+	return c
+}
+
+// due returns true if an alert is due before the second "until".
+func (c *replayClock) due(until int64) bool {
+	for _, next := range c.next {
+		if next.Unix() < until {
+			return true
+		}
+	}
+
+	return false
+}
+
+// advance evaluates, in chronological order, the alerts due before the second "until". The entries of the same
+// second as an evaluation time are waited for, since they are part of its data.
+func (c *replayClock) advance(until int64) error {
+	for {
+		due := -1
+		for i := range c.alerts {
+			if c.next[i].Unix() < until && (due < 0 || c.next[i].Before(c.next[due])) {
+				due = i
+			}
+		}
+		if due < 0 {
+			return nil
+		}
+
+		if err := c.alerts[due].CheckStatusAt(c.db, c.next[due]); err != nil {
+			return fmt.Errorf("failed to check alert %q at %s: %w", c.alerts[due].Name(), c.next[due], err)
+		}
+		c.next[due] = c.next[due].Add(c.alerts[due].CheckingInterval())
+	}
+}
+
+// replayRetention is longer than any replayed logs.
+const replayRetention = 100 * 365 * 24 * time.Hour
+
+// Replay ingests all the lines of the sources, one source after the other, into a fresh database. Instead of the
+// wall clock, the alerts are evaluated with a clock driven by the dates of the entries: each alert is checked at each
+// multiple of its checking interval, once the entries up to that moment were ingested. The notifications are sent
+// through the notifiers of the alerts. At the end, a summary of the whole traffic and the final status of the alerts
+// are written to w.
+func Replay(ctx context.Context, sources []LineSource, alerts []*Alert, w io.Writer) (*ReplayResult, error) {
+	// Count the distinct values of the summary and of the alerts.
+	distinctLabels := append([]string(nil), DefaultDistinctLabels...)
+	for _, a := range alerts {
+		if a.aggregation == AggregationDistinct {
+			distinctLabels = append(distinctLabels, a.label)
+		}
+	}
+
+	// Keep all the replayed entries, whatever their dates.
+	db, err := OpenLoggingDatabase(DatabaseConfig{Retention: replayRetention, Labels: LabelConfig{DistinctLabels: distinctLabels}})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Cleanup()
+
+	lines := make(chan logLine)
+	errg, ctx := errgroup.WithContext(ctx)
+	errg.Go(func() error {
+		defer close(lines)
+		for _, source := range sources {
+			if err := source.Lines(ctx, lines); err != nil || ctx.Err() != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	result := &ReplayResult{}
+	var clock *replayClock
+	errg.Go(func() error {
+		// The entries are stored by batches, the hits of a series during a second are added up. A batch is committed
+		// before the alerts are evaluated.
+		var batch []*LoggingEntry
+		store := func() error {
+			skipped, err := db.AddEntries(batch)
+			if err != nil {
+				return err
+			}
+			result.Skipped += skipped
+			batch = batch[:0]
+			return nil
+		}
+
+		for line := range lines {
+			result.Lines++
+
+			entry, err := parseLine(line)
+			if err != nil {
+				result.Invalid++
+				continue
+			}
+
+			if clock == nil {
+				clock = newReplayClock(db, alerts, entry.Date)
+				result.Since = entry.Date
+			}
+			if len(batch) >= DefaultBatchSize || clock.due(entry.Date.Unix()) {
+				if err := store(); err != nil {
+					return err
+				}
+			}
+			if err := clock.advance(entry.Date.Unix()); err != nil {
+				return err
+			}
+
+			batch = append(batch, entry)
+			if entry.Date.After(result.Until) {
+				result.Until = entry.Date
+			}
+		}
+		if err := store(); err != nil {
+			return err
+		}
+
+		if clock != nil {
+			// Evaluate the alerts up to the last entry, included.
+			return clock.advance(result.Until.Unix() + 1)
+		}
+		return nil
+	})
+
+	if err := errg.Wait(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(w, "Replayed %d lines (%d invalid, %d skipped)\n", result.Lines, result.Invalid, result.Skipped)
+	if clock == nil {
+		return result, nil
+	}
+
+	stats, err := NewStatsSummary(result.Since.Unix(), result.Until.Unix(), db)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(w, stats)
+
+	for _, a := range alerts {
+		fmt.Fprintf(w, "Alert %s: %s\n", a.Name(), a.Status())
+	}
+
+	return result, nil
+}
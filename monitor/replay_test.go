@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// replayLines generates "perSecond" distinct lines for each second of [start, start+seconds).
+func replayLines(start time.Time, seconds int, perSecond int) []string {
+	var lines []string
+	for s := 0; s < seconds; s++ {
+		date := start.Add(time.Duration(s) * time.Second).Format("02/Jan/2006:15:04:05 -0700")
+		for i := 0; i < perSecond; i++ {
+			lines = append(lines, fmt.Sprintf(`127.0.0.1 - user%d [%s] "GET /report HTTP/1.0" 200 123`, i, date))
+		}
+	}
+
+	return lines
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 16, 0, 0, 0, time.UTC)
+	lines := replayLines(start, 10, 4)
+	lines = append(lines, "invalid line")
+	lines = append(lines, replayLines(start.Add(time.Minute), 1, 1)...)
+
+	recorder := &recordingNotifier{}
+	alert := NewAlert("test", time.Second, 5*time.Second, 2.0, HostLabel, AllEntriesPattern)
+	alert.notifier = recorder
+
+	var output bytes.Buffer
+	source := NewReaderSource("replay", strings.NewReader(strings.Join(lines, "\n")))
+	result, err := Replay(context.Background(), []LineSource{source}, []*Alert{alert}, &output)
+	require.Nil(t, err, "Unexpected error raised")
+
+	require.Equal(t, 42, result.Lines)
+	require.Equal(t, 1, result.Invalid)
+	require.Equal(t, 0, result.Skipped)
+	require.True(t, start.Equal(result.Since))
+	require.True(t, start.Add(time.Minute).Equal(result.Until))
+
+	// The window includes both of its ends, so the alert fires with 3 seconds of data and resolves with 2 of them,
+	// according to the dates of the entries.
+	require.Len(t, recorder.notifications, 2)
+	firing := recorder.notifications[0].Alerts[0]
+	require.Equal(t, Critical, firing.Status)
+	require.True(t, start.Add(2*time.Second).Equal(firing.Time), "Unexpected firing time %s", firing.Time)
+	resolved := recorder.notifications[1].Alerts[0]
+	require.Equal(t, OK, resolved.Status)
+	require.True(t, start.Add(13*time.Second).Equal(resolved.Time), "Unexpected resolution time %s", resolved.Time)
+
+	require.Contains(t, output.String(), "Replayed 42 lines (1 invalid, 0 skipped)")
+	require.Contains(t, output.String(), "Alert test: ok")
+	require.Contains(t, output.String(), "- Distinct values (estimated): [{host 1} {user 4}]")
+}
+
+func TestReplayIdenticalLines(t *testing.T) {
+	// 50 identical lines during one second, more than a batch of identical lines during another one.
+	start := time.Date(2020, time.January, 1, 16, 0, 0, 0, time.UTC)
+	var lines []string
+	for i := 0; i < 50; i++ {
+		lines = append(lines, replayLines(start, 1, 1)...)
+	}
+	for i := 0; i < DefaultBatchSize+10; i++ {
+		lines = append(lines, replayLines(start.Add(time.Minute), 1, 1)...)
+	}
+
+	recorder := &recordingNotifier{}
+	alert := NewAlert("test", time.Second, 5*time.Second, 5.0, HostLabel, AllEntriesPattern)
+	alert.notifier = recorder
+
+	var output bytes.Buffer
+	source := NewReaderSource("replay", strings.NewReader(strings.Join(lines, "\n")))
+	result, err := Replay(context.Background(), []LineSource{source}, []*Alert{alert}, &output)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 0, result.Skipped)
+
+	// All the hits are counted, so the alert fires after both bursts, and resolves between them.
+	require.Contains(t, output.String(), fmt.Sprintf("Replayed %d lines (0 invalid, 0 skipped)", 60+DefaultBatchSize))
+	require.Contains(t, output.String(), fmt.Sprintf("From a total of %d requests", 60+DefaultBatchSize))
+	require.Len(t, recorder.notifications, 3)
+	require.Equal(t, Critical, recorder.notifications[0].Alerts[0].Status)
+	require.Equal(t, OK, recorder.notifications[1].Alerts[0].Status)
+	require.InDelta(t, 50.0/5, recorder.notifications[0].Alerts[0].Value, 0.01)
+	require.Equal(t, Critical, recorder.notifications[2].Alerts[0].Status)
+	require.InDelta(t, float64(DefaultBatchSize+10)/5, recorder.notifications[2].Alerts[0].Value, 0.01)
+}
+
+func TestReplayEmpty(t *testing.T) {
+	var output bytes.Buffer
+	source := NewReaderSource("replay", strings.NewReader(""))
+	result, err := Replay(context.Background(), []LineSource{source}, nil, &output)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, 0, result.Lines)
+	require.Equal(t, "Replayed 0 lines (0 invalid, 0 skipped)\n", output.String())
+}
@@ -0,0 +1,265 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/labels"
+	"github.com/prometheus/tsdb/wal"
+)
+
+// rollupResolutions are the durations of the buckets of the rollups in seconds, from the finest: each rollup is
+// summed from the previous one, the first one from the raw samples.
+var rollupResolutions = []int64{60, 3600}
+
+// rollupDelay is how long after the newest sample a bucket is rolled up, in seconds: the database doesn't accept the
+// samples older than half of the smallest block before its newest one, so the bucket can't change anymore.
+var rollupDelay = int64(minBlockRange / time.Second / 2)
+
+// rollupChunk is the longest time range rolled up at once, in seconds, so the samples of a chunk are recent enough to
+// be added to the rollup.
+const rollupChunk = 30 * 60
+
+// rollupInterval is how often the rollups are updated.
+var rollupInterval = time.Minute
+
+// rollup stores the hits and the bytes of each series by bucket, in a database where the samples are the hits or the
+// bytes of a bucket, timestamped with its start. The series are the same as the raw ones.
+type rollup struct {
+	resolution int64
+	db         *tsdb.DB
+
+	mu sync.Mutex
+	// next is the start of the first bucket which isn't rolled up yet.
+	next int64
+}
+
+// openRollups opens the rollups in the "rollups" directory of the database, or creates them.
+func openRollups(dir string, retention time.Duration) ([]*rollup, error) {
+	rollups := make([]*rollup, 0, len(rollupResolutions))
+	for _, resolution := range rollupResolutions {
+		options := tsdb.Options{
+			WALSegmentSize:    wal.DefaultSegmentSize,
+			RetentionDuration: uint64(retention / time.Second),
+			BlockRanges:       blockRanges(retention),
+		}
+		db, err := tsdb.Open(filepath.Join(dir, "rollups", fmt.Sprintf("%ds", resolution)), nil, nil, &options)
+		if err != nil {
+			closeRollups(rollups)
+			return nil, err
+		}
+
+		// Continue after the rolled up buckets.
+		next := int64(math.MinInt64)
+		if _, newest, ok := storedRange(db); ok {
+			next = newest - mod(newest, resolution) + resolution
+		}
+		rollups = append(rollups, &rollup{resolution: resolution, db: db, next: next})
+	}
+
+	return rollups, nil
+}
+
+// closeRollups closes the databases of the rollups.
+func closeRollups(rollups []*rollup) error {
+	var err error
+	for _, r := range rollups {
+		if closeErr := r.db.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// watermark returns the start of the first bucket which isn't rolled up yet.
+func (r *rollup) watermark() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.next
+}
+
+// rollUp adds up the hits and the bytes of the series of the source database by bucket, up to "end" excluded, starting after the
+// buckets already rolled up or with the oldest samples of the source.
+func (r *rollup) rollUp(source *tsdb.DB, end int64) error {
+	next := r.watermark()
+	if next == math.MinInt64 {
+		oldest, _, ok := storedRange(source)
+		if !ok {
+			return nil
+		}
+		next = oldest - mod(oldest, r.resolution)
+	}
+	end -= mod(end, r.resolution)
+
+	matchers, err := compileMatchers(HostLabel, AllEntriesPattern, nil)
+	if err != nil {
+		return err
+	}
+
+	chunk := int64(rollupChunk)
+	if chunk < r.resolution {
+		chunk = r.resolution
+	}
+	for since := next; since < end; since += chunk {
+		until := since + chunk
+		if until > end {
+			until = end
+		}
+		if err := r.rollUpChunk(source, since, until, matchers); err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		r.next = until
+		r.mu.Unlock()
+	}
+
+	return nil
+}
+
+// rollUpChunk adds up the hits and the bytes of the series of the source database by bucket, from "since" to "until" excluded.
+func (r *rollup) rollUpChunk(source *tsdb.DB, since int64, until int64, matchers []labels.Matcher) error {
+	query, err := source.Querier(since, until-1)
+	if err != nil {
+		return err
+	}
+	defer query.Close()
+
+	series, err := query.Select(matchers...)
+	if err != nil {
+		return err
+	}
+
+	appender := r.db.Appender()
+	for series.Next() {
+		s := series.At()
+		buckets := make(map[int64]float64)
+		var starts []int64
+
+		it := s.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			bucket := t - mod(t, r.resolution)
+			if _, ok := buckets[bucket]; !ok {
+				starts = append(starts, bucket)
+			}
+			buckets[bucket] += v
+		}
+		if err := it.Err(); err != nil {
+			appender.Rollback()
+			return err
+		}
+
+		// The samples are in order, so are the buckets.
+		for _, bucket := range starts {
+			_, err := appender.Add(s.Labels(), bucket, buckets[bucket])
+			switch err {
+			case nil:
+			case tsdb.ErrOutOfOrderSample, tsdb.ErrAmendSample, tsdb.ErrOutOfBounds:
+				// The bucket was already rolled up before a restart, or is older than the retention of the rollup.
+			default:
+				appender.Rollback()
+				return err
+			}
+		}
+	}
+	if err := series.Err(); err != nil {
+		appender.Rollback()
+		return err
+	}
+
+	return appender.Commit()
+}
+
+// rollUp updates the rollups with the buckets which can't change anymore: the buckets of the raw samples older than
+// rollupDelay before the newest one, then the buckets of the coarser rollups made of the rolled up buckets. The
+// compactions are paused meanwhile, since a bucket is rolled up only once.
+func (ld *LoggingDatabase) rollUp() error {
+	_, newest, ok := storedRange(ld.db)
+	if !ok {
+		return nil
+	}
+
+	defer ld.pauseCompactions()()
+
+	source, end := ld.db, newest-rollupDelay
+	for _, r := range ld.rollups {
+		if err := r.rollUp(source, end); err != nil {
+			return fmt.Errorf("failed to roll up the samples by %ds: %w", r.resolution, err)
+		}
+		source, end = r.db, r.watermark()
+	}
+
+	return nil
+}
+
+// Run updates the rollups every rollupInterval. The method is blocking.
+func (ld *LoggingDatabase) Run(ctx context.Context) error {
+	if len(ld.rollups) == 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ld.rollUp(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// segment is a part of a time range, read from the raw samples or from a rollup.
+type segment struct {
+	db    *tsdb.DB
+	since int64
+	until int64
+}
+
+// segments splits a time range, both ends included, between the rollups and the raw samples: the whole buckets of the
+// coarsest rollup, then the whole buckets of the finer ones in the rest of the range, then the raw samples. With a
+// positive step, only the rollups whose buckets fit in the steps from "since" are used.
+func (ld *LoggingDatabase) segments(since int64, until int64, step int64) []segment {
+	level := len(ld.rollups) - 1
+	for step > 0 && level >= 0 && (step%ld.rollups[level].resolution != 0 || mod(since, ld.rollups[level].resolution) != 0) {
+		level--
+	}
+
+	return ld.split(since, until, level)
+}
+
+// split splits a time range between the rollups up to "level" and the raw samples.
+func (ld *LoggingDatabase) split(since int64, until int64, level int) []segment {
+	if since > until {
+		return nil
+	}
+	if level < 0 {
+		return []segment{{db: ld.db, since: since, until: until}}
+	}
+
+	r := ld.rollups[level]
+	first := since + mod(-since, r.resolution)
+	end := until + 1 - mod(until+1, r.resolution)
+	if next := r.watermark(); end > next {
+		end = next
+	}
+	if first >= end {
+		return ld.split(since, until, level-1)
+	}
+
+	segments := ld.split(since, first-1, level-1)
+	segments = append(segments, segment{db: r.db, since: first, until: end - 1})
+	return append(segments, ld.split(end, until, level-1)...)
+}
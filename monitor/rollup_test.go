@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/tsdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegments(t *testing.T) {
+	minute, hour := &tsdb.DB{}, &tsdb.DB{}
+	ld := &LoggingDatabase{db: &tsdb.DB{}, rollups: []*rollup{
+		{resolution: 60, db: minute, next: 3*3600 + 600},
+		{resolution: 3600, db: hour, next: 3 * 3600},
+	}}
+
+	for _, test := range []struct {
+		since, until, step int64
+		expected           []segment
+	}{
+		{0, 0, 0, []segment{{ld.db, 0, 0}}},
+		{0, 59, 0, []segment{{minute, 0, 59}}},
+		{30, 200, 0, []segment{{ld.db, 30, 59}, {minute, 60, 179}, {ld.db, 180, 200}}},
+		{30, 7300, 0, []segment{{ld.db, 30, 59}, {minute, 60, 3599}, {hour, 3600, 7199}, {minute, 7200, 7259}, {ld.db, 7260, 7300}}},
+		{0, 4 * 3600, 0, []segment{{hour, 0, 3*3600 - 1}, {minute, 3 * 3600, 3*3600 + 599}, {ld.db, 3*3600 + 600, 4 * 3600}}},
+		{4 * 3600, 5 * 3600, 0, []segment{{ld.db, 4 * 3600, 5 * 3600}}},
+		// The buckets of the rollups must fit in the steps.
+		{0, 4 * 3600, 600, []segment{{minute, 0, 3*3600 + 599}, {ld.db, 3*3600 + 600, 4 * 3600}}},
+		{60, 7300, 60, []segment{{minute, 60, 7259}, {ld.db, 7260, 7300}}},
+		{30, 7300, 60, []segment{{ld.db, 30, 7300}}},
+		{0, 4 * 3600, 90, []segment{{ld.db, 0, 4 * 3600}}},
+		{0, 4 * 3600, 7200, []segment{{hour, 0, 3*3600 - 1}, {minute, 3 * 3600, 3*3600 + 599}, {ld.db, 3*3600 + 600, 4 * 3600}}},
+	} {
+		require.Equal(t, test.expected, ld.segments(test.since, test.until, test.step), "Unexpected segments between %d and %d by %d", test.since, test.until, test.step)
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollup")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	config := DatabaseConfig{Dir: dir, RollupRetention: 30 * 24 * time.Hour}
+	db, err := OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+	raw, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer raw.Cleanup()
+
+	// Entries every 7 seconds during 4 hours, from several hosts and statuses.
+	start := time.Unix(1539874800, 0)
+	var entries []*LoggingEntry
+	for i := 0; i < 4*3600/7; i++ {
+		entry := testEntry("james", start.Add(time.Duration(7*i)*time.Second))
+		entry.RemoteHost = "10.0.0." + strconv.Itoa(i%3)
+		entry.Status = 200 + 100*(i%4)
+		entry.Bytes = 100*(i%5) + 1
+		entries = append(entries, entry)
+	}
+	for _, storage := range []*LoggingDatabase{db, raw} {
+		_, err := storage.AddEntries(entries)
+		require.Nil(t, err, "Unexpected error raised")
+	}
+
+	require.Nil(t, db.rollUp(), "Unexpected error raised")
+	newest := entries[len(entries)-1].Date.Unix()
+	minuteNext := newest - rollupDelay - mod(newest-rollupDelay, 60)
+	require.Equal(t, minuteNext, db.rollups[0].watermark(), "The minutes up to the delay should be rolled up")
+	require.Equal(t, minuteNext-mod(minuteNext, 3600), db.rollups[1].watermark(), "The hours of the rolled up minutes should be rolled up")
+	require.Equal(t, start.Unix()+2*3600, db.rollups[1].watermark())
+
+	// The rollups give the same results as the raw samples.
+	compare := func() {
+		for _, window := range [][2]int64{{0, 4 * 3600}, {0, 59}, {30, 7300}, {3599, 7201}, {3 * 3600, 4 * 3600}, {100, 100}} {
+			since, until := start.Unix()+window[0], start.Unix()+window[1]
+
+			expected, err := raw.GetEntries(HostLabel, AllEntriesPattern, since, until)
+			require.Nil(t, err, "Unexpected error raised")
+			actual, err := db.GetEntries(HostLabel, AllEntriesPattern, since, until)
+			require.Nil(t, err, "Unexpected error raised")
+			require.ElementsMatch(t, expected, actual, "Unexpected entries between %d and %d", window[0], window[1])
+
+			query := Query{Matchers: []Matcher{{StatusLabel, MatchRegexp, "[45].."}}, GroupBy: []string{HostLabel, StatusLabel}, Since: since, Until: until}
+			groups, err := raw.Query(query)
+			require.Nil(t, err, "Unexpected error raised")
+			actualGroups, err := db.Query(query)
+			require.Nil(t, err, "Unexpected error raised")
+			require.Equal(t, groups, actualGroups, "Unexpected groups between %d and %d", window[0], window[1])
+
+			query.Bytes = true
+			groups, err = raw.Query(query)
+			require.Nil(t, err, "Unexpected error raised")
+			actualGroups, err = db.Query(query)
+			require.Nil(t, err, "Unexpected error raised")
+			require.Equal(t, groups, actualGroups, "Unexpected bytes between %d and %d", window[0], window[1])
+
+			for _, step := range []int64{60, 600, 3600, 7} {
+				series, err := raw.GetRange(StatusLabel, AllEntriesPattern, since, until, step)
+				require.Nil(t, err, "Unexpected error raised")
+				actualSeries, err := db.GetRange(StatusLabel, AllEntriesPattern, since, until, step)
+				require.Nil(t, err, "Unexpected error raised")
+				require.Equal(t, series, actualSeries, "Unexpected range between %d and %d by %d", window[0], window[1], step)
+			}
+		}
+	}
+	compare()
+
+	// The bytes are rolled up with the hits.
+	bytes := 0
+	for _, entry := range entries {
+		if entry.Date.Unix() < start.Unix()+2*3600 {
+			bytes += entry.Bytes
+		}
+	}
+	require.Equal(t, []segment{{db.rollups[1].db, start.Unix(), start.Unix() + 2*3600 - 1}}, db.segments(start.Unix(), start.Unix()+2*3600-1, 0))
+	groups, err := db.Query(Query{Since: start.Unix(), Until: start.Unix() + 2*3600 - 1, Bytes: true})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, GroupList{{Labels: map[string]string{}, Value: float64(bytes)}}, groups)
+
+	// The rollups continue after a restart, without adding the buckets twice.
+	require.Nil(t, db.Close(), "Unexpected error raised")
+	db, err = OpenLoggingDatabase(config)
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+	require.Equal(t, minuteNext, db.rollups[0].watermark(), "The rolled up minutes should be kept")
+
+	var later []*LoggingEntry
+	for i := 0; i < 3600/7; i++ {
+		later = append(later, testEntry("james", start.Add(4*time.Hour+time.Duration(7*i)*time.Second)))
+	}
+	for _, storage := range []*LoggingDatabase{db, raw} {
+		_, err := storage.AddEntries(later)
+		require.Nil(t, err, "Unexpected error raised")
+	}
+	require.Nil(t, db.rollUp(), "Unexpected error raised")
+	require.Equal(t, start.Unix()+3*3600, db.rollups[1].watermark())
+	compare()
+}
+
+func TestRollUpEmpty(t *testing.T) {
+	db, err := OpenLoggingDatabase(DatabaseConfig{RollupRetention: 24 * time.Hour})
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	require.Nil(t, db.rollUp(), "Unexpected error raised")
+	for _, r := range db.rollups {
+		require.Equal(t, int64(math.MinInt64), r.watermark(), "Nothing should be rolled up")
+	}
+
+	entries, err := db.GetEntries(HostLabel, AllEntriesPattern, 0, time.Now().Unix())
+	require.Nil(t, err, "Unexpected error raised")
+	require.Empty(t, entries)
+
+	_, err = OpenStorage(DatabaseConfig{Storage: StorageMemory, RollupRetention: 24 * time.Hour})
+	require.NotNil(t, err, "The memory storage has no rollups")
+}
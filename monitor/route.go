@@ -0,0 +1,146 @@
+package monitor
+
+import "strings"
+
+const (
+	// RouteIDPlaceholder replaces the numeric segments of the routes (e.g "/user/123").
+	RouteIDPlaceholder = ":id"
+	// RouteUUIDPlaceholder replaces the UUID segments of the routes.
+	RouteUUIDPlaceholder = ":uuid"
+	// RouteHashPlaceholder replaces the hexadecimal segments of at least 16 characters of the routes (e.g a SHA-1).
+	RouteHashPlaceholder = ":hash"
+	// minRouteHashLength is the length of the shortest hexadecimal segments replaced by RouteHashPlaceholder.
+	minRouteHashLength = 16
+)
+
+// Route is the path of the URL without its query string, where the identifiers are replaced by placeholders: for
+// example, the route of "/user/123/avatar?size=64" is "/user/:id/avatar".
+func (r *Request) Route() string {
+	return normalizeRoute(stripQueryString(r.URL))
+}
+
+// normalizeRoute replaces the segments of a path which look like identifiers by placeholders.
+func normalizeRoute(path string) string {
+	segments := strings.Split(path, "/")
+	changed := false
+	for i, segment := range segments {
+		if placeholder := routePlaceholder(segment); placeholder != "" {
+			segments[i] = placeholder
+			changed = true
+		}
+	}
+
+	if !changed {
+		return path
+	}
+	return strings.Join(segments, "/")
+}
+
+// routePlaceholder returns the placeholder replacing a segment of a path, or an empty string if the segment is kept.
+func routePlaceholder(segment string) string {
+	switch {
+	case segment == "":
+		return ""
+	case isDigits(segment):
+		return RouteIDPlaceholder
+	case isUUID(segment):
+		return RouteUUIDPlaceholder
+	case len(segment) >= minRouteHashLength && isHex(segment):
+		return RouteHashPlaceholder
+	default:
+		return ""
+	}
+}
+
+// isUUID checks if a string is a UUID, e.g "123e4567-e89b-12d3-a456-426614174000".
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// routePattern is a route given by the user, e.g "/api/:version/users/:name" or "/static/*". The segments starting
+// with ':' match any segment, a final '*' matches the rest of the path.
+type routePattern struct {
+	route    string
+	segments []string
+}
+
+// router finds the first route pattern matching a path.
+type router []routePattern
+
+func newRouter(patterns []string) router {
+	r := make(router, 0, len(patterns))
+	for _, pattern := range patterns {
+		r = append(r, routePattern{route: pattern, segments: strings.Split(pattern, "/")})
+	}
+
+	return r
+}
+
+// route returns the first route pattern matching a path without query string.
+func (r router) route(path string) (string, bool) {
+	if len(r) == 0 {
+		return "", false
+	}
+
+	segments := strings.Split(path, "/")
+	for _, pattern := range r {
+		if pattern.matches(segments) {
+			return pattern.route, true
+		}
+	}
+
+	return "", false
+}
+
+func (p routePattern) matches(segments []string) bool {
+	for i, expected := range p.segments {
+		if expected == "*" && i == len(p.segments)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+
+		switch {
+		case strings.HasPrefix(expected, ":"):
+			if segments[i] == "" {
+				return false
+			}
+		case expected != segments[i]:
+			return false
+		}
+	}
+
+	return len(segments) == len(p.segments)
+}
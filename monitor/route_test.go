@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRoute(t *testing.T) {
+	for url, route := range map[string]string{
+		"/":                        "/",
+		"/report/user":             "/report/user",
+		"/user/123":                "/user/:id",
+		"/user/123/avatar?size=64": "/user/:id/avatar",
+		"/orders/42/items/7/":      "/orders/:id/items/:id/",
+		"/doc/123e4567-e89b-12d3-a456-426614174000":       "/doc/:uuid",
+		"/static/d41d8cd98f00b204e9800998ecf8427e/app.js": "/static/:hash/app.js",
+		"/deadbeef/v2": "/deadbeef/v2",
+		"/page/2.html": "/page/2.html",
+		"":             "",
+	} {
+		request := &Request{URL: url}
+		require.Equal(t, route, request.Route(), "Unexpected route for %q", url)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := newRouter([]string{"/api/:version/users/:name", "/static/*", "/health"})
+
+	for path, expected := range map[string]string{
+		"/api/v1/users/james":        "/api/:version/users/:name",
+		"/static/css/app.css":        "/static/*",
+		"/static/":                   "/static/*",
+		"/health":                    "/health",
+		"/api/v1/users/":             "",
+		"/api/v1/users/james/avatar": "",
+		"/healthz":                   "",
+	} {
+		route, ok := r.route(path)
+		require.Equal(t, expected != "", ok, "Unexpected match for %q", path)
+		require.Equal(t, expected, route, "Unexpected route for %q", path)
+	}
+}
+
+func TestLabelerRoutes(t *testing.T) {
+	l := newLabeler(LabelConfig{Routes: []string{"/api/:version/users/:name"}}, DefaultRetention)
+
+	entry := testEntry("james", time.Now())
+	entry.Request.URL = "/api/v1/users/james?full=1"
+	require.Equal(t, "/api/:version/users/:name", l.labels(entry)[RouteLabel])
+	entry.Request.URL = "/user/123"
+	require.Equal(t, "/user/:id", l.labels(entry)[RouteLabel])
+}
+
+func TestAlertOnRoute(t *testing.T) {
+	db := NewMemoryStorage(time.Minute, LabelConfig{})
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		entry := testEntry("james", now)
+		entry.Request.URL = "/user/" + string(rune('0'+i))
+		require.Nil(t, db.AddEntry(entry), "Unexpected error raised")
+	}
+
+	alert := NewAlert("users", time.Second, 5*time.Second, 1.0, RouteLabel, "/user/:id")
+	require.Nil(t, alert.CheckStatusAt(db, now), "No error should be returned while checking the status.")
+	require.Equal(t, Critical, alert.Status(), "The alert should fire for the route")
+}
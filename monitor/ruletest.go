@@ -0,0 +1,247 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ruleTestStart is the moment considered as time zero by the rule tests.
+var ruleTestStart = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// RuleTestFile describes unit tests for the alert rules from one or more configuration files.
+type RuleTestFile struct {
+	RuleFiles []string   `json:"rule_files"`
+	Tests     []RuleTest `json:"tests"`
+}
+
+// RuleTest feeds synthetic log lines into a fresh database and checks the alerts' statuses at given times.
+type RuleTest struct {
+	Name           string          `json:"name"`
+	InputLines     []RuleTestInput `json:"input_lines"`
+	AlertRuleTests []AlertRuleTest `json:"alert_rule_test"`
+}
+
+// RuleTestInput is a log line inserted "repeat" times, every "every", starting at "at" relatively to the test start.
+// The date from the line is replaced with the computed timestamp.
+type RuleTestInput struct {
+	At     Duration `json:"at"`
+	Line   string   `json:"line"`
+	Repeat int      `json:"repeat"`
+	Every  Duration `json:"every"`
+}
+
+// AlertRuleTest is the expected status of an alert at a given evaluation time.
+type AlertRuleTest struct {
+	EvalTime  Duration `json:"eval_time"`
+	AlertName string   `json:"alertname"`
+	ExpStatus string   `json:"exp_status"`
+}
+
+// LoadRuleTestFile reads a rule test file. The rule files are resolved relatively to the test file.
+func LoadRuleTestFile(path string) (*RuleTestFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var testFile RuleTestFile
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&testFile); err != nil {
+		return nil, fmt.Errorf("failed to parse rule test file %s: %w", path, err)
+	}
+
+	for i, ruleFile := range testFile.RuleFiles {
+		if !filepath.IsAbs(ruleFile) {
+			testFile.RuleFiles[i] = filepath.Join(filepath.Dir(path), ruleFile)
+		}
+	}
+
+	return &testFile, nil
+}
+
+// RunRuleTests runs all the tests from a rule test file and writes a report to w.
+// It returns false if at least one of the tests failed.
+func RunRuleTests(path string, w io.Writer) (bool, error) {
+	testFile, err := LoadRuleTestFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var rules []AlertRule
+	for _, ruleFile := range testFile.RuleFiles {
+		config, err := LoadConfig(ruleFile)
+		if err != nil {
+			return false, err
+		}
+		rules = append(rules, config.Rules...)
+	}
+
+	fmt.Fprintf(w, "Unit testing: %s\n", path)
+
+	passed := true
+	for i := range testFile.Tests {
+		test := &testFile.Tests[i]
+
+		failures, err := test.Run(rules)
+		if err != nil {
+			return false, fmt.Errorf("test %q: %w", test.Name, err)
+		}
+
+		if len(failures) == 0 {
+			fmt.Fprintf(w, "  SUCCESS %s\n", test.Name)
+			continue
+		}
+
+		passed = false
+		fmt.Fprintf(w, "  FAILED %s:\n", test.Name)
+		for _, failure := range failures {
+			fmt.Fprintf(w, "    %s\n", failure)
+		}
+	}
+
+	return passed, nil
+}
+
+// Run executes the test against the given rules and returns a description of each mismatch.
+// Every alert is evaluated at each multiple of its checking interval and at each evaluation time of the test,
+// using a fake clock that starts at time zero.
+func (t *RuleTest) Run(rules []AlertRule) ([]string, error) {
+	entries, err := t.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := NewLoggingDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Cleanup()
+
+	for _, entry := range entries {
+		if err := db.AddEntry(entry); err != nil {
+			return nil, fmt.Errorf("failed to add entry %s: %w", entry, err)
+		}
+	}
+
+	alerts := make([]*Alert, 0, len(rules))
+	alertsByName := make(map[string]*Alert)
+	for i := range rules {
+		alert, err := rules[i].Alert()
+		if err != nil {
+			return nil, err
+		}
+		alert.notifier = discardNotifier{}
+		alerts = append(alerts, alert)
+		alertsByName[alert.Name()] = alert
+	}
+
+	// Group the expectations by their evaluation time.
+	expectations := make(map[time.Duration][]AlertRuleTest)
+	var last time.Duration
+	for _, exp := range t.AlertRuleTests {
+		if _, ok := alertsByName[exp.AlertName]; !ok {
+			return nil, fmt.Errorf("unknown alert %q", exp.AlertName)
+		}
+		if _, err := ParseStatus(exp.ExpStatus); err != nil {
+			return nil, err
+		}
+
+		evalTime := time.Duration(exp.EvalTime)
+		expectations[evalTime] = append(expectations[evalTime], exp)
+		if evalTime > last {
+			last = evalTime
+		}
+	}
+
+	var failures []string
+	for _, evalTime := range evaluationTimes(alerts, expectations, last) {
+		now := ruleTestStart.Add(evalTime)
+
+		expected := make(map[string]bool)
+		for _, exp := range expectations[evalTime] {
+			expected[exp.AlertName] = true
+		}
+
+		for _, alert := range alerts {
+			if evalTime%alert.CheckingInterval() != 0 && !expected[alert.Name()] {
+				continue
+			}
+
+			if err := alert.CheckStatusAt(db, now); err != nil {
+				return nil, fmt.Errorf("failed to check alert %q at %s: %w", alert.Name(), evalTime, err)
+			}
+		}
+
+		for _, exp := range expectations[evalTime] {
+			got := alertsByName[exp.AlertName].Status()
+			if got.String() != exp.ExpStatus {
+				failures = append(failures, fmt.Sprintf("alert %q at %s: expected status %s, got %s",
+					exp.AlertName, evalTime, exp.ExpStatus, got))
+			}
+		}
+	}
+
+	return failures, nil
+}
+
+// entries parses the input lines and returns the generated entries sorted by date.
+func (t *RuleTest) entries() ([]*LoggingEntry, error) {
+	var entries []*LoggingEntry
+	for _, input := range t.InputLines {
+		entry, err := NewLoggingEntry(input.Line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input line %q: %w", input.Line, err)
+		}
+
+		repeat := input.Repeat
+		if repeat <= 0 {
+			repeat = 1
+		}
+		every := time.Duration(input.Every)
+		if every <= 0 {
+			every = time.Second
+		}
+
+		for i := 0; i < repeat; i++ {
+			e := *entry
+			e.Date = ruleTestStart.Add(time.Duration(input.At) + time.Duration(i)*every)
+			entries = append(entries, &e)
+		}
+	}
+
+	// The database doesn't accept out of order samples.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	return entries, nil
+}
+
+// evaluationTimes returns the sorted moments, up to "last", when at least one alert has to be evaluated.
+func evaluationTimes(alerts []*Alert, expectations map[time.Duration][]AlertRuleTest, last time.Duration) []time.Duration {
+	set := make(map[time.Duration]bool)
+	for evalTime := range expectations {
+		set[evalTime] = true
+	}
+
+	for _, alert := range alerts {
+		for t := alert.CheckingInterval(); t <= last; t += alert.CheckingInterval() {
+			set[t] = true
+		}
+	}
+
+	times := make([]time.Duration, 0, len(set))
+	for t := range set {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return times
+}
@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRuleTests(t *testing.T) {
+	var output bytes.Buffer
+
+	passed, err := RunRuleTests("testdata/rules_test.json", &output)
+	require.Nil(t, err, "Unexpected error raised")
+	require.True(t, passed, "All tests should pass:\n%s", output.String())
+}
+
+func TestRuleTestMismatch(t *testing.T) {
+	rules := []AlertRule{
+		{Name: "test", CheckingInterval: Duration(time.Second), DataInterval: Duration(10 * time.Second), Threshold: 1, Label: HostLabel},
+	}
+	test := &RuleTest{
+		Name: "mismatch",
+		InputLines: []RuleTestInput{
+			{Line: "127.0.0.1 - james [09/May/2018:16:00:39 +0000] \"GET /report HTTP/1.0\" 200 123", Repeat: 20},
+		},
+		AlertRuleTests: []AlertRuleTest{
+			{EvalTime: Duration(15 * time.Second), AlertName: "test", ExpStatus: "ok"},
+		},
+	}
+
+	failures, err := test.Run(rules)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, []string{`alert "test" at 15s: expected status ok, got critical`}, failures)
+}
+
+func TestRuleTestUnknownAlert(t *testing.T) {
+	test := &RuleTest{
+		Name:           "unknown",
+		AlertRuleTests: []AlertRuleTest{{EvalTime: Duration(time.Second), AlertName: "missing", ExpStatus: "ok"}},
+	}
+
+	_, err := test.Run(nil)
+	require.NotNil(t, err, "An error should be raised for unknown alerts")
+}
+
+func TestRuleTestInvalidLine(t *testing.T) {
+	test := &RuleTest{
+		Name:       "invalid",
+		InputLines: []RuleTestInput{{Line: "invalid"}},
+	}
+
+	_, err := test.Run(nil)
+	require.NotNil(t, err, "An error should be raised for invalid lines")
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+const (
+	// StdinPath is the file name used to read the lines from the standard input.
+	StdinPath = "-"
+	// StdinSource is the source label of the lines read from the standard input.
+	StdinSource = "stdin"
+)
+
+// LineSource produces the raw lines processed by a monitor (e.g followed files, the standard input).
+type LineSource interface {
+	// Lines sends the lines until the source is exhausted or until the context is done. The method is blocking.
+	Lines(ctx context.Context, lines chan<- logLine) error
+}
+
+// followSource follows files like "tail -F".
+type followSource struct {
+	patterns   []string
+	checkpoint *Checkpoint
+	backfill   int
+}
+
+// NewFollowSource follows the files matching the patterns, see followFiles. The checkpoint may be nil.
+func NewFollowSource(patterns []string, checkpoint *Checkpoint, backfill int) LineSource {
+	return &followSource{patterns: patterns, checkpoint: checkpoint, backfill: backfill}
+}
+
+func (s *followSource) Lines(ctx context.Context, lines chan<- logLine) error {
+	return followFiles(ctx, s.patterns, s.checkpoint, s.backfill, lines)
+}
+
+// fileSource reads files once, until their end.
+type fileSource struct {
+	paths []string
+}
+
+// NewFileSource reads the files one after the other, until their end. The gzip and zstd files are decompressed.
+// StdinPath reads the standard input instead.
+func NewFileSource(paths ...string) LineSource {
+	return &fileSource{paths: paths}
+}
+
+func (s *fileSource) Lines(ctx context.Context, lines chan<- logLine) error {
+	for _, path := range s.paths {
+		var err error
+		if path == StdinPath {
+			err = NewReaderSource(StdinSource, os.Stdin).Lines(ctx, lines)
+		} else {
+			err = readLogFile(ctx, path, path, lines)
+		}
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readerSource reads a stream (e.g the standard input) until its end.
+type readerSource struct {
+	name   string
+	reader io.Reader
+}
+
+// NewReaderSource reads the lines of a stream until its end. The lines are labeled with the given name.
+func NewReaderSource(name string, r io.Reader) LineSource {
+	return &readerSource{name: name, reader: r}
+}
+
+func (s *readerSource) Lines(ctx context.Context, lines chan<- logLine) error {
+	// A blocked read can't be interrupted, so the stream is read in background and abandoned when the context is done.
+	done := make(chan error, 1)
+	go func() {
+		done <- readLogLines(ctx, s.reader, s.name, lines)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// isNamedPipe reports whether the path is a named pipe (FIFO).
+func isNamedPipe(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// readPipe reads the lines written into a named pipe until the context is done. The pipe is opened for writing too,
+// so it doesn't reach its end when the writers come and go.
+func readPipe(ctx context.Context, path string, lines chan<- logLine) error {
+	pipe, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Interrupt the pending read.
+			pipe.Close()
+		case <-done:
+			pipe.Close()
+		}
+	}()
+
+	err = readLogLines(ctx, pipe, path, lines)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderSource(t *testing.T) {
+	lines := make(chan logLine, 2)
+	err := NewReaderSource(StdinSource, strings.NewReader("first\nsecond")).Lines(context.Background(), lines)
+	require.Nil(t, err, "Unexpected error raised")
+
+	received := receiveLines(t, lines, 2)
+	require.Equal(t, []string{"first", "second"}, texts(received))
+	require.Equal(t, StdinSource, received[0].source)
+}
+
+func TestReaderSourceCancel(t *testing.T) {
+	// The reader never returns, but the source stops with the context.
+	r, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- NewReaderSource(StdinSource, r).Lines(ctx, make(chan logLine))
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		require.Nil(t, err, "Unexpected error raised")
+	case <-time.After(5 * time.Second):
+		t.Fatal("The source wasn't stopped")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "access.log.1.gz")
+	writeGzipFile(t, first, "first\n")
+	second := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(second, []byte("second\n"), 0644))
+
+	lines := make(chan logLine, 2)
+	err = NewFileSource(first, second).Lines(context.Background(), lines)
+	require.Nil(t, err, "Unexpected error raised")
+
+	received := receiveLines(t, lines, 2)
+	require.Equal(t, []string{"first", "second"}, texts(received))
+	require.Equal(t, first, received[0].source)
+	require.Equal(t, second, received[1].source)
+}
+
+func TestMonitorSources(t *testing.T) {
+	m, err := NewMonitor([]string{StdinPath, "/tmp/a.log", "/tmp/*.access.log"}, nil)
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	require.Len(t, m.sources, 2)
+	require.Equal(t, NewReaderSource(StdinSource, os.Stdin), m.sources[0])
+	require.Equal(t, NewFollowSource([]string{"/tmp/a.log", "/tmp/*.access.log"}, nil, 0), m.sources[1])
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package monitor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowNamedPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.Nil(t, err, "Unexpected error raised")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.pipe")
+	if err := syscall.Mkfifo(path, 0644); err != nil {
+		t.Skipf("Named pipes aren't supported: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan logLine)
+	done := make(chan error)
+	go func() {
+		done <- NewFollowSource([]string{path}, nil, 0).Lines(ctx, lines)
+	}()
+
+	// The pipe stays readable when a writer goes away and another one comes.
+	for _, text := range []string{"first", "second"} {
+		writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+		require.Nil(t, err, "Unexpected error raised")
+		_, err = writer.WriteString(text + "\n")
+		require.Nil(t, err, "Unexpected error raised")
+		require.Nil(t, writer.Close())
+
+		received := receiveLines(t, lines, 1)
+		require.Equal(t, []string{text}, texts(received))
+		require.Equal(t, path, received[0].source)
+		require.Equal(t, Position{}, received[0].position)
+	}
+
+	cancel()
+	require.Nil(t, <-done)
+}
@@ -2,12 +2,17 @@ package monitor
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
 const (
 	limit = 3
+	// errorStatusPattern matches the client and server error statuses.
+	errorStatusPattern = "^[45]"
 )
 
 // StatsSummary is used to represent traffic statistics from a given interval.
@@ -16,40 +21,90 @@ type StatsSummary struct {
 	Until           int64
 	Size            int64
 	TopSections     EntryList
+	TopRoutes       EntryList
 	TopUsers        EntryList
 	RequestMethods  EntryList
 	RequestStatuses EntryList
+	Sources         EntryList
+	// TopErrors are the sections and the statuses with the most errors.
+	TopErrors GroupList
+	// Distinct are the estimated numbers of distinct clients and users, if they are counted and the entries aren't
+	// filtered by matchers.
+	Distinct EntryList
+	// Matchers select the summarized entries, all the entries without them.
+	Matchers []Matcher
 }
 
-// NewStatsSummary is used to generate traffic statistics from a given interval.
-func NewStatsSummary(since int64, until int64, db *LoggingDatabase) (*StatsSummary, error) {
-	topSections, err := db.TopEntries(RequestURLSectionLabel, AllEntriesPattern, since, until, limit)
+// NewStatsSummary is used to generate traffic statistics from a given interval, for the entries matching all the
+// matchers.
+func NewStatsSummary(since int64, until int64, db Storage, matchers ...Matcher) (*StatsSummary, error) {
+	topSections, err := db.TopEntries(RequestURLSectionLabel, AllEntriesPattern, since, until, limit, matchers...)
 	if err != nil {
 		return nil, err
 	}
 
-	topUsers, err := db.TopEntries(UserLabel, AllEntriesPattern, since, until, limit)
+	topRoutes, err := db.TopEntries(RouteLabel, AllEntriesPattern, since, until, limit, matchers...)
 	if err != nil {
 		return nil, err
 	}
 
-	requestMethods, err := db.TopEntries(RequestMethodLabel, AllEntriesPattern, since, until, 0)
+	topUsers, err := db.TopEntries(UserLabel, AllEntriesPattern, since, until, limit, matchers...)
 	if err != nil {
 		return nil, err
 	}
 
-	requestStatuses, err := db.TopEntries(StatusLabel, AllEntriesPattern, since, until, 0)
+	topErrors, err := db.Query(Query{
+		Matchers: append([]Matcher{{Name: StatusLabel, Type: MatchRegexp, Value: errorStatusPattern}}, matchers...),
+		GroupBy:  []string{RequestURLSectionLabel, StatusLabel},
+		Since:    since,
+		Until:    until,
+		Limit:    limit,
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	requestMethods, err := db.TopEntries(RequestMethodLabel, AllEntriesPattern, since, until, 0, matchers...)
+	if err != nil {
+		return nil, err
+	}
+
+	requestStatuses, err := db.TopEntries(StatusLabel, AllEntriesPattern, since, until, 0, matchers...)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := db.TopEntries(SourceLabel, AllEntriesPattern, since, until, 0, matchers...)
+	if err != nil {
+		return nil, err
+	}
+
+	var distinct EntryList
+	if len(matchers) == 0 {
+		for _, label := range DefaultDistinctLabels {
+			count, err := db.CountDistinct(label, since, until)
+			if errors.Is(err, ErrDistinctNotCounted) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			distinct = append(distinct, Entry{Key: label, Value: math.Round(count)})
+		}
+	}
+
 	return &StatsSummary{
 		Since:           since,
 		Until:           until,
+		Matchers:        matchers,
 		TopSections:     topSections,
+		TopRoutes:       topRoutes,
 		TopUsers:        topUsers,
+		TopErrors:       topErrors,
+		Distinct:        distinct,
 		RequestMethods:  requestMethods,
-		RequestStatuses: requestStatuses}, nil
+		RequestStatuses: requestStatuses,
+		Sources:         sources}, nil
 }
 
 func (s *StatsSummary) String() string {
@@ -70,12 +125,30 @@ func (s *StatsSummary) String() string {
 	}
 
 	stats.WriteString("------------------------------------------------------------------------------------------------------------------------\n")
-	stats.WriteString(fmt.Sprintf("Traffic stats between [%s, %s]:\n", time.Unix(s.Since, 0), time.Unix(s.Until, 0)))
+	stats.WriteString(fmt.Sprintf("Traffic stats between [%s, %s]", time.Unix(s.Since, 0), time.Unix(s.Until, 0)))
+	if len(s.Matchers) > 0 {
+		filters := make([]string, len(s.Matchers))
+		for i, m := range s.Matchers {
+			filters[i] = m.String()
+		}
+		stats.WriteString(fmt.Sprintf(" for {%s}", strings.Join(filters, ", ")))
+	}
+	stats.WriteString(":\n")
 	stats.WriteString(fmt.Sprintf("- From a total of %d requests, there were %d successful calls, %d redirections, %d client errors and %d server errors\n",
 		total, successful, redirections, clientErrors, serverErrors))
 	stats.WriteString(fmt.Sprintf("- Requests by method: %v\n", s.RequestMethods))
 	stats.WriteString(fmt.Sprintf("- Top %d sections: %v\n", limit, s.TopSections))
+	stats.WriteString(fmt.Sprintf("- Top %d routes: %v\n", limit, s.TopRoutes))
 	stats.WriteString(fmt.Sprintf("- First %d users: %v\n", limit, s.TopUsers))
+	if len(s.TopErrors) > 0 {
+		stats.WriteString(fmt.Sprintf("- Top %d errors by section and status: %v\n", limit, s.TopErrors))
+	}
+	if len(s.Distinct) > 0 {
+		stats.WriteString(fmt.Sprintf("- Distinct values (estimated): %v\n", s.Distinct))
+	}
+	if len(s.Sources) > 0 {
+		stats.WriteString(fmt.Sprintf("- Requests by source: %v\n", s.Sources))
+	}
 	stats.WriteString("------------------------------------------------------------------------------------------------------------------------\n")
 
 	return stats.String()
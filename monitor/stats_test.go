@@ -64,6 +64,51 @@ func (suite *StatsTestSuite) TestStatsSummary() {
 	require.ElementsMatch(t, expectedSummary.RequestStatuses, summary.RequestStatuses)
 }
 
+func (suite *StatsTestSuite) TestStatsSummaryRoutes() {
+	t := suite.T()
+	now := time.Now()
+	for _, url := range []string{"/report/user", "/report/123", "/report/456", "/report/summary"} {
+		entry := &LoggingEntry{RemoteHost: "127.0.0.1", RemoteLogname: "-", AuthUser: "james", Date: now, Request: &Request{Method: "GET", URL: url, Protocol: "HTTP/1.0"}, Status: 200, Bytes: 123}
+		require.Nil(t, suite.db.AddEntry(entry), "No error should be returned while adding an entry.")
+	}
+
+	summary, err := NewStatsSummary(now.Unix(), now.Unix(), suite.db)
+	require.Nil(t, err, "No error should be returned while computing stats.")
+	require.Equal(t, EntryList{{Key: "/report", Value: 4.0}}, summary.TopSections)
+	// The identifiers of the URLs are normalized into one route.
+	require.ElementsMatch(t, EntryList{{Key: "/report/:id", Value: 2.0}, {Key: "/report/user", Value: 1.0}, {Key: "/report/summary", Value: 1.0}}, summary.TopRoutes)
+}
+
+func (suite *StatsTestSuite) TestStatsSummaryMatchers() {
+	t := suite.T()
+	now := time.Now()
+	for i, status := range []int{500, 500, 503, 404, 200} {
+		entry := &LoggingEntry{RemoteHost: "127.0.0.1", RemoteLogname: "-", AuthUser: "james", Date: now, Request: &Request{Method: "GET", URL: "/report/user", Protocol: "HTTP/1.0"}, Status: status, Bytes: 123}
+		if i == 0 {
+			entry.RemoteHost = "172.16.0.1"
+			entry.Request.URL = "/home"
+		}
+		require.Nil(t, suite.db.AddEntry(entry), "No error should be returned while adding an entry.")
+	}
+
+	summary, err := NewStatsSummary(now.Unix(), now.Unix(), suite.db)
+	require.Nil(t, err, "No error should be returned while computing stats.")
+	require.Equal(t, GroupList{
+		{Labels: map[string]string{RequestURLSectionLabel: "/home", StatusLabel: "500"}, Value: 1},
+		{Labels: map[string]string{RequestURLSectionLabel: "/report", StatusLabel: "404"}, Value: 1},
+		{Labels: map[string]string{RequestURLSectionLabel: "/report", StatusLabel: "500"}, Value: 1},
+	}, summary.TopErrors)
+	require.Contains(t, summary.String(), `- Top 3 errors by section and status: [{section="/home", status="500"} 1`)
+
+	matchers := []Matcher{{StatusLabel, MatchRegexp, "5.."}, {HostLabel, MatchEqual, "127.0.0.1"}}
+	summary, err = NewStatsSummary(now.Unix(), now.Unix(), suite.db, matchers...)
+	require.Nil(t, err, "No error should be returned while computing stats.")
+	require.Equal(t, EntryList{{Key: "/report", Value: 2.0}}, summary.TopSections)
+	require.ElementsMatch(t, EntryList{{Key: "500", Value: 1.0}, {Key: "503", Value: 1.0}}, summary.RequestStatuses)
+	require.Len(t, summary.TopErrors, 2)
+	require.Contains(t, summary.String(), `for {status=~"5..", host="127.0.0.1"}:`)
+}
+
 func TestStatsTestSuite(t *testing.T) {
 	suite.Run(t, new(StatsTestSuite))
 }
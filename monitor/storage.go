@@ -0,0 +1,59 @@
+package monitor
+
+import "fmt"
+
+const (
+	// StorageTSDB stores the entries into a timeseries database, on disk.
+	StorageTSDB = "tsdb"
+	// StorageMemory stores the entries into memory, for short windows.
+	StorageMemory = "memory"
+)
+
+// Storage stores the logging entries and sums up their hits by label. The time ranges are given as Unix timestamps in
+// seconds, both included.
+type Storage interface {
+	// AddEntry adds a new entry.
+	AddEntry(entry *LoggingEntry) error
+	// AddEntries adds a batch of entries. The entries which can't be stored because they are out of order or too old
+	// are skipped, their number is returned.
+	AddEntries(entries []*LoggingEntry) (int, error)
+	// GetEntries sums up the hits of the entries whose label matches the pattern, by value of the label. The entries
+	// must also match all the other matchers.
+	GetEntries(label string, pattern string, since int64, until int64, matchers ...Matcher) (EntryList, error)
+	// TopEntries works like GetEntries, but returns only the "limit" values with the most hits (all if limit is not
+	// positive), sorted descending.
+	TopEntries(label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error)
+	// TopEntriesBy returns the top values of "groupLabel" from the entries whose "label" matches the pattern.
+	TopEntriesBy(groupLabel string, label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error)
+	// GetRange works like GetEntries, but counts the hits by step of "step" seconds from "since": each label value
+	// has a point for every step of the range, even without hits.
+	GetRange(label string, pattern string, since int64, until int64, step int64, matchers ...Matcher) (SeriesList, error)
+	// Query adds up the hits, or the bytes, of the entries matching all the matchers of the query, grouped by its labels.
+	Query(query Query) (GroupList, error)
+	// CountDistinct estimates the number of distinct values of a label, with HyperLogLog sketches by minute: the
+	// window is extended to whole minutes. Only the LabelConfig.DistinctLabels are counted, ErrDistinctNotCounted is
+	// returned for the other labels.
+	CountDistinct(label string, since int64, until int64) (float64, error)
+	// Close releases the storage, keeping the stored data.
+	Close() error
+	// Cleanup releases the storage and drops all stored data.
+	Cleanup() error
+}
+
+// OpenStorage opens the storage selected by the configuration.
+func OpenStorage(config DatabaseConfig) (Storage, error) {
+	switch config.Storage {
+	case "", StorageTSDB:
+		return OpenLoggingDatabase(config)
+	case StorageMemory:
+		if config.Dir != "" || config.MaxBytes > 0 {
+			return nil, fmt.Errorf("the %s storage has no directory nor size limit", StorageMemory)
+		}
+		if config.RollupRetention > 0 {
+			return nil, fmt.Errorf("the %s storage has no rollups", StorageMemory)
+		}
+		return NewMemoryStorage(config.Retention, config.Labels), nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", config.Storage)
+	}
+}
@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errStorage = errors.New("storage failure")
+
+// mockStorage fails the calls whose error is set, and delegates the other ones to a memory storage.
+type mockStorage struct {
+	*MemoryStorage
+	addErr   error
+	getErr   error
+	topErr   error
+	topByErr error
+	rangeErr error
+	queryErr error
+}
+
+func newMockStorage() *mockStorage {
+	return &mockStorage{MemoryStorage: NewMemoryStorage(time.Hour, LabelConfig{})}
+}
+
+func (s *mockStorage) AddEntry(entry *LoggingEntry) error {
+	if s.addErr != nil {
+		return s.addErr
+	}
+	return s.MemoryStorage.AddEntry(entry)
+}
+
+func (s *mockStorage) AddEntries(entries []*LoggingEntry) (int, error) {
+	if s.addErr != nil {
+		return 0, s.addErr
+	}
+	return s.MemoryStorage.AddEntries(entries)
+}
+
+func (s *mockStorage) GetEntries(label string, pattern string, since int64, until int64, matchers ...Matcher) (EntryList, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	return s.MemoryStorage.GetEntries(label, pattern, since, until, matchers...)
+}
+
+func (s *mockStorage) TopEntries(label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error) {
+	if s.topErr != nil {
+		return nil, s.topErr
+	}
+	return s.MemoryStorage.TopEntries(label, pattern, since, until, limit, matchers...)
+}
+
+func (s *mockStorage) TopEntriesBy(groupLabel string, label string, pattern string, since int64, until int64, limit int, matchers ...Matcher) (EntryList, error) {
+	if s.topByErr != nil {
+		return nil, s.topByErr
+	}
+	return s.MemoryStorage.TopEntriesBy(groupLabel, label, pattern, since, until, limit, matchers...)
+}
+
+func (s *mockStorage) GetRange(label string, pattern string, since int64, until int64, step int64, matchers ...Matcher) (SeriesList, error) {
+	if s.rangeErr != nil {
+		return nil, s.rangeErr
+	}
+	return s.MemoryStorage.GetRange(label, pattern, since, until, step, matchers...)
+}
+
+func (s *mockStorage) Query(query Query) (GroupList, error) {
+	if s.queryErr != nil {
+		return nil, s.queryErr
+	}
+	return s.MemoryStorage.Query(query)
+}
+
+func TestOpenStorage(t *testing.T) {
+	storage, err := OpenStorage(DatabaseConfig{Storage: StorageMemory, Retention: time.Minute})
+	require.Nil(t, err, "Unexpected error raised")
+	require.IsType(t, &MemoryStorage{}, storage)
+
+	storage, err = OpenStorage(DatabaseConfig{})
+	require.Nil(t, err, "Unexpected error raised")
+	require.IsType(t, &LoggingDatabase{}, storage)
+	require.Nil(t, storage.Cleanup(), "Unexpected error raised")
+
+	_, err = OpenStorage(DatabaseConfig{Storage: StorageMemory, Dir: "/var/lib/httpmonitor"})
+	require.NotNil(t, err, "The memory storage has no directory")
+
+	_, err = OpenStorage(DatabaseConfig{Storage: "unknown"})
+	require.NotNil(t, err, "The storage is unknown")
+}
+
+func TestStatsSummaryStorageError(t *testing.T) {
+	db := newMockStorage()
+	db.topErr = errStorage
+
+	_, err := NewStatsSummary(0, time.Now().Unix(), db)
+	require.Equal(t, errStorage, err)
+
+	db.topErr = nil
+	db.queryErr = errStorage
+	_, err = NewStatsSummary(0, time.Now().Unix(), db)
+	require.Equal(t, errStorage, err)
+}
+
+func TestAlertStorageError(t *testing.T) {
+	db := newMockStorage()
+	db.getErr = errStorage
+
+	alert := NewAlert("test", time.Second, 5*time.Second, 1.0, HostLabel, AllEntriesPattern)
+	require.Equal(t, errStorage, alert.CheckStatus(db))
+	require.Equal(t, OK, alert.Status(), "The status must be unchanged")
+
+	// The top entries of the notification can't be collected either.
+	db.getErr = nil
+	db.topByErr = errStorage
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		require.Nil(t, db.AddEntry(testEntry("james", now)), "Unexpected error raised")
+	}
+	require.Equal(t, errStorage, alert.CheckStatusAt(db, now))
+
+	db.rangeErr = errStorage
+	alert = NewAlert("test", time.Second, 5*time.Second, 1.0, HostLabel, AllEntriesPattern, WithAggregation(AggregationPeak, time.Second))
+	require.Equal(t, errStorage, alert.CheckStatusAt(db, now))
+	require.Equal(t, OK, alert.Status(), "The status must be unchanged")
+}
+
+func TestBatchWriterStorageError(t *testing.T) {
+	db := newMockStorage()
+	db.addErr = errStorage
+
+	w := newBatchWriter(db, WriterConfig{BatchSize: 1, FlushInterval: time.Hour}, nil, newMetrics())
+	done := make(chan error)
+	go func() {
+		done <- w.run(context.Background())
+	}()
+
+	w.write(context.Background(), writeItem{entry: testEntry("james", time.Now())})
+	require.Equal(t, errStorage, <-done)
+}
+
+func TestAPIIngestStorageError(t *testing.T) {
+	m, err := NewMonitor(nil, nil, WithIngest(IngestConfig{Insecure: true}), WithDatabase(DatabaseConfig{Storage: StorageMemory}))
+	require.Nil(t, err, "Unexpected error raised")
+	defer m.Stop()
+
+	db := newMockStorage()
+	db.addErr = errStorage
+	m.db = db
+
+	// The batch is stored with a single commit, which fails as a whole.
+	recorder := ingestBatch(m, []byte(ingestLines(time.Now(), "james")), nil)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.JSONEq(t, `{"error":"storage failure"}`, recorder.Body.String())
+}
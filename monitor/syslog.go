@@ -0,0 +1,359 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SyslogSourceName is the source label of the lines received as syslog messages.
+	SyslogSourceName = "syslog"
+	// syslogMaxMessageSize is the size of the biggest message received.
+	syslogMaxMessageSize = 64 * 1024
+	// syslogMaxLengthDigits is the number of digits of the longest length prefix of the TCP messages.
+	syslogMaxLengthDigits = 6
+	// syslogNilValue replaces the unknown header fields of the RFC 5424 messages.
+	syslogNilValue = "-"
+)
+
+// syslogIdleTimeout is how long a TCP connection is kept without receiving anything.
+var syslogIdleTimeout = 5 * time.Minute
+
+// syslogMessage is the content of a syslog message, without its envelope.
+type syslogMessage struct {
+	hostname string
+	app      string
+	text     string
+}
+
+// labels returns the known fields of the envelope as labels.
+func (m syslogMessage) labels() map[string]string {
+	labels := make(map[string]string)
+	if m.hostname != "" {
+		labels[SyslogHostLabel] = m.hostname
+	}
+	if m.app != "" {
+		labels[SyslogAppLabel] = m.app
+	}
+
+	return labels
+}
+
+// parseSyslog strips the envelope of a RFC 5424 or RFC 3164 message. A message without a valid priority is returned as
+// it is.
+func parseSyslog(raw string) syslogMessage {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+
+	rest, ok := stripSyslogPriority(raw)
+	if !ok {
+		return syslogMessage{text: raw}
+	}
+
+	if strings.HasPrefix(rest, "1 ") {
+		if m, ok := parseRFC5424(rest[2:]); ok {
+			return m
+		}
+	}
+
+	return parseRFC3164(rest)
+}
+
+// stripSyslogPriority removes the "<PRI>" prefix of a message.
+func stripSyslogPriority(raw string) (string, bool) {
+	if !strings.HasPrefix(raw, "<") {
+		return "", false
+	}
+
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return "", false
+	}
+
+	priority, err := strconv.Atoi(raw[1:end])
+	if err != nil || priority < 0 || priority > 191 {
+		return "", false
+	}
+
+	return raw[end+1:], true
+}
+
+// parseRFC5424 parses a message after its version: "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]".
+func parseRFC5424(rest string) (syslogMessage, bool) {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return syslogMessage{}, false
+	}
+
+	text, ok := skipStructuredData(fields[5])
+	if !ok {
+		return syslogMessage{}, false
+	}
+	text = strings.TrimPrefix(text, " ")
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	m := syslogMessage{text: text}
+	if fields[1] != syslogNilValue {
+		m.hostname = fields[1]
+	}
+	if fields[2] != syslogNilValue {
+		m.app = fields[2]
+	}
+
+	return m, true
+}
+
+// skipStructuredData returns what follows the structured data of a RFC 5424 message (e.g `[id key="value"]`).
+func skipStructuredData(s string) (string, bool) {
+	if strings.HasPrefix(s, syslogNilValue) {
+		return s[len(syslogNilValue):], true
+	}
+	if !strings.HasPrefix(s, "[") {
+		return "", false
+	}
+
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuotes && s[i] == '\\':
+			// Escaped character.
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && s[i] == ']' && (i+1 == len(s) || s[i+1] != '['):
+			return s[i+1:], true
+		}
+	}
+
+	return "", false
+}
+
+// parseRFC3164 parses a message after its priority: "Mmm dd hh:mm:ss [HOSTNAME] TAG[PID]: MSG". A message without a
+// valid timestamp is returned as it is.
+func parseRFC3164(rest string) syslogMessage {
+	if len(rest) <= len(time.Stamp) || rest[len(time.Stamp)] != ' ' {
+		return syslogMessage{text: rest}
+	}
+	if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err != nil {
+		return syslogMessage{text: rest}
+	}
+	rest = rest[len(time.Stamp)+1:]
+
+	var m syslogMessage
+	if app, text, ok := splitSyslogTag(rest); ok {
+		// The hostname is missing.
+		m.app, m.text = app, text
+		return m
+	}
+
+	if space := strings.IndexByte(rest, ' '); space > 0 {
+		m.hostname = rest[:space]
+		rest = rest[space+1:]
+	}
+
+	m.text = rest
+	if app, text, ok := splitSyslogTag(rest); ok {
+		m.app, m.text = app, text
+	}
+
+	return m
+}
+
+// splitSyslogTag splits "TAG[PID]: MSG" into the tag and the message.
+func splitSyslogTag(s string) (string, string, bool) {
+	word := s
+	if space := strings.IndexByte(s, ' '); space >= 0 {
+		word = s[:space]
+	}
+	if len(word) < 2 || !strings.HasSuffix(word, ":") {
+		return "", s, false
+	}
+
+	tag := strings.TrimSuffix(word, ":")
+	if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+		tag = tag[:open]
+	}
+
+	return tag, strings.TrimPrefix(s[len(word):], " "), true
+}
+
+// SyslogSource receives the logging lines as syslog messages, over UDP or TCP (e.g from nginx with
+// "access_log syslog:server=..."). The envelope of the messages is removed and their hostname and application name
+// are added as labels.
+type SyslogSource struct {
+	packetConn net.PacketConn
+	listener   net.Listener
+}
+
+// ListenSyslog starts to listen for syslog messages on the address. The network is "udp" or "tcp".
+// Over TCP, the messages are delimited by new lines or prefixed by their length (RFC 6587).
+func ListenSyslog(network string, address string) (*SyslogSource, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &SyslogSource{packetConn: conn}, nil
+	case "tcp", "tcp4", "tcp6":
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &SyslogSource{listener: listener}, nil
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", network)
+	}
+}
+
+// Addr returns the address where the messages are received.
+func (s *SyslogSource) Addr() net.Addr {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr()
+	}
+
+	return s.listener.Addr()
+}
+
+// Lines receives the messages until the context is done. The listener is closed at the end.
+func (s *SyslogSource) Lines(ctx context.Context, lines chan<- logLine) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		s.close()
+	}()
+
+	var err error
+	if s.packetConn != nil {
+		err = s.receivePackets(ctx, lines)
+	} else {
+		err = s.acceptConnections(ctx, lines)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (s *SyslogSource) close() {
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	} else {
+		s.listener.Close()
+	}
+}
+
+// receivePackets reads one message per datagram.
+func (s *SyslogSource) receivePackets(ctx context.Context, lines chan<- logLine) error {
+	buf := make([]byte, syslogMaxMessageSize)
+	for {
+		n, _, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		if !sendSyslogMessage(ctx, string(buf[:n]), lines) {
+			return nil
+		}
+	}
+}
+
+// acceptConnections reads the messages of each TCP connection. The connections are closed with the listener.
+func (s *SyslogSource) acceptConnections(ctx context.Context, lines chan<- logLine) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+				case <-done:
+				}
+				conn.Close()
+			}()
+
+			readSyslogStream(ctx, conn, lines)
+		}()
+	}
+}
+
+// readSyslogStream reads the messages of a TCP connection until its end. The invalid frames, the messages bigger than
+// syslogMaxMessageSize and the connections idle for syslogIdleTimeout end the connection.
+func readSyslogStream(ctx context.Context, conn net.Conn, lines chan<- logLine) {
+	reader := bufio.NewReaderSize(conn, syslogMaxMessageSize)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(syslogIdleTimeout)); err != nil {
+			return
+		}
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var message string
+		if '1' <= first[0] && first[0] <= '9' {
+			// Octet counting: "LENGTH MESSAGE".
+			prefix, err := reader.ReadSlice(' ')
+			if err != nil || len(prefix) > syslogMaxLengthDigits+1 {
+				return
+			}
+			length, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+			if err != nil || length > syslogMaxMessageSize {
+				return
+			}
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return
+			}
+			message = string(buf)
+		} else {
+			// Non-transparent framing: one message per line. A line longer than the buffer is too big.
+			data, err := reader.ReadSlice('\n')
+			if err != nil && (err != io.EOF || len(data) == 0) {
+				return
+			}
+			message = string(data)
+		}
+
+		if strings.TrimSpace(message) == "" {
+			continue
+		}
+		if !sendSyslogMessage(ctx, message, lines) {
+			return
+		}
+	}
+}
+
+func sendSyslogMessage(ctx context.Context, raw string, lines chan<- logLine) bool {
+	m := parseSyslog(raw)
+	line := logLine{source: SyslogSourceName, text: m.text, labels: m.labels()}
+
+	select {
+	case lines <- line:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
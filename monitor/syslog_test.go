@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const syslogTestLine = `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected syslogMessage
+	}{
+		// nginx
+		{"<190>May  9 16:00:39 web1 nginx: " + syslogTestLine, syslogMessage{hostname: "web1", app: "nginx", text: syslogTestLine}},
+		{"<13>Oct 11 22:14:15 mymachine su[123]: 'su root' failed\n", syslogMessage{hostname: "mymachine", app: "su", text: "'su root' failed"}},
+		// RFC 3164 without hostname.
+		{"<190>May  9 16:00:39 nginx: message", syslogMessage{app: "nginx", text: "message"}},
+		// RFC 3164 without tag.
+		{"<190>May  9 16:00:39 web1 message", syslogMessage{hostname: "web1", text: "message"}},
+		// RFC 3164 without timestamp.
+		{"<190>nginx: message", syslogMessage{text: "nginx: message"}},
+		{"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com nginx - ID47 - " + syslogTestLine,
+			syslogMessage{hostname: "mymachine.example.com", app: "nginx", text: syslogTestLine}},
+		{`<165>1 2003-10-11T22:14:15.003Z - - - - [exampleSDID@32473 iut="3" eventSource="App\"]"][examplePriority@32473 class="high"] ` + "\ufeffmessage",
+			syslogMessage{text: "message"}},
+		{"<165>1 2003-10-11T22:14:15.003Z host app - - -", syslogMessage{hostname: "host", app: "app"}},
+		// Without envelope.
+		{syslogTestLine, syslogMessage{text: syslogTestLine}},
+		{"<999>message", syslogMessage{text: "<999>message"}},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, parseSyslog(test.raw), "Unexpected message for %q", test.raw)
+	}
+}
+
+// startSyslog listens on a random local port in background. The returned function stops the source.
+func startSyslog(t *testing.T, network string) (net.Addr, <-chan logLine, func()) {
+	source, err := ListenSyslog(network, "127.0.0.1:0")
+	require.Nil(t, err, "Unexpected error raised")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan logLine)
+	done := make(chan error)
+	go func() {
+		done <- source.Lines(ctx, lines)
+	}()
+
+	return source.Addr(), lines, func() {
+		cancel()
+		require.Nil(t, <-done)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	addr, lines, stop := startSyslog(t, "udp")
+	defer stop()
+
+	conn, err := net.Dial("udp", addr.String())
+	require.Nil(t, err, "Unexpected error raised")
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("<190>May  9 16:00:39 web1 nginx: " + syslogTestLine))
+	require.Nil(t, err, "Unexpected error raised")
+
+	received := receiveLines(t, lines, 1)
+	require.Equal(t, []string{syslogTestLine}, texts(received))
+	require.Equal(t, SyslogSourceName, received[0].source)
+	require.Equal(t, map[string]string{SyslogHostLabel: "web1", SyslogAppLabel: "nginx"}, received[0].labels)
+}
+
+func TestSyslogTCP(t *testing.T) {
+	addr, lines, stop := startSyslog(t, "tcp")
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.Nil(t, err, "Unexpected error raised")
+	defer conn.Close()
+
+	// A message delimited by a new line, then a message prefixed by its length.
+	first := "<190>May  9 16:00:39 web1 nginx: first\n"
+	second := "<34>1 2003-10-11T22:14:15.003Z web2 app - - - multi\nline"
+	_, err = conn.Write([]byte(first + "56 " + second))
+	require.Nil(t, err, "Unexpected error raised")
+
+	received := receiveLines(t, lines, 2)
+	require.Equal(t, []string{"first", "multi\nline"}, texts(received))
+	require.Equal(t, map[string]string{SyslogHostLabel: "web2", SyslogAppLabel: "app"}, received[1].labels)
+}
+
+func TestSyslogTCPMessageTooBig(t *testing.T) {
+	addr, _, stop := startSyslog(t, "tcp")
+	defer stop()
+
+	for _, data := range []string{strings.Repeat("a", syslogMaxMessageSize+1), "1234567 message"} {
+		conn, err := net.Dial("tcp", addr.String())
+		require.Nil(t, err, "Unexpected error raised")
+
+		_, err = conn.Write([]byte(data))
+		require.Nil(t, err, "Unexpected error raised")
+
+		// The connection is closed without waiting for the end of the message.
+		require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		require.NotNil(t, err, "The connection should be closed")
+		netErr, ok := err.(net.Error)
+		require.False(t, ok && netErr.Timeout(), "The connection should be closed before the deadline")
+		conn.Close()
+	}
+}
+
+func TestSyslogTCPIdle(t *testing.T) {
+	defer func(timeout time.Duration) { syslogIdleTimeout = timeout }(syslogIdleTimeout)
+	syslogIdleTimeout = 100 * time.Millisecond
+
+	addr, _, stop := startSyslog(t, "tcp")
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.Nil(t, err, "Unexpected error raised")
+	defer conn.Close()
+
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.NotNil(t, err, "The idle connection should be closed")
+	netErr, ok := err.(net.Error)
+	require.False(t, ok && netErr.Timeout(), "The connection should be closed before the deadline")
+}
+
+func TestListenSyslogUnsupportedNetwork(t *testing.T) {
+	_, err := ListenSyslog("unix", "/tmp/syslog.sock")
+	require.NotNil(t, err, "An error should be raised for an unsupported network")
+}
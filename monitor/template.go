@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultAlertMessage reproduces the messages displayed for the threshold alerts.
+	DefaultAlertMessage = `{{ if .Firing }}High traffic generated an alert - hits = {{ printf "%f" .Value }}, triggered at {{ formatTime .Time }}` +
+		`{{ else }}The traffic returned back to normal - hits = {{ printf "%f" .Value }}, at {{ formatTime .Time }}{{ end }}`
+	// DefaultNotificationTemplate writes the message of each alert on its own line.
+	DefaultNotificationTemplate = "{{ range .Alerts }}{{ .Message }}\n{{ end }}"
+
+	timeFormat = "2006-01-02 15:04:05 -0700 MST"
+)
+
+var templateFuncs = template.FuncMap{
+	"duration":           humanizeDuration,
+	"humanize":           humanize,
+	"humanizePercentage": humanizePercentage,
+	"formatTime":         formatTime,
+	"join":               strings.Join,
+	"upper":              strings.ToUpper,
+	"lower":              strings.ToLower,
+}
+
+// NewTemplate parses a message template. Besides the text/template builtins, the template can use:
+//   - duration: formats a time.Duration or a number of seconds (e.g "2m", "1h30m")
+//   - humanize: formats a number using SI prefixes (e.g "1.5k")
+//   - humanizePercentage: formats a ratio as percentage (e.g 0.25 as "25%")
+//   - formatTime: formats a time.Time using the same layout as the alert messages
+//   - join, upper, lower: the equivalent functions from the strings package
+func NewTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+func executeTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func humanizeDuration(value interface{}) (string, error) {
+	var d time.Duration
+	switch v := value.(type) {
+	case time.Duration:
+		d = v
+	case Duration:
+		d = time.Duration(v)
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	default:
+		return "", fmt.Errorf("duration: unsupported type %T", value)
+	}
+
+	s := d.String()
+	// Drop the zero units from the end (e.g "2m0s" becomes "2m").
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s, nil
+}
+
+func humanize(value float64) string {
+	if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Sprintf("%.4g", value)
+	}
+
+	prefixes := []string{"", "k", "M", "G", "T", "P"}
+	i := 0
+	for math.Abs(value) >= 1000 && i < len(prefixes)-1 {
+		value /= 1000
+		i++
+	}
+
+	return fmt.Sprintf("%.4g%s", value, prefixes[i])
+}
+
+func humanizePercentage(value float64) string {
+	return fmt.Sprintf("%.4g%%", value*100)
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(timeFormat)
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHumanizeDuration(t *testing.T) {
+	cases := map[interface{}]string{
+		2 * time.Minute:            "2m",
+		90 * time.Minute:           "1h30m",
+		time.Hour:                  "1h",
+		1500 * time.Millisecond:    "1.5s",
+		Duration(10 * time.Second): "10s",
+		30.0:                       "30s",
+		120:                        "2m",
+		int64(3600):                "1h",
+	}
+
+	for value, expected := range cases {
+		s, err := humanizeDuration(value)
+		require.Nil(t, err, "Unexpected error raised")
+		require.Equal(t, expected, s)
+	}
+
+	_, err := humanizeDuration("2m")
+	require.NotNil(t, err, "An error should be raised for unsupported types")
+}
+
+func TestHumanize(t *testing.T) {
+	require.Equal(t, "0", humanize(0))
+	require.Equal(t, "12.5", humanize(12.5))
+	require.Equal(t, "1.5k", humanize(1500))
+	require.Equal(t, "2.35M", humanize(2350000))
+	require.Equal(t, "25%", humanizePercentage(0.25))
+}
+
+func TestNewTemplate(t *testing.T) {
+	tmpl, err := NewTemplate("test", `{{ .Name | upper }} {{ duration .Window }} {{ humanize .Value }} {{ range .TopSections }}{{ .Key }} {{ end }}{{ .Labels.team }}`)
+	require.Nil(t, err, "Unexpected error raised")
+
+	event := &AlertEvent{
+		Name:        "traffic",
+		Value:       1234,
+		Window:      2 * time.Minute,
+		Labels:      map[string]string{"team": "web"},
+		TopSections: EntryList{{Key: "/report", Value: 3}, {Key: "/home", Value: 1}},
+	}
+	text, err := executeTemplate(tmpl, event)
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, "TRAFFIC 2m 1.234k /report /home web", text)
+
+	_, err = NewTemplate("invalid", "{{ .Name ")
+	require.NotNil(t, err, "An error should be raised for invalid templates")
+}
+
+func TestDefaultAlertMessage(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 2, 0, 0, time.UTC)
+
+	firing, err := executeTemplate(defaultAlertMessage, &AlertEvent{Status: Critical, Value: 1.5, Time: now})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, "High traffic generated an alert - hits = 1.500000, triggered at 2020-01-01 00:02:00 +0000 UTC", firing)
+
+	resolved, err := executeTemplate(defaultAlertMessage, &AlertEvent{Status: OK, Value: 0.5, Time: now})
+	require.Nil(t, err, "Unexpected error raised")
+	require.Equal(t, "The traffic returned back to normal - hits = 0.500000, at 2020-01-01 00:02:00 +0000 UTC", resolved)
+}
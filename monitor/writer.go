@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultBatchSize is the default number of entries committed at once.
+	DefaultBatchSize = 1000
+	// DefaultFlushInterval is the default longest time an entry waits before being committed.
+	DefaultFlushInterval = time.Second
+	// DefaultQueueSize is the default number of entries waiting to be committed.
+	DefaultQueueSize = 10000
+)
+
+// WriterConfig configures how the parsed entries are written into the database. The defaults are used for the
+// values which aren't positive.
+type WriterConfig struct {
+	// BatchSize is the number of entries committed at once.
+	BatchSize int
+	// FlushInterval is the longest time an entry waits before being committed.
+	FlushInterval time.Duration
+	// QueueSize is the number of entries waiting to be committed. When the queue is full, the reading of the sources
+	// is blocked until there is room again, unless DropWhenFull is set.
+	QueueSize int
+	// DropWhenFull drops the new entries while the queue is full, instead of blocking.
+	DropWhenFull bool
+}
+
+// writeItem is a line waiting to be committed. The entry is nil for the invalid lines, which are only queued to
+// update the checkpoint in order.
+type writeItem struct {
+	entry    *LoggingEntry
+	source   string
+	position Position
+}
+
+// batchWriter commits the entries into the database by batches, in background.
+// The positions of the lines are saved into the checkpoint once their entries are committed.
+type batchWriter struct {
+	db         Storage
+	config     WriterConfig
+	checkpoint *Checkpoint
+	queue      chan writeItem
+
+	dropped   prometheus.Counter
+	skipped   prometheus.Counter
+	committed prometheus.Counter
+}
+
+func newBatchWriter(db Storage, config WriterConfig, checkpoint *Checkpoint, m *metrics) *batchWriter {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+
+	w := &batchWriter{
+		db:         db,
+		config:     config,
+		checkpoint: checkpoint,
+		queue:      make(chan writeItem, config.QueueSize),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "dropped_entries_total",
+			Help:      "Number of entries dropped because the write queue was full.",
+		}),
+		skipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "skipped_entries_total",
+			Help:      "Number of entries rejected by the database because they were out of order or too old.",
+		}),
+		committed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "committed_entries_total",
+			Help:      "Number of entries committed into the database.",
+		}),
+	}
+
+	m.registry.MustRegister(w.dropped, w.skipped, w.committed, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "write_queue_depth",
+		Help:      "Number of entries waiting to be committed.",
+	}, func() float64 {
+		return float64(len(w.queue))
+	}))
+
+	return w
+}
+
+// write queues an item. While the queue is full, it blocks until there is room again or drops the item.
+func (w *batchWriter) write(ctx context.Context, item writeItem) {
+	if w.config.DropWhenFull {
+		select {
+		case w.queue <- item:
+		default:
+			w.dropped.Inc()
+		}
+		return
+	}
+
+	select {
+	case w.queue <- item:
+	case <-ctx.Done():
+	}
+}
+
+// run commits the queued items until the context is done. The items still queued at the end are committed before
+// returning. The method is blocking.
+func (w *batchWriter) run(ctx context.Context) error {
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]writeItem, 0, w.config.BatchSize)
+	for {
+		select {
+		case item := <-w.queue:
+			batch = append(batch, item)
+			if len(batch) < w.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return w.drain(batch)
+		}
+
+		if err := w.commit(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+}
+
+// drain commits the batch and all the queued items.
+func (w *batchWriter) drain(batch []writeItem) error {
+	for {
+		select {
+		case item := <-w.queue:
+			batch = append(batch, item)
+			if len(batch) < w.config.BatchSize {
+				continue
+			}
+		default:
+			return w.commit(batch)
+		}
+
+		if err := w.commit(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+}
+
+// commit adds the entries of a batch into the database, then updates the checkpoint.
+func (w *batchWriter) commit(batch []writeItem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	entries := make([]*LoggingEntry, 0, len(batch))
+	for _, item := range batch {
+		if item.entry != nil {
+			entries = append(entries, item.entry)
+		}
+	}
+
+	skipped, err := w.db.AddEntries(entries)
+	if err != nil {
+		return err
+	}
+	w.skipped.Add(float64(skipped))
+	w.committed.Add(float64(len(entries) - skipped))
+
+	if w.checkpoint != nil {
+		for _, item := range batch {
+			// The lines read from the rotated files have no position.
+			if item.position != (Position{}) {
+				w.checkpoint.Update(item.source, item.position)
+			}
+		}
+	}
+
+	return nil
+}
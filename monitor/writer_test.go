@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// countEntries returns the number of entries stored around a date.
+func countEntries(t *testing.T, db *LoggingDatabase, date time.Time) float64 {
+	entries, err := db.GetEntries(HostLabel, AllEntriesPattern, date.Add(-time.Hour).Unix(), date.Add(time.Hour).Unix())
+	require.Nil(t, err, "Unexpected error raised")
+
+	total := 0.0
+	for _, e := range entries {
+		total += e.Value
+	}
+	return total
+}
+
+// startWriter runs a writer in background. The returned function stops it.
+func startWriter(t *testing.T, w *batchWriter) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.run(ctx)
+	}()
+
+	return func() {
+		cancel()
+		require.Nil(t, <-done)
+	}
+}
+
+func TestBatchWriterBatchSize(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	w := newBatchWriter(db, WriterConfig{BatchSize: 2, FlushInterval: time.Hour}, nil, newMetrics())
+	stop := startWriter(t, w)
+
+	now := time.Now()
+	for _, user := range []string{"james", "jill", "frank"} {
+		w.write(context.Background(), writeItem{entry: testEntry(user, now)})
+	}
+
+	// The first batch is committed once full, the rest when the writer stops.
+	require.Eventually(t, func() bool { return countEntries(t, db, now) == 2 }, 5*time.Second, 10*time.Millisecond)
+	stop()
+	require.Equal(t, 3.0, countEntries(t, db, now))
+	require.Equal(t, 3.0, testutil.ToFloat64(w.committed))
+}
+
+func TestBatchWriterFlushInterval(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	w := newBatchWriter(db, WriterConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond}, nil, newMetrics())
+	stop := startWriter(t, w)
+	defer stop()
+
+	now := time.Now()
+	w.write(context.Background(), writeItem{entry: testEntry("james", now)})
+	require.Eventually(t, func() bool { return countEntries(t, db, now) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBatchWriterDropWhenFull(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	// The writer isn't running, so the queue is never emptied.
+	w := newBatchWriter(db, WriterConfig{QueueSize: 2, DropWhenFull: true}, nil, newMetrics())
+	now := time.Now()
+	for _, user := range []string{"james", "jill", "frank"} {
+		w.write(context.Background(), writeItem{entry: testEntry(user, now)})
+	}
+
+	require.Equal(t, 1.0, testutil.ToFloat64(w.dropped))
+	require.Len(t, w.queue, 2)
+}
+
+func TestBatchWriterBlockWhenFull(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	w := newBatchWriter(db, WriterConfig{QueueSize: 1}, nil, newMetrics())
+	w.write(context.Background(), writeItem{entry: testEntry("james", time.Now())})
+
+	// The write is blocked until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w.write(ctx, writeItem{entry: testEntry("jill", time.Now())})
+	require.Equal(t, context.DeadlineExceeded, ctx.Err())
+	require.Equal(t, 0.0, testutil.ToFloat64(w.dropped))
+}
+
+func TestBatchWriterCheckpoint(t *testing.T) {
+	db, err := NewLoggingDatabase()
+	require.Nil(t, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	checkpoint := &Checkpoint{positions: make(map[string]Position)}
+	w := newBatchWriter(db, WriterConfig{BatchSize: 100, FlushInterval: time.Hour}, checkpoint, newMetrics())
+
+	first := Position{File: fileID{Device: 1, Inode: 2}, Offset: 10}
+	second := Position{File: fileID{Device: 1, Inode: 2}, Offset: 20}
+	w.write(context.Background(), writeItem{entry: testEntry("james", time.Now()), source: "access.log", position: first})
+	// An invalid line moves the position too.
+	w.write(context.Background(), writeItem{source: "access.log", position: second})
+
+	// Nothing is saved before the commit.
+	_, ok := checkpoint.Get("access.log")
+	require.False(t, ok)
+
+	startWriter(t, w)()
+	position, ok := checkpoint.Get("access.log")
+	require.True(t, ok)
+	require.Equal(t, second, position)
+}
+
+// benchmarkEntries generates entries of different series, in order.
+func benchmarkEntries(n int) []*LoggingEntry {
+	start := time.Now()
+	entries := make([]*LoggingEntry, n)
+	for i := range entries {
+		entries[i] = testEntry(fmt.Sprintf("user%d", i%100), start.Add(time.Duration(i/100)*time.Second))
+	}
+
+	return entries
+}
+
+// BenchmarkAddEntry commits each entry, like the monitor did before the batched writes.
+func BenchmarkAddEntry(b *testing.B) {
+	db, err := NewLoggingDatabase()
+	require.Nil(b, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	entries := benchmarkEntries(b.N)
+	b.ResetTimer()
+	start := time.Now()
+	for _, entry := range entries {
+		if err := db.AddEntry(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "lines/s")
+}
+
+// BenchmarkBatchWriter queues the entries to a writer running in background, like the monitor does.
+func BenchmarkBatchWriter(b *testing.B) {
+	db, err := NewLoggingDatabase()
+	require.Nil(b, err, "Unexpected error raised")
+	defer db.Cleanup()
+
+	w := newBatchWriter(db, WriterConfig{}, nil, newMetrics())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.run(ctx)
+	}()
+
+	entries := benchmarkEntries(b.N)
+	b.ResetTimer()
+	start := time.Now()
+	for _, entry := range entries {
+		w.write(ctx, writeItem{entry: entry})
+	}
+	cancel()
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "lines/s")
+}
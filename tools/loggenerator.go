@@ -49,7 +49,7 @@ func main() {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 
 	// Handle sigterm and await termChan signal
-	termChan := make(chan os.Signal)
+	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go generateLogs(ctx)